@@ -39,7 +39,7 @@ func main() {
 	for project, streams := range cfg.Streams {
 		log.Info("加载项目", "项目", project, "流数量", len(streams))
 		for _, stream := range streams {
-			sched.AddStream(stream.ID, stream.URL, project)
+			sched.AddStream(stream, project)
 			totalStreams++
 		}
 	}
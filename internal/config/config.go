@@ -1,7 +1,9 @@
 package config
 
 import (
+	"fmt"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
@@ -9,24 +11,116 @@ import (
 // Config 配置结构
 type Config struct {
 	Exporter ExporterConfig            `yaml:"exporter"`
-	Streams  map[string][]StreamConfig `yaml:"streams"` // project -> streams
+	Projects map[string]ProjectConfig  `yaml:"projects"` // project -> 项目级配置，对项目下所有流生效
+	Streams  map[string][]StreamConfig `yaml:"streams"`  // project -> streams
 }
 
 // ExporterConfig 导出器配置
 type ExporterConfig struct {
-	CheckInterval  int    `yaml:"check_interval"`  // 检查间隔（秒）
-	SampleDuration int    `yaml:"sample_duration"` // 采样时长（秒），默认10秒
-	MinKeyframes   int    `yaml:"min_keyframes"`   // 最小关键帧数，默认2
-	MaxConcurrent  int    `yaml:"max_concurrent"`
-	MaxRetries     int    `yaml:"max_retries"`
-	ListenAddr     string `yaml:"listen_addr"` // Prometheus exporter 监听地址
-	LogLevel       string `yaml:"log_level"`   // 日志级别
+	CheckInterval             int    `yaml:"check_interval"`  // 检查间隔（秒）
+	SampleDuration            int    `yaml:"sample_duration"` // 采样时长（秒），默认10秒
+	MinKeyframes              int    `yaml:"min_keyframes"`   // 最小关键帧数，默认2
+	MaxConcurrent             int    `yaml:"max_concurrent"`
+	MaxRetries                int    `yaml:"max_retries"`
+	ListenAddr                string `yaml:"listen_addr"`                 // Prometheus exporter 监听地址
+	LogLevel                  string `yaml:"log_level"`                   // 日志级别
+	RTSPTransport             string `yaml:"rtsp_transport"`              // RTSP 传输方式：tcp（默认）或 udp
+	AVSyncThreshold           int    `yaml:"av_sync_threshold"`           // 音画不同步告警阈值（毫秒），默认200
+	TimestampJumpThreshold    int    `yaml:"timestamp_jump_threshold"`    // DTS 前跳超过该值（毫秒）计为跳变，默认1000
+	MetadataMismatchThreshold int    `yaml:"metadata_mismatch_threshold"` // onMetaData 声明值与实测值相差超过该百分比时标记，默认30
+	FrozenThreshold           int    `yaml:"frozen_threshold"`            // 画面静止超过该时长（秒）判定为冻结，默认5
+	StartupBuffer             int    `yaml:"startup_buffer"`              // 模拟播放器的起播缓冲时长（毫秒），默认1000
 }
 
 // StreamConfig 流配置
 type StreamConfig struct {
-	URL string `yaml:"url"`
-	ID  string `yaml:"id"`
+	URL             string        `yaml:"url"`
+	ID              string        `yaml:"id"`
+	Protocol        string        `yaml:"protocol"`          // 流协议：flv/hls/rtmp/rtsp/srt/whep/dash/ts，为空时按 URL 自动识别
+	SRT             SRTConfig     `yaml:"srt"`               // SRT 连接参数（仅 srt:// 流有效）
+	AVSyncThreshold int           `yaml:"av_sync_threshold"` // 音画不同步告警阈值（毫秒），为 0 时使用 exporter 配置
+	Request         RequestConfig `yaml:"request"`           // HTTP 请求选项，与项目级配置合并，流级别优先
+	Edges           []EdgeConfig  `yaml:"edges"`             // 同一路流的其他 CDN 地址或边缘节点 IP，每次检查与 url 并发检查
+}
+
+// EdgeConfig 多边缘对比检查中的一个边缘，url 和 ip 至少配置一个
+type EdgeConfig struct {
+	Name     string     `yaml:"name"`     // 指标 edge 标签，默认为 ip 或地址的主机名，同一路流内不能重复
+	URL      string     `yaml:"url"`      // 其他 CDN 的播放地址，为空时使用流的 url
+	Protocol string     `yaml:"protocol"` // 流协议，为空时按地址自动识别（未配置 url 时沿用流的协议）
+	IP       string     `yaml:"ip"`       // 直接连接的边缘节点 IP，HTTP 类协议的 Host 头和 TLS SNI 仍使用地址中的域名
+	Sign     SignConfig `yaml:"sign"`     // 该 CDN 的鉴权签名，为空时使用项目配置
+}
+
+// ProjectConfig 项目级配置
+type ProjectConfig struct {
+	Latency LatencyConfig `yaml:"latency"` // 端到端延迟测量
+	Request RequestConfig `yaml:"request"` // HTTP 请求选项，对项目下所有流生效
+	Sign    SignConfig    `yaml:"sign"`    // CDN 鉴权签名，对项目下所有流生效
+}
+
+// SignConfig CDN 时间戳鉴权，每次检查前按当前时间为流地址重新生成签名参数，指标标签仍使用原地址
+type SignConfig struct {
+	Type         string `yaml:"type"`          // tencent（txSecret / txTime）、aliyun（auth_key A 方式）或 hmac，为空时不签名
+	Key          Secret `yaml:"key"`           // 鉴权密钥
+	Expire       int    `yaml:"expire"`        // 签名有效期（秒），默认3600
+	Algorithm    string `yaml:"algorithm"`     // hmac 的哈希算法：md5 / sha1 / sha256（默认）/ sha512
+	TokenParam   string `yaml:"token_param"`   // hmac 签名参数名，默认 token
+	ExpiresParam string `yaml:"expires_param"` // hmac 过期时间参数名，默认 expires
+}
+
+// RequestConfig HTTP 类协议（HTTP-FLV / HTTP-TS / HLS / DASH / WHEP）的请求选项
+type RequestConfig struct {
+	Headers   map[string]Secret `yaml:"headers"`    // 附加请求头，例如 Referer
+	Cookies   map[string]Secret `yaml:"cookies"`    // Cookie 名 -> 值
+	UserAgent string            `yaml:"user_agent"` // User-Agent，为空时使用 Go 默认值
+	Auth      AuthConfig        `yaml:"auth"`
+}
+
+// AuthConfig 认证方式：配置 token 时使用 Bearer，配置 username 时使用 Basic
+type AuthConfig struct {
+	Username string `yaml:"username"`
+	Password Secret `yaml:"password"`
+	Token    Secret `yaml:"token"`
+}
+
+// Secret 敏感配置值：env:NAME 从环境变量读取，file:/path 从文件读取（去掉末尾换行），其他按字面值使用
+type Secret string
+
+// Resolve 读取实际值，每次调用都重新读取，便于轮换
+func (s Secret) Resolve() (string, error) {
+	v := string(s)
+	switch {
+	case strings.HasPrefix(v, "env:"):
+		name := strings.TrimPrefix(v, "env:")
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("环境变量未设置: %s", name)
+		}
+		return value, nil
+	case strings.HasPrefix(v, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(v, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	default:
+		return v, nil
+	}
+}
+
+// LatencyConfig 编码端在流中嵌入系统时间的位置，用于计算端到端延迟，都为空时不测量
+type LatencyConfig struct {
+	SEIUUID string `yaml:"sei_uuid"` // H.264/H.265 SEI user_data_unregistered 的 UUID（32 位十六进制，可带 -）
+	AMFKey  string `yaml:"amf_key"`  // onTextData / onFI 脚本消息中时间戳字段名
+}
+
+// SRTConfig SRT 连接参数
+type SRTConfig struct {
+	Passphrase string `yaml:"passphrase"` // 加密口令（10-79 个字符），为空表示不加密
+	PBKeyLen   int    `yaml:"pbkeylen"`   // 密钥长度（字节）：16/24/32，默认16
+	Latency    int    `yaml:"latency"`    // 接收延迟（毫秒），默认120
+	StreamID   string `yaml:"streamid"`   // Stream ID，为空时使用 URL 中的 streamid 参数
 }
 
 // Load 加载配置文件
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSecretResolve(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "token"), []byte("s3cret\n"), 0o600)
+	os.WriteFile(filepath.Join(dir, "crlf"), []byte("abc\r\n"), 0o600)
+	t.Setenv("TEST_SECRET_TOKEN", "from-env")
+	t.Setenv("TEST_SECRET_EMPTY", "")
+
+	tests := []struct {
+		name    string
+		secret  Secret
+		want    string
+		wantErr bool
+	}{
+		{name: "字面值", secret: "plain", want: "plain"},
+		{name: "空", secret: "", want: ""},
+		{name: "环境变量", secret: "env:TEST_SECRET_TOKEN", want: "from-env"},
+		{name: "环境变量为空字符串", secret: "env:TEST_SECRET_EMPTY", want: ""},
+		{name: "环境变量未设置", secret: "env:TEST_SECRET_MISSING", wantErr: true},
+		{name: "文件去掉末尾换行", secret: Secret("file:" + filepath.Join(dir, "token")), want: "s3cret"},
+		{name: "文件去掉末尾 CRLF", secret: Secret("file:" + filepath.Join(dir, "crlf")), want: "abc"},
+		{name: "文件不存在", secret: Secret("file:" + filepath.Join(dir, "missing")), wantErr: true},
+		{name: "前缀区分大小写", secret: "ENV:TEST_SECRET_TOKEN", want: "ENV:TEST_SECRET_TOKEN"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.secret.Resolve()
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("Resolve() = %q, %v, want %q wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
@@ -4,30 +4,36 @@ import (
 	"fmt"
 	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	"video-exporter/internal/logger"
 	"video-exporter/internal/scheduler"
+	"video-exporter/internal/stream"
 )
 
 // Exporter Prometheus 导出器
 type Exporter struct {
-	streamUp       *prometheus.GaugeVec
-	streamHealthy  *prometheus.GaugeVec
-	streamPlayable *prometheus.GaugeVec
-	totalPackets   *prometheus.GaugeVec
-	videoPackets   *prometheus.GaugeVec
-	audioPackets   *prometheus.GaugeVec
-	keyframes      *prometheus.GaugeVec
-	currentBitrate *prometheus.GaugeVec
-	avgBitrate     *prometheus.GaugeVec
-	framerate      *prometheus.GaugeVec
-	responseTime   *prometheus.GaugeVec
-	gopSize        *prometheus.GaugeVec
-	qualityScore   *prometheus.GaugeVec
-	stabilityScore *prometheus.GaugeVec
+	streamUp         *prometheus.GaugeVec
+	streamHealthy    *prometheus.GaugeVec
+	streamPlayable   *prometheus.GaugeVec
+	totalPackets     *prometheus.GaugeVec
+	videoPackets     *prometheus.GaugeVec
+	audioPackets     *prometheus.GaugeVec
+	keyframes        *prometheus.GaugeVec
+	currentBitrate   *prometheus.GaugeVec
+	avgBitrate       *prometheus.GaugeVec
+	framerate        *prometheus.GaugeVec
+	responseTime     *prometheus.GaugeVec
+	gopSize          *prometheus.GaugeVec
+	keyframeInterval *prometheus.GaugeVec
+	gopCV            *prometheus.GaugeVec
+	qualityScore     *prometheus.GaugeVec
+	stabilityScore   *prometheus.GaugeVec
 
 	// 网络稳定性指标
 	rtt             *prometheus.GaugeVec
@@ -35,6 +41,103 @@ type Exporter struct {
 	networkJitter   *prometheus.GaugeVec
 	reconnectCount  *prometheus.GaugeVec // 改为 Gauge，记录本周期内的重连次数
 
+	// HLS 指标
+	hlsPlaylistStaleness   *prometheus.GaugeVec
+	hlsTargetDurationDrift *prometheus.GaugeVec
+	hlsMediaSequenceGaps   *prometheus.GaugeVec
+
+	// RTMP 指标
+	rtmpHandshakeTime       *prometheus.GaugeVec
+	rtmpConnectToFirstVideo *prometheus.GaugeVec
+
+	// SRT 指标
+	srtRTT                  *prometheus.GaugeVec
+	srtRetransmittedPackets *prometheus.GaugeVec
+	srtDroppedPackets       *prometheus.GaugeVec
+	srtReceiveBuffer        *prometheus.GaugeVec
+
+	// WHEP 指标
+	whepICEConnectTime   *prometheus.GaugeVec
+	whepTimeToFirstFrame *prometheus.GaugeVec
+	whepNACKCount        *prometheus.GaugeVec
+	whepPLICount         *prometheus.GaugeVec
+
+	// DASH 指标
+	dashAvailabilitySkew    *prometheus.GaugeVec
+	dashSegmentFetchLatency *prometheus.GaugeVec
+
+	// HTTP-TS 指标
+	tsContinuityErrors *prometheus.GaugeVec
+
+	// 视频参数指标（来自 SPS）
+	width      *prometheus.GaugeVec
+	height     *prometheus.GaugeVec
+	resolution *prometheus.GaugeVec
+	videoInfo  *prometheus.GaugeVec
+
+	// 音频指标
+	audioBitrate    *prometheus.GaugeVec
+	audioSampleRate *prometheus.GaugeVec
+	audioChannels   *prometheus.GaugeVec
+	audioInfo       *prometheus.GaugeVec
+
+	// 音画同步指标
+	avSyncDrift    *prometheus.GaugeVec
+	avSyncSlope    *prometheus.GaugeVec
+	avSyncExceeded *prometheus.GaugeVec
+
+	// 时间戳异常指标
+	timestampAnomalies *prometheus.GaugeVec
+
+	// 丢帧指标
+	nominalFramerate *prometheus.GaugeVec
+	droppedFrames    *prometheus.GaugeVec
+	frameLossRatio   *prometheus.GaugeVec
+
+	// onMetaData 指标
+	metadataInfo     *prometheus.GaugeVec
+	metadataMismatch *prometheus.GaugeVec
+
+	// 画面冻结指标
+	frozen        *prometheus.GaugeVec
+	frozenSeconds *prometheus.GaugeVec
+
+	// 实时性和卡顿指标
+	realtimeRatio *prometheus.GaugeVec
+	longestGap    *prometheus.GaugeVec
+	rebuffers     *prometheus.GaugeVec
+	stallSeconds  *prometheus.GaugeVec
+
+	// 起播耗时指标
+	startupDNS           *prometheus.GaugeVec
+	startupConnect       *prometheus.GaugeVec
+	startupTLS           *prometheus.GaugeVec
+	startupFirstByte     *prometheus.GaugeVec
+	startupFirstTag      *prometheus.GaugeVec
+	startupFirstVideo    *prometheus.GaugeVec
+	startupFirstKeyframe *prometheus.GaugeVec
+	startupSeconds       *prometheus.HistogramVec
+
+	// 端到端延迟指标
+	glassLatency *prometheus.GaugeVec
+
+	// 边缘节点指标
+	edgeInfo     *prometheus.GaugeVec
+	redirectHops *prometheus.GaugeVec
+
+	// TLS 证书指标
+	tlsCertExpiryDays *prometheus.GaugeVec
+	tlsHostMatch      *prometheus.GaugeVec
+	tlsInfo           *prometheus.GaugeVec
+
+	// 多边缘对比指标（只对配置了 edges 的流导出，不带 edge 标签）
+	edgesUp         *prometheus.GaugeVec
+	edgesConsistent *prometheus.GaugeVec
+
+	// 每个流最近一次计入直方图的检查时间，抓取时只观测新的检查结果
+	observedMu sync.Mutex
+	observed   map[string]time.Time
+
 	scheduler *scheduler.Scheduler
 	log       *slog.Logger
 }
@@ -44,13 +147,14 @@ func New(s *scheduler.Scheduler) *Exporter {
 	exporter := &Exporter{
 		scheduler: s,
 		log:       logger.Get(),
+		observed:  make(map[string]time.Time),
 
 		streamUp: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
 				Name: "video_stream_up",
 				Help: "Stream is up (1) or down (0)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		streamHealthy: prometheus.NewGaugeVec(
@@ -58,7 +162,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_healthy",
 				Help: "Stream health status (1=healthy, 0=unhealthy)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		streamPlayable: prometheus.NewGaugeVec(
@@ -66,7 +170,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_playable",
 				Help: "Stream is playable (1=yes, 0=no)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		totalPackets: prometheus.NewGaugeVec(
@@ -74,7 +178,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_total_packets",
 				Help: "Total packets received",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		videoPackets: prometheus.NewGaugeVec(
@@ -82,7 +186,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_video_packets",
 				Help: "Video packets received",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		audioPackets: prometheus.NewGaugeVec(
@@ -90,7 +194,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_audio_packets",
 				Help: "Audio packets received",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		keyframes: prometheus.NewGaugeVec(
@@ -98,7 +202,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_keyframes",
 				Help: "Keyframes received",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		currentBitrate: prometheus.NewGaugeVec(
@@ -106,7 +210,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_bitrate_bps",
 				Help: "Current stream bitrate in bits per second",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		avgBitrate: prometheus.NewGaugeVec(
@@ -114,7 +218,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_avg_bitrate_bps",
 				Help: "Average stream bitrate in bits per second",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		framerate: prometheus.NewGaugeVec(
@@ -122,7 +226,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_framerate",
 				Help: "Stream framerate in fps",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		responseTime: prometheus.NewGaugeVec(
@@ -130,7 +234,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_response_ms",
 				Help: "FLV HTTP request response time in milliseconds",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		gopSize: prometheus.NewGaugeVec(
@@ -138,7 +242,23 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_gop_size",
 				Help: "GOP size in frames",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		keyframeInterval: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_keyframe_interval_seconds",
+				Help: "Keyframe interval measured from keyframe DTS in seconds (stat: min, avg, max)",
+			},
+			[]string{"project", "id", "name", "url", "edge", "stat"},
+		),
+
+		gopCV: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_gop_duration_cv",
+				Help: "Coefficient of variation of keyframe intervals (stddev / mean)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		qualityScore: prometheus.NewGaugeVec(
@@ -146,7 +266,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_quality_score",
 				Help: "Stream quality score (0=poor, 1=fair, 2=good)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		stabilityScore: prometheus.NewGaugeVec(
@@ -154,7 +274,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_stability_score",
 				Help: "Bitrate stability score (0=unstable, 1=moderate, 2=stable)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		// 网络稳定性指标
@@ -163,7 +283,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_rtt_ms",
 				Help: "Round-trip time in milliseconds",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		packetLossRatio: prometheus.NewGaugeVec(
@@ -171,7 +291,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_packet_loss_ratio",
 				Help: "Packet loss ratio (0.0-1.0)",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		networkJitter: prometheus.NewGaugeVec(
@@ -179,7 +299,7 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_network_jitter_ms",
 				Help: "Network jitter in milliseconds",
 			},
-			[]string{"project", "id", "name", "url"},
+			[]string{"project", "id", "name", "url", "edge"},
 		),
 
 		reconnectCount: prometheus.NewGaugeVec(
@@ -187,16 +307,469 @@ func New(s *scheduler.Scheduler) *Exporter {
 				Name: "video_stream_reconnect_count",
 				Help: "Number of reconnections in current check cycle",
 			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// HLS 指标
+		hlsPlaylistStaleness: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_hls_playlist_staleness_seconds",
+				Help: "Seconds since the HLS media playlist last advanced",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		hlsTargetDurationDrift: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_hls_target_duration_drift_seconds",
+				Help: "Longest segment EXTINF minus EXT-X-TARGETDURATION in seconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		hlsMediaSequenceGaps: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_hls_media_sequence_gaps",
+				Help: "Number of HLS segments skipped between playlist reloads in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// RTMP 指标
+		rtmpHandshakeTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_rtmp_handshake_ms",
+				Help: "RTMP handshake time in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		rtmpConnectToFirstVideo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_rtmp_connect_to_first_video_ms",
+				Help: "Time from RTMP connect command to first video packet in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// SRT 指标
+		srtRTT: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_srt_rtt_ms",
+				Help: "SRT link round-trip time in milliseconds (smoothed, from ACK/ACKACK)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		srtRetransmittedPackets: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_srt_retransmitted_packets",
+				Help: "Number of retransmitted SRT packets received in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		srtDroppedPackets: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_srt_dropped_packets",
+				Help: "Number of SRT packets dropped as too late in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		srtReceiveBuffer: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_srt_receive_buffer_ms",
+				Help: "Average SRT receive buffer level in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// WHEP 指标
+		whepICEConnectTime: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_whep_ice_connect_ms",
+				Help: "Time from applying the WHEP answer to ICE connected in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		whepTimeToFirstFrame: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_whep_time_to_first_frame_ms",
+				Help: "Time from sending the WHEP offer to the first complete video frame in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		whepNACKCount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_whep_nack_count",
+				Help: "Number of RTCP NACK packets sent in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		whepPLICount: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_whep_pli_count",
+				Help: "Number of RTCP PLI packets sent in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// DASH 指标
+		dashAvailabilitySkew: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_dash_availability_skew_seconds",
+				Help: "Wall-clock media time derived from availabilityStartTime minus the end of the newest fetched segment in seconds (dynamic MPD only)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		dashSegmentFetchLatency: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_dash_segment_fetch_latency_ms",
+				Help: "Average DASH media segment download time in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// HTTP-TS 指标
+		tsContinuityErrors: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_ts_continuity_errors",
+				Help: "Number of MPEG-TS continuity counter errors per PID in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge", "pid"},
+		),
+
+		// 视频参数指标
+		width: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_width_pixels",
+				Help: "Video width in pixels parsed from SPS (0 if unknown)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		height: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_height_pixels",
+				Help: "Video height in pixels parsed from SPS (0 if unknown)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		resolution: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_resolution_pixels",
+				Help: "Video resolution in pixels (width * height)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		videoInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_video_info",
+				Help: "Video parameters parsed from SPS, value is always 1",
+			},
+			[]string{"project", "id", "name", "url", "edge", "codec", "profile", "level", "chroma_format", "bit_depth", "width", "height"},
+		),
+
+		// 音频指标
+		audioBitrate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_audio_bitrate_bps",
+				Help: "Audio bitrate in bits per second",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		audioSampleRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_audio_sample_rate_hz",
+				Help: "Audio sample rate in Hz (0 if unknown)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		audioChannels: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_audio_channels",
+				Help: "Number of audio channels (0 if unknown)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		audioInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_audio_info",
+				Help: "Audio parameters, value is always 1",
+			},
+			[]string{"project", "id", "name", "url", "edge", "codec", "sample_rate", "channels"},
+		),
+
+		// 音画同步指标
+		avSyncDrift: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_av_sync_drift_ms",
+				Help: "Audio minus video timestamp offset at the end of the sample window in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		avSyncSlope: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_av_sync_drift_slope_ms_per_minute",
+				Help: "Rate of change of the audio/video offset in milliseconds per minute",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		avSyncExceeded: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_av_sync_exceeded",
+				Help: "Audio/video offset exceeds the configured threshold (1=yes, 0=no)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// 时间戳异常指标
+		timestampAnomalies: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_timestamp_anomalies",
+				Help: "Number of timestamp anomalies by type in current check (dts_regression, dts_jump, pts_before_dts, wraparound)",
+			},
+			[]string{"project", "id", "name", "url", "edge", "type"},
+		),
+
+		// 丢帧指标
+		nominalFramerate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_nominal_framerate",
+				Help: "Nominal frame rate from onMetaData, SPS VUI or median frame interval",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		droppedFrames: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_dropped_frames",
+				Help: "Estimated number of dropped video frames in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		frameLossRatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_frame_loss_ratio",
+				Help: "Estimated video frame loss ratio (0.0-1.0)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// onMetaData 指标
+		metadataInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_metadata_info",
+				Help: "Encoder parameters declared in onMetaData, value is always 1",
+			},
+			[]string{"project", "id", "name", "url", "edge", "encoder", "width", "height", "framerate", "videodatarate", "audiodatarate"},
+		),
+
+		metadataMismatch: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_metadata_mismatch",
+				Help: "Declared onMetaData value differs from the measured one beyond the threshold (1=yes, 0=no)",
+			},
+			[]string{"project", "id", "name", "url", "edge", "field"},
+		),
+
+		// 画面冻结指标
+		frozen: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_frozen",
+				Help: "Picture is frozen (1=yes, 0=no), detected from video payload sizes and fingerprints",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		frozenSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_frozen_seconds",
+				Help: "Longest run of unchanged pictures in current check in seconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// 实时性和卡顿指标
+		realtimeRatio: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_realtime_ratio",
+				Help: "Media time advanced divided by wall-clock time (below 1 means slower than real time)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		longestGap: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_longest_gap_ms",
+				Help: "Longest gap between packet arrivals in current check in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		rebuffers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_rebuffer_events",
+				Help: "Number of rebuffer events of a simulated player in current check",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		stallSeconds: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_stall_seconds",
+				Help: "Total stall time of a simulated player in current check in seconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// 起播耗时指标
+
+		startupDNS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_dns_ms",
+				Help: "DNS lookup time of the first HTTP request in milliseconds (0 if unknown or reused connection)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupConnect: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_connect_ms",
+				Help: "TCP connect time of the first HTTP request in milliseconds (0 if unknown or reused connection)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupTLS: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_tls_ms",
+				Help: "TLS handshake time of the first HTTPS request in milliseconds (0 if unknown or not TLS)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupFirstByte: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_first_byte_ms",
+				Help: "Time from connection start to the first response byte in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupFirstTag: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_first_tag_ms",
+				Help: "Time from connection start to the first demuxed packet (first FLV tag) in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupFirstVideo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_first_video_ms",
+				Help: "Time from connection start to the first video packet in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupFirstKeyframe: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_startup_first_keyframe_ms",
+				Help: "Time from connection start to the first keyframe (first frame) in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		startupSeconds: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "video_stream_startup_seconds",
+				Help:    "Distribution of startup latency per project by phase (first_byte, first_video, first_keyframe)",
+				Buckets: []float64{0.1, 0.25, 0.5, 1, 2, 3, 5, 10},
+			},
+			[]string{"project", "phase"},
+		),
+
+		// 端到端延迟指标
+		glassLatency: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_glass_latency_ms",
+				Help: "Average ingest-to-edge latency from wall-clock timestamps embedded in SEI or onTextData/onFI in milliseconds",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// 边缘节点指标
+		edgeInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_edge_info",
+				Help: "Edge node that served the stream after redirects (always 1)",
+			},
+			[]string{"project", "id", "name", "url", "edge", "host", "ip", "server", "via", "x_cache"},
+		),
+
+		redirectHops: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_redirect_hops",
+				Help: "Number of HTTP redirects before the stream was served",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		// TLS 证书指标
+		tlsCertExpiryDays: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_tls_cert_expiry_days",
+				Help: "Days until the earliest expiry in the server certificate chain (negative when expired)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		tlsHostMatch: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_tls_host_match",
+				Help: "Server certificate SAN matches the requested host (1) or not (0)",
+			},
+			[]string{"project", "id", "name", "url", "edge"},
+		),
+
+		tlsInfo: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_tls_info",
+				Help: "Negotiated TLS version, cipher suite and certificate issuer (always 1)",
+			},
+			[]string{"project", "id", "name", "url", "edge", "version", "cipher", "issuer"},
+		),
+
+		// 多边缘对比指标
+		edgesUp: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_edges_up",
+				Help: "Number of edges (CDNs or edge IPs) of the stream that are up",
+			},
 			[]string{"project", "id", "name", "url"},
 		),
 
-		// resolution: prometheus.NewGaugeVec(
-		// 	prometheus.GaugeOpts{
-		// 		Name: "video_stream_resolution_pixels",
-		// 		Help: "Video resolution in pixels (width * height)",
-		// 	},
-		// 	[]string{"project", "id", "url", "width", "height"},
-		// ),
+		edgesConsistent: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "video_stream_edges_consistent",
+				Help: "All edges of the stream agree on being up or down (1) or disagree (0)",
+			},
+			[]string{"project", "id", "name", "url"},
+		),
 	}
 
 	// 注册指标
@@ -213,6 +786,8 @@ func New(s *scheduler.Scheduler) *Exporter {
 		exporter.framerate,
 		exporter.responseTime,
 		exporter.gopSize,
+		exporter.keyframeInterval,
+		exporter.gopCV,
 		exporter.qualityScore,
 		exporter.stabilityScore,
 		// 网络稳定性指标
@@ -220,7 +795,69 @@ func New(s *scheduler.Scheduler) *Exporter {
 		exporter.packetLossRatio,
 		exporter.networkJitter,
 		exporter.reconnectCount,
-		// exporter.resolution,
+		// HLS 指标
+		exporter.hlsPlaylistStaleness,
+		exporter.hlsTargetDurationDrift,
+		exporter.hlsMediaSequenceGaps,
+		// RTMP 指标
+		exporter.rtmpHandshakeTime,
+		exporter.rtmpConnectToFirstVideo,
+		// SRT 指标
+		exporter.srtRTT,
+		exporter.srtRetransmittedPackets,
+		exporter.srtDroppedPackets,
+		exporter.srtReceiveBuffer,
+		// WHEP 指标
+		exporter.whepICEConnectTime,
+		exporter.whepTimeToFirstFrame,
+		exporter.whepNACKCount,
+		exporter.whepPLICount,
+		// DASH 指标
+		exporter.dashAvailabilitySkew,
+		exporter.dashSegmentFetchLatency,
+		// HTTP-TS 指标
+		exporter.tsContinuityErrors,
+		// 视频参数指标
+		exporter.width,
+		exporter.height,
+		exporter.resolution,
+		exporter.videoInfo,
+		// 音频指标
+		exporter.audioBitrate,
+		exporter.audioSampleRate,
+		exporter.audioChannels,
+		exporter.audioInfo,
+		exporter.avSyncDrift,
+		exporter.avSyncSlope,
+		exporter.avSyncExceeded,
+		exporter.timestampAnomalies,
+		exporter.nominalFramerate,
+		exporter.droppedFrames,
+		exporter.frameLossRatio,
+		exporter.metadataInfo,
+		exporter.metadataMismatch,
+		exporter.frozen,
+		exporter.frozenSeconds,
+		exporter.realtimeRatio,
+		exporter.longestGap,
+		exporter.rebuffers,
+		exporter.stallSeconds,
+		exporter.startupDNS,
+		exporter.startupConnect,
+		exporter.startupTLS,
+		exporter.startupFirstByte,
+		exporter.startupFirstTag,
+		exporter.startupFirstVideo,
+		exporter.startupFirstKeyframe,
+		exporter.startupSeconds,
+		exporter.glassLatency,
+		exporter.edgeInfo,
+		exporter.redirectHops,
+		exporter.tlsCertExpiryDays,
+		exporter.tlsHostMatch,
+		exporter.tlsInfo,
+		exporter.edgesUp,
+		exporter.edgesConsistent,
 	)
 
 	return exporter
@@ -233,7 +870,7 @@ func (e *Exporter) UpdateMetrics() {
 	e.log.Debug("获取到指标", "数量", len(metrics))
 
 	for _, m := range metrics {
-		labels := []string{m.Project, m.ID, m.Name, m.URL}
+		labels := []string{m.Project, m.ID, m.Name, m.URL, m.Edge}
 
 		// 流状态
 		upValue := 0.0
@@ -271,6 +908,20 @@ func (e *Exporter) UpdateMetrics() {
 		e.responseTime.WithLabelValues(labels...).Set(float64(m.Response))
 		e.gopSize.WithLabelValues(labels...).Set(float64(m.GOPSize))
 
+		// 关键帧间隔（每种统计值一条序列）
+		for _, interval := range []struct {
+			stat    string
+			seconds float64
+		}{
+			{"min", m.KeyframeIntervalMin},
+			{"avg", m.KeyframeIntervalAvg},
+			{"max", m.KeyframeIntervalMax},
+		} {
+			intervalLabels := append(append([]string{}, labels...), interval.stat)
+			e.keyframeInterval.WithLabelValues(intervalLabels...).Set(interval.seconds)
+		}
+		e.gopCV.WithLabelValues(labels...).Set(m.GOPCV)
+
 		// 质量评分
 		qualityScore := 0.0
 		switch m.Quality {
@@ -303,17 +954,257 @@ func (e *Exporter) UpdateMetrics() {
 		// 重连次数（Gauge类型，直接设置本周期内的重连次数）
 		e.reconnectCount.WithLabelValues(labels...).Set(float64(m.ReconnectCount))
 
-		// 分辨率 - 暂时注释掉
-		// if m.Width > 0 && m.Height > 0 {
-		// 	resLabels := append(labels, fmt.Sprintf("%d", m.Width), fmt.Sprintf("%d", m.Height))
-		// 	pixels := float64(m.Width * m.Height)
-		// 	e.resolution.WithLabelValues(resLabels...).Set(pixels)
-		// }
+		// HLS 指标（只对 HLS 流导出）
+		if m.Protocol == stream.ProtocolHLS {
+			e.hlsPlaylistStaleness.WithLabelValues(labels...).Set(m.HLSPlaylistStaleness)
+			e.hlsTargetDurationDrift.WithLabelValues(labels...).Set(m.HLSTargetDurationDrift)
+			e.hlsMediaSequenceGaps.WithLabelValues(labels...).Set(float64(m.HLSMediaSequenceGaps))
+		}
+
+		// RTMP 指标（只对 RTMP 流导出）
+		if m.Protocol == stream.ProtocolRTMP {
+			e.rtmpHandshakeTime.WithLabelValues(labels...).Set(float64(m.RTMPHandshakeTime))
+			e.rtmpConnectToFirstVideo.WithLabelValues(labels...).Set(float64(m.RTMPConnectToFirstVideo))
+		}
+
+		// SRT 指标（只对 SRT 流导出）
+		if m.Protocol == stream.ProtocolSRT {
+			e.srtRTT.WithLabelValues(labels...).Set(m.SRTRTT)
+			e.srtRetransmittedPackets.WithLabelValues(labels...).Set(float64(m.SRTRetransmittedPackets))
+			e.srtDroppedPackets.WithLabelValues(labels...).Set(float64(m.SRTDroppedPackets))
+			e.srtReceiveBuffer.WithLabelValues(labels...).Set(m.SRTReceiveBuffer)
+		}
+
+		// WHEP 指标（只对 WHEP 流导出）
+		if m.Protocol == stream.ProtocolWHEP {
+			e.whepICEConnectTime.WithLabelValues(labels...).Set(float64(m.WHEPICEConnectTime))
+			e.whepTimeToFirstFrame.WithLabelValues(labels...).Set(float64(m.WHEPTimeToFirstFrame))
+			e.whepNACKCount.WithLabelValues(labels...).Set(float64(m.WHEPNACKCount))
+			e.whepPLICount.WithLabelValues(labels...).Set(float64(m.WHEPPLICount))
+		}
+
+		// DASH 指标（只对 DASH 流导出）
+		if m.Protocol == stream.ProtocolDASH {
+			e.dashAvailabilitySkew.WithLabelValues(labels...).Set(m.DASHAvailabilitySkew)
+			e.dashSegmentFetchLatency.WithLabelValues(labels...).Set(m.DASHSegmentFetchLatency)
+		}
+
+		// HTTP-TS 指标（只对 HTTP-TS 流导出，每个 PID 一个序列），先删除旧序列，避免消失的 PID 一直保留
+		e.tsContinuityErrors.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.Protocol == stream.ProtocolTS {
+			for pid, n := range m.TSContinuityErrors {
+				pidLabels := append(append([]string{}, labels...), fmt.Sprintf("0x%04x", pid))
+				e.tsContinuityErrors.WithLabelValues(pidLabels...).Set(float64(n))
+			}
+		}
+
+		// 分辨率（未解析到 SPS 时为 0）
+		e.width.WithLabelValues(labels...).Set(float64(m.Width))
+		e.height.WithLabelValues(labels...).Set(float64(m.Height))
+		e.resolution.WithLabelValues(labels...).Set(float64(m.Width * m.Height))
+
+		// 视频参数信息，参数变化时先删除旧序列，保证每个流只有一条
+		e.videoInfo.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.Width > 0 && m.Height > 0 {
+			infoLabels := append(append([]string{}, labels...),
+				m.Codec, m.VideoProfile, m.VideoLevel, m.ChromaFormat,
+				fmt.Sprintf("%d", m.BitDepth), fmt.Sprintf("%d", m.Width), fmt.Sprintf("%d", m.Height))
+			e.videoInfo.WithLabelValues(infoLabels...).Set(1)
+		}
+
+		// 音频指标（与视频分开，没有音频时为 0）
+		e.audioBitrate.WithLabelValues(labels...).Set(m.AudioBitrate)
+		e.audioSampleRate.WithLabelValues(labels...).Set(float64(m.AudioSampleRate))
+		e.audioChannels.WithLabelValues(labels...).Set(float64(m.AudioChannels))
+
+		// 音频参数信息，参数变化时先删除旧序列，保证每个流只有一条
+		e.audioInfo.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.AudioCodec != "" {
+			audioLabels := append(append([]string{}, labels...),
+				m.AudioCodec, fmt.Sprintf("%d", m.AudioSampleRate), fmt.Sprintf("%d", m.AudioChannels))
+			e.audioInfo.WithLabelValues(audioLabels...).Set(1)
+		}
+
+		// 音画同步指标
+		e.avSyncDrift.WithLabelValues(labels...).Set(m.AVSyncDrift)
+		e.avSyncSlope.WithLabelValues(labels...).Set(m.AVSyncSlope)
+		avSyncExceededValue := 0.0
+		if m.AVSyncExceeded {
+			avSyncExceededValue = 1.0
+		}
+		e.avSyncExceeded.WithLabelValues(labels...).Set(avSyncExceededValue)
+
+		// 时间戳异常指标（每种类型一条序列）
+		for _, anomaly := range []struct {
+			kind  string
+			count int64
+		}{
+			{"dts_regression", m.DTSRegressions},
+			{"dts_jump", m.DTSJumps},
+			{"pts_before_dts", m.PTSBeforeDTS},
+			{"wraparound", m.TimestampWraps},
+		} {
+			anomalyLabels := append(append([]string{}, labels...), anomaly.kind)
+			e.timestampAnomalies.WithLabelValues(anomalyLabels...).Set(float64(anomaly.count))
+		}
+
+		// 丢帧指标
+		e.nominalFramerate.WithLabelValues(labels...).Set(m.NominalFramerate)
+		e.droppedFrames.WithLabelValues(labels...).Set(float64(m.DroppedFrames))
+		e.frameLossRatio.WithLabelValues(labels...).Set(m.FrameLossRatio)
+
+		// onMetaData 声明值，参数变化时先删除旧序列，保证每个流只有一条
+		e.metadataInfo.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.HasMetadata {
+			metadataLabels := append(append([]string{}, labels...),
+				m.MetadataEncoder,
+				fmt.Sprintf("%d", m.MetadataWidth),
+				fmt.Sprintf("%d", m.MetadataHeight),
+				strconv.FormatFloat(m.MetadataFramerate, 'f', -1, 64),
+				strconv.FormatFloat(m.MetadataVideoDataRate, 'f', -1, 64),
+				strconv.FormatFloat(m.MetadataAudioDataRate, 'f', -1, 64))
+			e.metadataInfo.WithLabelValues(metadataLabels...).Set(1)
+		}
+
+		// 声明值与实测值不符
+		for _, mismatch := range []struct {
+			field string
+			value bool
+		}{
+			{"bitrate", m.BitrateMismatch},
+			{"framerate", m.FramerateMismatch},
+		} {
+			mismatchValue := 0.0
+			if mismatch.value {
+				mismatchValue = 1.0
+			}
+			e.metadataMismatch.WithLabelValues(append(append([]string{}, labels...), mismatch.field)...).Set(mismatchValue)
+		}
+
+		// 画面冻结指标
+		frozenValue := 0.0
+		if m.Frozen {
+			frozenValue = 1.0
+		}
+		e.frozen.WithLabelValues(labels...).Set(frozenValue)
+		e.frozenSeconds.WithLabelValues(labels...).Set(m.FrozenSeconds)
+
+		// 实时性和卡顿指标
+		e.realtimeRatio.WithLabelValues(labels...).Set(m.RealtimeRatio)
+		e.longestGap.WithLabelValues(labels...).Set(float64(m.LongestGap))
+		e.rebuffers.WithLabelValues(labels...).Set(float64(m.Rebuffers))
+		e.stallSeconds.WithLabelValues(labels...).Set(m.StallSeconds)
+
+		// 起播耗时指标
+		e.startupDNS.WithLabelValues(labels...).Set(m.DNSTime)
+		e.startupConnect.WithLabelValues(labels...).Set(m.ConnectTime)
+		e.startupTLS.WithLabelValues(labels...).Set(m.TLSTime)
+		e.startupFirstByte.WithLabelValues(labels...).Set(m.TimeToFirstByte)
+		e.startupFirstTag.WithLabelValues(labels...).Set(m.TimeToFirstTag)
+		e.startupFirstVideo.WithLabelValues(labels...).Set(m.TimeToFirstVideo)
+		e.startupFirstKeyframe.WithLabelValues(labels...).Set(m.TimeToFirstKeyframe)
+		e.observeStartup(m)
+
+		// 端到端延迟，没有找到嵌入时间时删除序列，避免与 0 延迟混淆
+		e.glassLatency.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.HasGlassLatency {
+			e.glassLatency.WithLabelValues(labels...).Set(m.GlassLatency)
+		}
+
+		// 边缘节点信息，节点变化时先删除旧序列，保证每个流只有一条
+		e.edgeInfo.DeletePartialMatch(prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge})
+		if m.EdgeHost != "" {
+			edgeLabels := append(append([]string{}, labels...),
+				m.EdgeHost, m.EdgeIP, m.EdgeServer, m.EdgeVia, m.EdgeCache)
+			e.edgeInfo.WithLabelValues(edgeLabels...).Set(1)
+		}
+		e.redirectHops.WithLabelValues(labels...).Set(float64(m.RedirectHops))
+
+		// TLS 证书，剩余天数按抓取时间计算；非 HTTPS 或未取得证书时删除序列
+		streamLabels := prometheus.Labels{"project": m.Project, "id": m.ID, "name": m.Name, "url": m.URL, "edge": m.Edge}
+		e.tlsCertExpiryDays.DeletePartialMatch(streamLabels)
+		e.tlsHostMatch.DeletePartialMatch(streamLabels)
+		e.tlsInfo.DeletePartialMatch(streamLabels)
+		if m.HasTLS {
+			hostMatch := 0.0
+			if m.TLSHostMatch {
+				hostMatch = 1.0
+			}
+			e.tlsCertExpiryDays.WithLabelValues(labels...).Set(time.Until(m.TLSCertNotAfter).Hours() / 24)
+			e.tlsHostMatch.WithLabelValues(labels...).Set(hostMatch)
+			tlsLabels := append(append([]string{}, labels...), m.TLSVersion, m.TLSCipher, m.TLSIssuer)
+			e.tlsInfo.WithLabelValues(tlsLabels...).Set(1)
+		}
 	}
+	e.updateEdges(metrics)
 
 	e.log.Debug("指标更新完成")
 }
 
+// updateEdges 汇总配置了多个边缘的流：可用的边缘数量，以及所有边缘是否同时可用或同时不可用
+func (e *Exporter) updateEdges(metrics []stream.Metrics) {
+	type edgeGroup struct {
+		labels    []string
+		total, up int
+	}
+	groups := make(map[string]*edgeGroup)
+	for _, m := range metrics {
+		if m.Edge == "" {
+			continue
+		}
+		key := m.Project + "/" + m.ID + "/" + m.URL
+		g, ok := groups[key]
+		if !ok {
+			g = &edgeGroup{labels: []string{m.Project, m.ID, m.Name, m.URL}}
+			groups[key] = g
+		}
+		g.total++
+		if m.Healthy {
+			g.up++
+		}
+	}
+
+	for _, g := range groups {
+		consistent := 0.0
+		if g.up == 0 || g.up == g.total {
+			consistent = 1.0
+		}
+		e.edgesUp.WithLabelValues(g.labels...).Set(float64(g.up))
+		e.edgesConsistent.WithLabelValues(g.labels...).Set(consistent)
+	}
+}
+
+// observeStartup 把一次成功检查的起播耗时计入按项目统计的直方图。
+// 指标在每次抓取时更新，同一次检查的结果只观测一次
+func (e *Exporter) observeStartup(m stream.Metrics) {
+	if !m.Healthy || m.LastCheckTime.IsZero() {
+		return
+	}
+
+	key := m.Project + "/" + m.ID + "/" + m.Edge
+	e.observedMu.Lock()
+	if !m.LastCheckTime.After(e.observed[key]) {
+		e.observedMu.Unlock()
+		return
+	}
+	e.observed[key] = m.LastCheckTime
+	e.observedMu.Unlock()
+
+	phases := []struct {
+		phase string
+		ms    float64
+	}{
+		{"first_byte", m.TimeToFirstByte},
+		{"first_video", m.TimeToFirstVideo},
+		{"first_keyframe", m.TimeToFirstKeyframe},
+	}
+	for _, p := range phases {
+		if p.ms > 0 {
+			e.startupSeconds.WithLabelValues(m.Project, p.phase).Observe(p.ms / 1000)
+		}
+	}
+}
+
 // StartHTTPServer 启动 HTTP 服务器
 func (e *Exporter) StartHTTPServer(addr string) error {
 	mux := http.NewServeMux()
@@ -13,7 +13,7 @@ import (
 
 // Scheduler 调度器
 type Scheduler struct {
-	checkers map[string]*stream.Checker
+	checkers map[string][]*stream.Checker // 每个流的检查器，配置了 edges 时每个边缘一个
 	config   *config.Config
 	mu       sync.RWMutex
 	stopChan chan struct{}
@@ -23,7 +23,7 @@ type Scheduler struct {
 // New 创建调度器
 func New(cfg *config.Config) *Scheduler {
 	return &Scheduler{
-		checkers: make(map[string]*stream.Checker),
+		checkers: make(map[string][]*stream.Checker),
 		config:   cfg,
 		stopChan: make(chan struct{}),
 		log:      logger.Get(),
@@ -31,15 +31,15 @@ func New(cfg *config.Config) *Scheduler {
 }
 
 // AddStream 添加流
-func (s *Scheduler) AddStream(id, url, project string) {
+func (s *Scheduler) AddStream(cfg config.StreamConfig, project string) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	key := fmt.Sprintf("%s::%s", project, url)
-	checker := stream.NewChecker(id, url, project)
-	s.checkers[key] = checker
+	key := fmt.Sprintf("%s::%s", project, cfg.URL)
+	checkers := stream.NewCheckers(cfg, project)
+	s.checkers[key] = checkers
 
-	s.log.Info("添加流", "流ID", id, "URL", url, "项目", project)
+	s.log.Info("添加流", "流ID", cfg.ID, "URL", cfg.URL, "项目", project, "边缘数量", len(checkers))
 }
 
 // Start 启动调度器
@@ -71,35 +71,57 @@ func (s *Scheduler) Start() {
 // runCheckCycle 执行一轮检查
 func (s *Scheduler) runCheckCycle() {
 	s.mu.RLock()
-	checkers := make([]*stream.Checker, 0, len(s.checkers))
-	for _, checker := range s.checkers {
-		checkers = append(checkers, checker)
+	groups := make([][]*stream.Checker, 0, len(s.checkers))
+	for _, checkers := range s.checkers {
+		groups = append(groups, checkers)
 	}
 	s.mu.RUnlock()
 
-	s.log.Info("开始检查周期", "流数量", len(checkers))
+	s.log.Info("开始检查周期", "流数量", len(groups))
 
 	// 重置所有流的周期指标（重连次数等）
-	for _, checker := range checkers {
-		checker.ResetCycleMetrics()
+	for _, checkers := range groups {
+		for _, checker := range checkers {
+			checker.ResetCycleMetrics()
+		}
 	}
 
-	// 使用信号量控制并发
-	semaphore := make(chan struct{}, s.config.Exporter.MaxConcurrent)
+	// 使用信号量控制并发，每个检查（包括同一路流的每个边缘）占用一个名额
+	maxConcurrent := s.config.Exporter.MaxConcurrent
+	semaphore := make(chan struct{}, maxConcurrent)
+	var acquireMu sync.Mutex
 	var wg sync.WaitGroup
 
-	for _, checker := range checkers {
+	for _, checkers := range groups {
 		wg.Add(1)
-		go func(c *stream.Checker) {
+		go func(cs []*stream.Checker) {
 			defer wg.Done()
 
-			// 获取信号量
-			semaphore <- struct{}{}
-			defer func() { <-semaphore }()
+			// 同一路流的所有边缘一次性获取名额后同时检查，保证对比的是同一时刻的状态。
+			// 获取过程加锁，避免多路流各自拿到部分名额后互相等待；边缘数超过 max_concurrent 时最多占满全部名额
+			n := min(len(cs), maxConcurrent)
+			acquireMu.Lock()
+			for range n {
+				semaphore <- struct{}{}
+			}
+			acquireMu.Unlock()
+			defer func() {
+				for range n {
+					<-semaphore
+				}
+			}()
 
 			// 执行检查，带重试
-			s.checkWithRetry(c)
-		}(checker)
+			var edges sync.WaitGroup
+			for _, c := range cs {
+				edges.Add(1)
+				go func(c *stream.Checker) {
+					defer edges.Done()
+					s.checkWithRetry(c)
+				}(c)
+			}
+			edges.Wait()
+		}(checkers)
 	}
 
 	wg.Wait()
@@ -116,12 +138,17 @@ func (s *Scheduler) checkWithRetry(checker *stream.Checker) {
 		timeout = time.Duration(s.config.Exporter.CheckInterval-5) * time.Second
 	}
 
+	log := s.log.With("流ID", checker.ID())
+	if edge := checker.Edge(); edge != "" {
+		log = log.With("边缘", edge)
+	}
+
 	var lastErr error
 	for attempt := 0; attempt <= s.config.Exporter.MaxRetries; attempt++ {
 		if attempt > 0 {
 			// 重试前等待
 			retryDelay := time.Duration(attempt*2) * time.Second
-			s.log.Info("等待重试", "流ID", checker.ID(), "尝试次数", attempt, "延迟秒", retryDelay.Seconds())
+			log.Info("等待重试", "尝试次数", attempt, "延迟秒", retryDelay.Seconds())
 			time.Sleep(retryDelay)
 		}
 
@@ -132,12 +159,12 @@ func (s *Scheduler) checkWithRetry(checker *stream.Checker) {
 		}
 
 		lastErr = err
-		s.log.Error("检查失败", "流ID", checker.ID(), "尝试次数", attempt+1, "错误", err)
+		log.Error("检查失败", "尝试次数", attempt+1, "错误", err)
 	}
 
 	// 所有重试都失败
 	checker.MarkFailed()
-	s.log.Error("达到最大重试次数", "流ID", checker.ID(), "最后错误", lastErr)
+	log.Error("达到最大重试次数", "最后错误", lastErr)
 }
 
 // Stop 停止调度器
@@ -151,8 +178,10 @@ func (s *Scheduler) GetAllMetrics() []stream.Metrics {
 	defer s.mu.RUnlock()
 
 	metrics := make([]stream.Metrics, 0, len(s.checkers))
-	for _, checker := range s.checkers {
-		metrics = append(metrics, checker.GetMetrics())
+	for _, checkers := range s.checkers {
+		for _, checker := range checkers {
+			metrics = append(metrics, checker.GetMetrics())
+		}
 	}
 
 	return metrics
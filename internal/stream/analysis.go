@@ -0,0 +1,500 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"time"
+)
+
+// sampleConfig 采样参数
+type sampleConfig struct {
+	duration      time.Duration // 采样时长
+	minKeyframes  int           // 达到采样时长后，收集到足够关键帧即结束
+	maxBytes      int64         // 最大采样字节数，0 表示不限制
+	jumpGap       time.Duration // DTS 前跳超过该值视为跳变
+	startupBuffer time.Duration // 模拟播放器的起播缓冲时长
+	latency       latencyProbe  // 嵌入时间戳的位置，未配置时不测量
+}
+
+// timestampWrapPeriods 时间戳回绕周期：FLV / RTMP 为 32 位毫秒，MPEG-TS 为 33 位 90kHz
+var timestampWrapPeriods = [...]time.Duration{
+	(1 << 32) * time.Millisecond,
+	(1 << 33) * time.Second / 90000,
+}
+
+// timestampAnomalies 时间戳异常计数
+type timestampAnomalies struct {
+	regressions  int64 // DTS 回退
+	jumps        int64 // DTS 前跳超过阈值
+	ptsBeforeDTS int64 // PTS < DTS
+	wraps        int64 // 时间戳回绕
+}
+
+// dtsTrack 单个轨道的 DTS 连续性检查状态
+type dtsTrack struct {
+	seen   bool
+	last   time.Duration // 上一个包展开后的 DTS
+	offset time.Duration // 回绕累计偏移
+}
+
+// check 检查并展开一个 DTS，回绕后的时间戳加上周期，使后续计算不受影响。
+// ptsOnly 为 true 时时间戳是显示时间戳，B 帧重排造成的回退不计为 DTS 回退，
+// 前跳按已见过的最大时间戳计算
+func (t *dtsTrack) check(dts, jumpGap time.Duration, ptsOnly bool, anomalies *timestampAnomalies) time.Duration {
+	dts += t.offset
+	if !t.seen {
+		t.seen = true
+		t.last = dts
+		return dts
+	}
+
+	if delta := dts - t.last; delta < 0 {
+		// 加上一个回绕周期后变成正常前进，视为回绕而不是回退
+		wrapped := false
+		for _, period := range timestampWrapPeriods {
+			if d := delta + period; d >= 0 && d <= jumpGap {
+				t.offset += period
+				dts += period
+				anomalies.wraps++
+				wrapped = true
+				break
+			}
+		}
+		if !wrapped {
+			if ptsOnly {
+				return dts
+			}
+			anomalies.regressions++
+		}
+	} else if jumpGap > 0 && delta > jumpGap {
+		anomalies.jumps++
+	}
+	t.last = dts
+	return dts
+}
+
+// keyframePos 关键帧在采样中的位置
+type keyframePos struct {
+	index int           // 视频帧序号（从 0 开始）
+	dts   time.Duration // 展开后的 DTS
+}
+
+// analyzer 通用采样统计，所有协议输出的 Packet 共用同一套计算
+type analyzer struct {
+	packets   int // 总包数
+	video     int // 视频包数
+	audio     int // 音频包数
+	keyframes int // 关键帧数
+	bytes     int64
+	codec     string // 第一个视频包的编码
+
+	hasMetadata bool
+
+	// onMetaData 中声明的编码参数，取第一个解析成功的
+	metadataInfo    metadataInfo
+	hasMetadataInfo bool
+
+	// 从 SPS 解析出的分辨率、profile 等，取第一个解析成功的 SPS
+	videoInfo    videoInfo
+	hasVideoInfo bool
+
+	// 音频统计
+	audioCodec    string // 第一个音频包的编码
+	audioInfo     audioInfo
+	hasAudioInfo  bool
+	audioBytes    int64
+	firstAudioDTS time.Duration
+	lastAudioDTS  time.Duration
+
+	// 音画同步：每个视频包到达时，最近一个音频包与该视频帧的时间戳差
+	avOffsets []avOffset
+
+	// 时间戳异常检测
+	jumpGap    time.Duration
+	videoTrack dtsTrack
+	audioTrack dtsTrack
+	anomalies  timestampAnomalies
+
+	// 每个关键帧的位置，用于按完整 GOP 计算帧数和时长
+	keyframePos []keyframePos
+
+	// 画面冻结检测
+	freeze freezeDetector
+
+	// 端到端延迟：编码端嵌入的系统时间
+	latency latencyProbe
+
+	// 实时性：包到达间隔和模拟播放器（有视频时按视频，否则按音频）
+	lastArrival time.Time
+	longestGap  time.Duration
+	videoPlayer playerSim
+	audioPlayer playerSim
+
+	// 起播耗时：第一个数据包（任意类型，FLV 为第一个 tag）和第一个关键帧的到达时间
+	firstPacket   time.Time
+	firstKeyframe time.Time
+
+	// 用于帧率、码率计算
+	firstVideo time.Time     // 第一个视频包到达的系统时间（用于是否读到包的判定）
+	firstDTS   time.Duration // 第一个视频包的DTS
+	lastDTS    time.Duration // 最后一个视频包的DTS
+
+	// 用于网络稳定性计算
+	lastVideoArrival time.Time       // 上一个视频包到达时间
+	intervals        []float64       // 包间隔时间（用于计算抖动）
+	videoPTS         []time.Duration // 视频帧的显示时间戳，用于按帧率估算丢帧
+}
+
+// add 统计一个数据包，arrival 为包到达时间
+func (a *analyzer) add(pkt Packet, arrival time.Time) {
+	a.packets++
+	a.bytes += int64(len(pkt.Data))
+	if a.firstPacket.IsZero() {
+		a.firstPacket = arrival
+	}
+	// 回溯分片是一次性下载的，到达间隔不反映实时性
+	if !pkt.Backfill {
+		if !a.lastArrival.IsZero() {
+			a.longestGap = max(a.longestGap, arrival.Sub(a.lastArrival))
+		}
+		a.lastArrival = arrival
+	}
+
+	switch pkt.Kind {
+	case PacketMetadata:
+		a.hasMetadata = true
+		a.latency.addScript(pkt.Data, arrival)
+		if !a.hasMetadataInfo {
+			a.metadataInfo, a.hasMetadataInfo = parseMetadataInfo(pkt.Data)
+		}
+	case PacketConfig:
+		if !a.hasVideoInfo {
+			a.videoInfo, a.hasVideoInfo = parseVideoInfo(pkt.Codec, pkt.Data, true)
+		}
+		if !a.hasAudioInfo {
+			a.audioInfo, a.hasAudioInfo = parseAudioConfig(pkt.Codec, pkt.Data)
+		}
+	case PacketAudio:
+		pkt.DTS = a.audioTrack.check(pkt.DTS, a.jumpGap, pkt.PTSOnly, &a.anomalies)
+		if a.audio == 0 {
+			a.audioCodec = pkt.Codec
+			a.firstAudioDTS = pkt.DTS
+		}
+		a.audio++
+		a.audioBytes += int64(len(pkt.Data))
+		a.lastAudioDTS = pkt.DTS
+		if !pkt.Backfill {
+			a.audioPlayer.add(pkt.DTS, arrival)
+		}
+		// 没有单独的解码配置时（如 MP3），从帧头解析
+		if !a.hasAudioInfo {
+			a.audioInfo, a.hasAudioInfo = parseAudioFrame(pkt.Codec, pkt.Data)
+		}
+	case PacketVideo:
+		pkt.DTS = a.videoTrack.check(pkt.DTS, a.jumpGap, pkt.PTSOnly, &a.anomalies)
+		if pkt.CTS < 0 {
+			a.anomalies.ptsBeforeDTS++
+		}
+		a.video++
+		a.videoPTS = append(a.videoPTS, pkt.DTS+pkt.CTS)
+		a.freeze.add(pkt.Codec, pkt.Data, pkt.KeyFrame, pkt.DTS)
+		a.latency.addVideo(pkt.Codec, pkt.Data, arrival)
+		if !pkt.Backfill {
+			a.videoPlayer.add(pkt.DTS, arrival)
+		}
+		if pkt.KeyFrame {
+			if a.keyframes == 0 {
+				a.firstKeyframe = arrival
+			}
+			a.keyframes++
+			a.keyframePos = append(a.keyframePos, keyframePos{index: a.video - 1, dts: pkt.DTS})
+		}
+		if a.codec == "" {
+			a.codec = pkt.Codec
+		}
+		// 没有单独的解码配置时（如 MPEG-TS），从关键帧中携带的 SPS 解析
+		if !a.hasVideoInfo && pkt.KeyFrame {
+			a.videoInfo, a.hasVideoInfo = parseVideoInfo(pkt.Codec, pkt.Data, false)
+		}
+
+		// 记录时间戳和到达时间
+		if a.firstVideo.IsZero() {
+			a.firstVideo = arrival
+			a.firstDTS = pkt.DTS
+		} else {
+			// 计算包间隔时间（用于抖动计算）
+			interval := arrival.Sub(a.lastVideoArrival).Seconds() * 1000 // 转换为毫秒
+			if interval > 0 {
+				a.intervals = append(a.intervals, interval)
+			}
+		}
+		a.lastVideoArrival = arrival
+		a.lastDTS = pkt.DTS
+
+		// 收到过音频后才能比较，视频按显示时间（PTS）计算
+		if a.audio > 0 {
+			a.avOffsets = append(a.avOffsets, avOffset{
+				at:     (pkt.DTS - a.firstDTS).Seconds(),
+				offset: float64(a.lastAudioDTS-(pkt.DTS+pkt.CTS)) / float64(time.Millisecond),
+			})
+		}
+	}
+}
+
+// avOffset 一个音画时间戳差采样点
+type avOffset struct {
+	at     float64 // 视频 DTS 相对第一个视频包的时间（秒）
+	offset float64 // 音频时间戳 - 视频时间戳（毫秒）
+}
+
+// minAVOffsets 计算音画同步所需的最少采样点数
+const minAVOffsets = 10
+
+// avSync 对音画时间戳差做最小二乘线性拟合，返回采样结束时的偏差（毫秒，正数表示音频时间戳超前）
+// 和偏差变化斜率（毫秒/分钟）。单点的差值受音视频交织方式影响会有锯齿，拟合后可以消除
+func (a *analyzer) avSync() (drift, slope float64, ok bool) {
+	n := len(a.avOffsets)
+	if n < minAVOffsets {
+		return 0, 0, false
+	}
+
+	var sumX, sumY float64
+	for _, p := range a.avOffsets {
+		sumX += p.at
+		sumY += p.offset
+	}
+	meanX, meanY := sumX/float64(n), sumY/float64(n)
+
+	var sxx, sxy float64
+	for _, p := range a.avOffsets {
+		dx := p.at - meanX
+		sxx += dx * dx
+		sxy += dx * (p.offset - meanY)
+	}
+	// 视频时间戳没有跨度（如全部相同）时无法拟合
+	if sxx == 0 {
+		return 0, 0, false
+	}
+
+	b := sxy / sxx
+	last := a.avOffsets[n-1].at
+	return meanY + b*(last-meanX), b * 60, true
+}
+
+// gopSize 计算 GOP 大小（关键帧间隔的帧数）
+func (a *analyzer) gopSize() int {
+	switch {
+	case a.keyframes > 1:
+		// 只统计相邻两个关键帧之间的完整 GOP，采样在 GOP 中间开始或结束时不影响结果
+		first, last := a.keyframePos[0], a.keyframePos[len(a.keyframePos)-1]
+		return int(math.Round(float64(last.index-first.index) / float64(len(a.keyframePos)-1)))
+	case a.keyframes == 1:
+		// 只有一个关键帧，GOP就是所有帧
+		return a.video
+	default:
+		return 0
+	}
+}
+
+// keyframeIntervals 按相邻关键帧的 DTS 差计算关键帧间隔（秒）的最小值、平均值、最大值和变异系数。
+// 至少两个关键帧时 ok 为 true，变异系数（标准差 / 平均值）至少需要两个间隔，否则为 0
+func (a *analyzer) keyframeIntervals() (minSec, avgSec, maxSec, cv float64, ok bool) {
+	var intervals []float64
+	for i := 1; i < len(a.keyframePos); i++ {
+		if d := a.keyframePos[i].dts - a.keyframePos[i-1].dts; d > 0 {
+			intervals = append(intervals, d.Seconds())
+		}
+	}
+	if len(intervals) == 0 {
+		return 0, 0, 0, 0, false
+	}
+
+	minSec, maxSec = intervals[0], intervals[0]
+	sum := 0.0
+	for _, v := range intervals {
+		minSec = min(minSec, v)
+		maxSec = max(maxSec, v)
+		sum += v
+	}
+	avgSec = sum / float64(len(intervals))
+
+	if len(intervals) >= 2 {
+		variance := 0.0
+		for _, v := range intervals {
+			variance += (v - avgSec) * (v - avgSec)
+		}
+		cv = math.Sqrt(variance/float64(len(intervals))) / avgSec
+	}
+	return minSec, avgSec, maxSec, cv, true
+}
+
+// dtsElapsed 返回第一个到最后一个视频包的 DTS 跨度（秒）
+func (a *analyzer) dtsElapsed() float64 {
+	if a.firstVideo.IsZero() || a.lastDTS <= a.firstDTS {
+		return 0
+	}
+	return (a.lastDTS - a.firstDTS).Seconds()
+}
+
+// player 用于评估实时性的模拟播放器，有视频时按视频，纯音频流按音频
+func (a *analyzer) player() *playerSim {
+	if a.video > 0 {
+		return &a.videoPlayer
+	}
+	return &a.audioPlayer
+}
+
+// videoBitrate 按视频 DTS 跨度计算的视频码率（bps），总字节数扣除音频负载
+func (a *analyzer) videoBitrate() float64 {
+	elapsed := a.dtsElapsed()
+	if elapsed <= 0 {
+		return 0
+	}
+	return float64(a.bytes-a.audioBytes) * 8 / elapsed
+}
+
+// audioBitrate 按音频包 DTS 跨度计算的音频码率（bps）
+func (a *analyzer) audioBitrate() float64 {
+	if a.lastAudioDTS <= a.firstAudioDTS {
+		return 0
+	}
+	return float64(a.audioBytes) * 8 / (a.lastAudioDTS - a.firstAudioDTS).Seconds()
+}
+
+// 标称帧率的来源
+const (
+	frameRateFromMetadata = "metadata" // onMetaData 的 framerate
+	frameRateFromVUI      = "vui"      // SPS VUI 的 timing_info
+	frameRateFromDTS      = "dts"      // 相邻帧时间戳差的中位数
+)
+
+// sortedVideoPTS 按显示时间排序的视频时间戳，有 B 帧时解码顺序和显示顺序不同，排序后相邻帧间隔才是帧时长
+func (a *analyzer) sortedVideoPTS() []time.Duration {
+	pts := slices.Clone(a.videoPTS)
+	slices.Sort(pts)
+	return pts
+}
+
+// frameDuration 标称帧时长，依次取 onMetaData 的 framerate、SPS VUI 的帧率、相邻帧间隔的中位数
+func (a *analyzer) frameDuration(pts []time.Duration) (time.Duration, string) {
+	if a.metadataInfo.framerate > 0 {
+		return time.Duration(float64(time.Second) / a.metadataInfo.framerate), frameRateFromMetadata
+	}
+	if a.videoInfo.frameRate > 0 {
+		return time.Duration(float64(time.Second) / a.videoInfo.frameRate), frameRateFromVUI
+	}
+
+	deltas := make([]time.Duration, 0, len(pts))
+	for i := 1; i < len(pts); i++ {
+		if d := pts[i] - pts[i-1]; d > 0 {
+			deltas = append(deltas, d)
+		}
+	}
+	if len(deltas) == 0 {
+		return 0, ""
+	}
+	slices.Sort(deltas)
+	return deltas[len(deltas)/2], frameRateFromDTS
+}
+
+// frameLoss 按标称帧时长估算丢帧：显示时间戳排序后，相邻两帧间隔 n 个帧时长即丢了 n-1 帧。
+// 超过跳变阈值的间隔已计为时间戳异常，不算丢帧
+func (a *analyzer) frameLoss(pts []time.Duration, frame time.Duration) (dropped int64, ratio float64) {
+	if frame <= 0 {
+		return 0, 0
+	}
+
+	for i := 1; i < len(pts); i++ {
+		d := pts[i] - pts[i-1]
+		if d <= 0 || a.jumpGap > 0 && d > a.jumpGap {
+			continue
+		}
+		if missing := int64(math.Round(float64(d)/float64(frame))) - 1; missing > 0 {
+			dropped += missing
+		}
+	}
+	expected := int64(len(pts)) + dropped
+	if expected == 0 {
+		return 0, 0
+	}
+	return dropped, float64(dropped) / float64(expected)
+}
+
+// jitter 计算网络抖动（视频包到达间隔的标准差，毫秒）
+func (a *analyzer) jitter() int64 {
+	if len(a.intervals) <= 1 {
+		return 0
+	}
+
+	var sum float64
+	for _, interval := range a.intervals {
+		sum += interval
+	}
+	avg := sum / float64(len(a.intervals))
+
+	var variance float64
+	for _, interval := range a.intervals {
+		diff := interval - avg
+		variance += diff * diff
+	}
+	variance /= float64(len(a.intervals))
+	return int64(math.Sqrt(variance))
+}
+
+// sample 从会话中读取数据包直到满足采样条件，超时或数据结束视为正常结束
+func (sc *Checker) sample(ctx context.Context, s Session, cfg sampleConfig) (*analyzer, error) {
+	a := &analyzer{
+		jumpGap:     cfg.jumpGap,
+		latency:     cfg.latency,
+		videoPlayer: playerSim{startupBuffer: cfg.startupBuffer},
+		audioPlayer: playerSim{startupBuffer: cfg.startupBuffer},
+	}
+	start := time.Now()
+
+	for {
+		// 基于时间的采样，提前退出条件：达到采样时间且收集到足够关键帧（纯音频流不要求关键帧）
+		elapsed := time.Since(start)
+		if elapsed >= cfg.duration && (a.keyframes >= cfg.minKeyframes || a.video == 0 && a.audio > 0) {
+			break
+		}
+
+		// 如果已经超过采样时间，即使关键帧不够也退出（避免长时间阻塞）
+		if elapsed >= cfg.duration*2 {
+			break
+		}
+
+		pkt, err := s.ReadPacket()
+		arrival := time.Now() // 记录包到达时间（读取返回时）
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			// 检查超时视为采样结束，已收到的数据仍然有效
+			if ctx.Err() != nil || errors.Is(err, os.ErrDeadlineExceeded) {
+				sc.log.Debug("采样超时", "流ID", sc.id, "已采样字节", a.bytes)
+				break
+			}
+			return nil, fmt.Errorf("读取数据包失败: %w", err)
+		}
+
+		a.add(pkt, arrival)
+
+		// 字节数限制检查（在累加后立即检查，避免超过限制）
+		if cfg.maxBytes > 0 && a.bytes >= cfg.maxBytes {
+			sc.log.Debug("达到最大采样字节数限制", "流ID", sc.id, "已采样字节", a.bytes, "限制", cfg.maxBytes)
+			break
+		}
+	}
+
+	// 结算采样结束时仍在进行的卡顿
+	end := time.Now()
+	a.videoPlayer.finish(end)
+	a.audioPlayer.finish(end)
+
+	return a, nil
+}
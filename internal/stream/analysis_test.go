@@ -0,0 +1,79 @@
+package stream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDTSTrack(t *testing.T) {
+	ms := func(v ...int) []time.Duration {
+		out := make([]time.Duration, len(v))
+		for i, x := range v {
+			out[i] = time.Duration(x) * time.Millisecond
+		}
+		return out
+	}
+	tests := []struct {
+		name        string
+		ts          []time.Duration
+		ptsOnly     bool
+		regressions int64
+		jumps       int64
+		wraps       int64
+	}{
+		{name: "正常递增", ts: ms(0, 40, 80, 120)},
+		{name: "DTS 回退", ts: ms(0, 40, 80, 40, 80), regressions: 1},
+		{name: "DTS 前跳", ts: ms(0, 40, 5000, 5040), jumps: 1},
+		// IPBB 顺序的显示时间戳：0 120 40 80 240 160 200
+		{name: "RTP 显示时间戳 B 帧重排", ts: ms(0, 120, 40, 80, 240, 160, 200), ptsOnly: true},
+		{name: "RTP 显示时间戳前跳", ts: ms(0, 120, 40, 5000), ptsOnly: true, jumps: 1},
+		{
+			name:  "FLV 32 位毫秒回绕",
+			ts:    []time.Duration{(1<<32 - 40) * time.Millisecond, 0, 40 * time.Millisecond},
+			wraps: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var track dtsTrack
+			var a timestampAnomalies
+			for _, ts := range tt.ts {
+				track.check(ts, time.Second, tt.ptsOnly, &a)
+			}
+			if a.regressions != tt.regressions || a.jumps != tt.jumps || a.wraps != tt.wraps {
+				t.Errorf("回退=%d 前跳=%d 回绕=%d, want %d %d %d", a.regressions, a.jumps, a.wraps, tt.regressions, tt.jumps, tt.wraps)
+			}
+		})
+	}
+}
+
+func TestAnalyzerBackfill(t *testing.T) {
+	const frame = 40 * time.Millisecond
+	a := &analyzer{videoPlayer: playerSim{startupBuffer: 200 * time.Millisecond}}
+	now := time.Now()
+	var dts time.Duration
+
+	// 回溯的 10 秒历史分片在 100ms 内下载完
+	for i := range 250 {
+		a.add(Packet{Kind: PacketVideo, Codec: "H264", KeyFrame: i%50 == 0, DTS: dts, Backfill: true}, now.Add(time.Duration(i)*400*time.Microsecond))
+		dts += frame
+	}
+	// 之后的分片按实时到达
+	now = now.Add(time.Second)
+	for i := range 100 {
+		a.add(Packet{Kind: PacketVideo, Codec: "H264", KeyFrame: i%50 == 0, DTS: dts}, now.Add(time.Duration(i)*frame))
+		dts += frame
+	}
+	p := a.player()
+	p.finish(now.Add(100 * frame))
+
+	if ratio := p.realtimeRatio(); ratio < 0.99 || ratio > 1.01 {
+		t.Errorf("realtimeRatio = %.2f，回溯分片不应计入", ratio)
+	}
+	if p.rebuffers != 0 {
+		t.Errorf("rebuffers = %d, want 0", p.rebuffers)
+	}
+	if a.longestGap > frame {
+		t.Errorf("longestGap = %v，回溯分片与实时分片之间的间隔不应计入", a.longestGap)
+	}
+}
@@ -0,0 +1,160 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// audioInfo 从解码配置或帧头解析出的音频参数
+type audioInfo struct {
+	sampleRate int // 采样率（Hz），HE-AAC 为 SBR 输出采样率
+	channels   int // 声道数，0 表示未知
+}
+
+// aacSampleRates AudioSpecificConfig / ADTS 的 samplingFrequencyIndex 对应的采样率
+var aacSampleRates = [...]int{96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050, 16000, 12000, 11025, 8000, 7350}
+
+// parseAudioConfig 解析音频解码配置：AAC 为 AudioSpecificConfig，Opus 为 OpusHead 或 mp4 的 dOps
+func parseAudioConfig(codec string, data []byte) (audioInfo, bool) {
+	switch codec {
+	case "AAC":
+		info, err := parseAudioSpecificConfig(data)
+		return info, err == nil && info.sampleRate > 0
+	case "OPUS":
+		// OpusHead: "OpusHead" + version(8) + channels(8) + ...；dOps 没有魔数，其余布局相同
+		data = bytes.TrimPrefix(data, []byte("OpusHead"))
+		if len(data) < 2 || data[1] == 0 {
+			return audioInfo{}, false
+		}
+		// Opus 解码输出固定为 48kHz，InputSampleRate 只是编码前的原始采样率
+		return audioInfo{sampleRate: 48000, channels: int(data[1])}, true
+	}
+	return audioInfo{}, false
+}
+
+// parseAudioFrame 从没有单独解码配置的音频帧中解析参数，目前只支持 MP3 帧头
+func parseAudioFrame(codec string, data []byte) (audioInfo, bool) {
+	if codec == "MP3" {
+		return parseMP3Header(data)
+	}
+	return audioInfo{}, false
+}
+
+// parseAudioSpecificConfig 解析 AudioSpecificConfig（ISO/IEC 14496-3 1.6.2.1），
+// 显式 SBR / PS 信令时返回扩展采样率，PS 按双声道输出
+func parseAudioSpecificConfig(b []byte) (audioInfo, error) {
+	r := &bitReader{data: b}
+
+	objectType, err := aacObjectType(r)
+	if err != nil {
+		return audioInfo{}, err
+	}
+	sampleRate, err := aacSampleRate(r)
+	if err != nil {
+		return audioInfo{}, err
+	}
+	channelConfig, err := r.bits(4)
+	if err != nil {
+		return audioInfo{}, err
+	}
+
+	// 5 为 SBR（HE-AAC），29 为 PS（HE-AACv2）
+	if objectType == 5 || objectType == 29 {
+		if sampleRate, err = aacSampleRate(r); err != nil {
+			return audioInfo{}, err
+		}
+		if objectType == 29 && channelConfig == 1 {
+			channelConfig = 2
+		}
+	}
+
+	info := audioInfo{sampleRate: sampleRate}
+	switch {
+	case channelConfig >= 1 && channelConfig <= 6:
+		info.channels = int(channelConfig)
+	case channelConfig == 7:
+		info.channels = 8
+	}
+	// channelConfiguration 为 0 时声道布局在 program_config_element 中，不解析
+	return info, nil
+}
+
+// aacObjectType 读取 audioObjectType（31 为扩展）
+func aacObjectType(r *bitReader) (uint32, error) {
+	objectType, err := r.bits(5)
+	if err != nil || objectType != 31 {
+		return objectType, err
+	}
+	ext, err := r.bits(6)
+	return 32 + ext, err
+}
+
+// aacSampleRate 读取 samplingFrequencyIndex（15 表示随后 24 位为显式采样率）
+func aacSampleRate(r *bitReader) (int, error) {
+	index, err := r.bits(4)
+	if err != nil {
+		return 0, err
+	}
+	if index == 15 {
+		rate, err := r.bits(24)
+		return int(rate), err
+	}
+	if int(index) >= len(aacSampleRates) {
+		return 0, fmt.Errorf("无效的 AAC 采样率索引: %d", index)
+	}
+	return aacSampleRates[index], nil
+}
+
+// mp3SampleRates MPEG-1 各采样率索引对应的采样率，MPEG-2 减半、MPEG-2.5 为四分之一
+var mp3SampleRates = [...]int{44100, 48000, 32000}
+
+// parseMP3Header 解析 MPEG 音频帧头（11 位同步字 + 版本 + 层 + ... + 声道模式）
+func parseMP3Header(b []byte) (audioInfo, bool) {
+	if len(b) < 4 {
+		return audioInfo{}, false
+	}
+	h := binary.BigEndian.Uint32(b)
+	if h>>21 != 0x7ff {
+		return audioInfo{}, false
+	}
+
+	version := h >> 19 & 0x3 // 0: MPEG-2.5，2: MPEG-2，3: MPEG-1
+	rateIndex := h >> 10 & 0x3
+	if version == 1 || rateIndex == 3 {
+		return audioInfo{}, false
+	}
+
+	rate := mp3SampleRates[rateIndex]
+	switch version {
+	case 2:
+		rate /= 2
+	case 0:
+		rate /= 4
+	}
+
+	channels := 2
+	if h>>6&0x3 == 3 { // 单声道
+		channels = 1
+	}
+	return audioInfo{sampleRate: rate, channels: channels}, true
+}
+
+// audioCodecName 把 Enhanced FLV / mp4 的音频 FourCC 转换为指标中使用的编码名称
+func audioCodecName(fourCC string) string {
+	switch fourCC {
+	case "mp4a":
+		return "AAC"
+	case ".mp3":
+		return "MP3"
+	case "Opus":
+		return "OPUS"
+	case "ac-3":
+		return "AC3"
+	case "ec-3":
+		return "EAC3"
+	case "fLaC":
+		return "FLAC"
+	}
+	return ""
+}
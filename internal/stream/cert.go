@@ -0,0 +1,61 @@
+package stream
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"time"
+)
+
+// tlsInfo 第一个请求最终响应（或握手失败时）的 TLS 连接信息和服务端证书链
+type tlsInfo struct {
+	version   string    // 协商的 TLS 版本，例如 TLS 1.3，握手失败时为空
+	cipher    string    // 协商的加密套件，握手失败时为空
+	issuer    string    // 叶子证书的签发者（CN，没有时取组织名）
+	notAfter  time.Time // 服务端发送的证书链中最早的过期时间
+	hostMatch bool      // 叶子证书的 SAN 是否匹配请求的主机名
+}
+
+// newTLSInfo 从服务端证书链提取证书信息，没有证书时 ok 为 false
+func newTLSInfo(host string, certs []*x509.Certificate) (tlsInfo, bool) {
+	if len(certs) == 0 {
+		return tlsInfo{}, false
+	}
+
+	leaf := certs[0]
+	info := tlsInfo{
+		issuer:    leaf.Issuer.CommonName,
+		notAfter:  leaf.NotAfter,
+		hostMatch: leaf.VerifyHostname(host) == nil,
+	}
+	if info.issuer == "" && len(leaf.Issuer.Organization) > 0 {
+		info.issuer = leaf.Issuer.Organization[0]
+	}
+	// 中间证书过期同样会导致播放失败
+	for _, cert := range certs[1:] {
+		if cert.NotAfter.Before(info.notAfter) {
+			info.notAfter = cert.NotAfter
+		}
+	}
+	return info, true
+}
+
+// recordTLS 记录最终响应的 TLS 连接信息，调用方持有 t.mu
+func (t *startupTrace) recordTLS(host string, state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+	info, ok := newTLSInfo(host, state.PeerCertificates)
+	if !ok {
+		return
+	}
+	info.version = tls.VersionName(state.Version)
+	info.cipher = tls.CipherSuiteName(state.CipherSuite)
+	t.cert, t.hasCert = info, true
+}
+
+// tlsSnapshot 返回 TLS 证书信息，非 HTTPS 或未建立连接时 ok 为 false
+func (t *startupTrace) tlsSnapshot() (tlsInfo, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.cert, t.hasCert
+}
@@ -0,0 +1,184 @@
+package stream
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// testCA 测试用的根证书和签发的证书
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+// newTestCA 生成自签名根证书
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Root CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(365 * 24 * time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue 签发证书，isCA 为 true 时签发中间证书
+func (ca *testCA) issue(t *testing.T, tmpl *x509.Certificate, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	tmpl.SerialNumber = big.NewInt(time.Now().UnixNano())
+	if isCA {
+		tmpl.IsCA, tmpl.BasicConstraintsValid, tmpl.KeyUsage = true, true, x509.KeyUsageCertSign
+	} else {
+		tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert, key
+}
+
+func TestNewTLSInfo(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now()
+	leaf, _ := ca.issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "cdn.example.com"},
+		DNSNames:  []string{"cdn.example.com", "*.cdn.example.com"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(90 * 24 * time.Hour),
+	}, false)
+	intermediate, _ := ca.issue(t, &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "Test Intermediate"},
+		NotBefore: now.Add(-time.Hour), NotAfter: now.Add(10 * 24 * time.Hour),
+	}, true)
+	orgIssued := &x509.Certificate{Issuer: pkix.Name{Organization: []string{"Test Org"}}, NotAfter: leaf.NotAfter, DNSNames: []string{"a.example.com"}}
+
+	tests := []struct {
+		name  string
+		host  string
+		certs []*x509.Certificate
+		want  tlsInfo
+		ok    bool
+	}{
+		{name: "没有证书", host: "cdn.example.com"},
+		{
+			name: "单个叶子证书", host: "cdn.example.com", certs: []*x509.Certificate{leaf},
+			want: tlsInfo{issuer: "Test Root CA", notAfter: leaf.NotAfter, hostMatch: true}, ok: true,
+		},
+		{
+			name: "通配符匹配", host: "edge1.cdn.example.com", certs: []*x509.Certificate{leaf},
+			want: tlsInfo{issuer: "Test Root CA", notAfter: leaf.NotAfter, hostMatch: true}, ok: true,
+		},
+		{
+			name: "中间证书更早过期", host: "cdn.example.com", certs: []*x509.Certificate{leaf, intermediate, ca.cert},
+			want: tlsInfo{issuer: "Test Root CA", notAfter: intermediate.NotAfter, hostMatch: true}, ok: true,
+		},
+		{
+			name: "SAN 不匹配", host: "other.example.com", certs: []*x509.Certificate{leaf},
+			want: tlsInfo{issuer: "Test Root CA", notAfter: leaf.NotAfter}, ok: true,
+		},
+		{
+			name: "签发者没有 CN 时取组织名", host: "a.example.com", certs: []*x509.Certificate{orgIssued},
+			want: tlsInfo{issuer: "Test Org", notAfter: leaf.NotAfter, hostMatch: true}, ok: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := newTLSInfo(tt.host, tt.certs)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("newTLSInfo() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestStartupTraceTLS(t *testing.T) {
+	ca := newTestCA(t)
+	now := time.Now()
+	localhost := []net.IP{net.ParseIP("127.0.0.1")}
+
+	tests := []struct {
+		name      string
+		tmpl      *x509.Certificate
+		wantErr   bool
+		hostMatch bool
+		expired   bool
+		version   string
+	}{
+		{
+			name:      "有效证书",
+			tmpl:      &x509.Certificate{Subject: pkix.Name{CommonName: "127.0.0.1"}, IPAddresses: localhost, NotBefore: now.Add(-time.Hour), NotAfter: now.Add(30 * 24 * time.Hour)},
+			hostMatch: true,
+			version:   "TLS 1.3",
+		},
+		{
+			// 握手失败没有响应，从 CertificateVerificationError 中取出证书
+			name:      "证书已过期",
+			tmpl:      &x509.Certificate{Subject: pkix.Name{CommonName: "127.0.0.1"}, IPAddresses: localhost, NotBefore: now.Add(-48 * time.Hour), NotAfter: now.Add(-24 * time.Hour)},
+			wantErr:   true,
+			hostMatch: true,
+			expired:   true,
+		},
+		{
+			name:    "证书与主机名不匹配",
+			tmpl:    &x509.Certificate{Subject: pkix.Name{CommonName: "cdn.example.com"}, DNSNames: []string{"cdn.example.com"}, NotBefore: now.Add(-time.Hour), NotAfter: now.Add(30 * 24 * time.Hour)},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaf, key := ca.issue(t, tt.tmpl, false)
+			srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+			srv.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}}}
+			srv.StartTLS()
+			defer srv.Close()
+
+			client := &http.Client{Transport: &edgeTransport{base: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: ca.pool}}}}
+			trace := &startupTrace{start: time.Now()}
+			req, _ := http.NewRequestWithContext(trace.withContext(t.Context()), "GET", srv.URL+"/live/a.flv", nil)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			info, ok := trace.tlsSnapshot()
+			if !ok {
+				t.Fatal("没有记录证书信息")
+			}
+			if info.hostMatch != tt.hostMatch || info.version != tt.version || info.issuer != "Test Root CA" {
+				t.Errorf("tlsInfo = %+v, want hostMatch %v version %q", info, tt.hostMatch, tt.version)
+			}
+			if !info.notAfter.Equal(leaf.NotAfter) || info.notAfter.Before(now) != tt.expired {
+				t.Errorf("notAfter = %v, want %v expired %v", info.notAfter, leaf.NotAfter, tt.expired)
+			}
+		})
+	}
+}
@@ -0,0 +1,661 @@
+package stream
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	urlpkg "net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// dashMPD MPD 中用到的字段
+type dashMPD struct {
+	Type                      string       `xml:"type,attr"`
+	AvailabilityStartTime     string       `xml:"availabilityStartTime,attr"`
+	MediaPresentationDuration string       `xml:"mediaPresentationDuration,attr"`
+	MinimumUpdatePeriod       string       `xml:"minimumUpdatePeriod,attr"`
+	BaseURL                   string       `xml:"BaseURL"`
+	Periods                   []dashPeriod `xml:"Period"`
+}
+
+// dashPeriod MPD 中的一个 Period
+type dashPeriod struct {
+	Start          string              `xml:"start,attr"`
+	Duration       string              `xml:"duration,attr"`
+	BaseURL        string              `xml:"BaseURL"`
+	AdaptationSets []dashAdaptationSet `xml:"AdaptationSet"`
+}
+
+// dashAdaptationSet 一组可切换的 Representation
+type dashAdaptationSet struct {
+	MimeType        string               `xml:"mimeType,attr"`
+	ContentType     string               `xml:"contentType,attr"`
+	BaseURL         string               `xml:"BaseURL"`
+	SegmentTemplate *dashSegmentTemplate `xml:"SegmentTemplate"`
+	Representations []dashRepresentation `xml:"Representation"`
+}
+
+// dashRepresentation 一个码率档位
+type dashRepresentation struct {
+	ID              string               `xml:"id,attr"`
+	Bandwidth       int64                `xml:"bandwidth,attr"`
+	MimeType        string               `xml:"mimeType,attr"`
+	Codecs          string               `xml:"codecs,attr"`
+	BaseURL         string               `xml:"BaseURL"`
+	SegmentTemplate *dashSegmentTemplate `xml:"SegmentTemplate"`
+}
+
+// dashSegmentTemplate SegmentTemplate（可带 SegmentTimeline）
+type dashSegmentTemplate struct {
+	Media                  string        `xml:"media,attr"`
+	Initialization         string        `xml:"initialization,attr"`
+	Timescale              *uint64       `xml:"timescale,attr"`
+	StartNumber            *int64        `xml:"startNumber,attr"`
+	Duration               *uint64       `xml:"duration,attr"`
+	PresentationTimeOffset *uint64       `xml:"presentationTimeOffset,attr"`
+	Timeline               *dashTimeline `xml:"SegmentTimeline"`
+}
+
+// dashTimeline SegmentTimeline
+type dashTimeline struct {
+	S []struct {
+		T *int64 `xml:"t,attr"`
+		D int64  `xml:"d,attr"`
+		R int64  `xml:"r,attr"`
+	} `xml:"S"`
+}
+
+// dashSegment 展开后的一个媒体分片
+type dashSegment struct {
+	url      string
+	key      int64 // 去重键：使用 SegmentTimeline 时为媒体时间，否则为分片编号
+	time     int64 // 媒体时间（模板 timescale 单位）
+	duration int64
+}
+
+// dashPlan 从 MPD 中选定的档位及其分片列表
+type dashPlan struct {
+	dynamic     bool
+	ast         time.Time // availabilityStartTime
+	periodStart time.Duration
+	timescale   uint64
+	pto         uint64 // presentationTimeOffset
+	initURL     string
+	codec       string
+	bandwidth   int64
+	segments    []dashSegment
+}
+
+// dashStats 一次 DASH 检查得到的协议相关指标
+type dashStats struct {
+	astSkew             float64 // 墙钟推算的媒体时间与最新分片结束时间之差（秒，仅动态 MPD）
+	segmentFetchLatency float64 // 分片平均下载耗时（毫秒）
+}
+
+// dashReader 以直播播放器的方式读取 DASH：
+// 选择码率最高的视频档位，从直播边缘回溯半个采样时长开始下载 fMP4 分片，
+// 之后按分片时长刷新 MPD
+type dashReader struct {
+	ctx      context.Context
+	header   http.Header
+	mpdURL   string
+	deadline time.Time
+
+	plan     *dashPlan
+	init     *mp4Init
+	lastLoad time.Time
+	changed  bool
+	queue    []dashSegment
+	lastKey  int64
+	pending  []av.Packet
+
+	backfillLeft int  // 起播时回溯的历史分片中尚未下载的数量（不含直播边缘分片）
+	backfilled   bool // pending 中的包是否来自回溯的历史分片
+
+	fetchCount   int64
+	fetchTotal   time.Duration
+	skewSet      bool
+	responseTime int64 // 首次请求 MPD 的响应时间（毫秒）
+	stats        dashStats
+	log          *slog.Logger
+}
+
+// openDASH 加载 MPD 和初始化分片并准备读取
+func openDASH(ctx context.Context, rawURL string, header http.Header, sampleDuration time.Duration, log *slog.Logger) (*dashReader, error) {
+	r := &dashReader{
+		ctx:      ctx,
+		header:   header,
+		mpdURL:   rawURL,
+		deadline: time.Now().Add(sampleDuration),
+		log:      log,
+	}
+
+	reqStart := time.Now()
+	plan, err := r.fetchMPD(func() { r.responseTime = time.Since(reqStart).Milliseconds() })
+	if err != nil {
+		return nil, err
+	}
+	if len(plan.segments) == 0 {
+		return nil, fmt.Errorf("DASH MPD 没有可用分片")
+	}
+	r.plan = plan
+	r.log.Debug("选择 DASH 档位", "编码", plan.codec, "带宽", plan.bandwidth, "动态", plan.dynamic)
+
+	resp, err := httpGet(ctx, plan.initURL, r.header)
+	if err != nil {
+		return nil, fmt.Errorf("下载初始化分片失败: %w", err)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("下载初始化分片失败: %w", err)
+	}
+	if r.init, err = parseMP4Init(data); err != nil {
+		return nil, fmt.Errorf("解析初始化分片失败: %w", err)
+	}
+	for _, t := range r.init.tracks {
+		if t.handler == "soun" && len(t.audioConfig) > 0 {
+			r.pending = append(r.pending, av.Packet{Type: av.AACDecoderConfig, Data: t.audioConfig})
+		}
+	}
+
+	// 动态 MPD 从直播边缘回溯半个采样时长（至少一个分片），静态 MPD 从头开始
+	segs := plan.segments
+	start := 0
+	if plan.dynamic {
+		start = len(segs) - 1
+		covered := float64(segs[start].duration) / float64(plan.timescale)
+		for start > 0 && covered < sampleDuration.Seconds()/2 {
+			start--
+			covered += float64(segs[start].duration) / float64(plan.timescale)
+		}
+	}
+	r.queue = append(r.queue, segs[start:]...)
+	if plan.dynamic {
+		r.backfillLeft = len(r.queue) - 1
+	}
+	r.lastKey = segs[len(segs)-1].key
+	r.changed = true
+
+	return r, nil
+}
+
+// fetchMPD 下载并解析 MPD，onResponse 在收到响应头时调用
+func (r *dashReader) fetchMPD(onResponse func()) (*dashPlan, error) {
+	resp, err := httpGet(r.ctx, r.mpdURL, r.header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if onResponse != nil {
+		onResponse()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("读取 MPD 失败: %w", err)
+	}
+	r.lastLoad = time.Now()
+
+	// 以重定向后的最终地址作为相对 URL 的基准
+	return parseMPD(data, resp.Request.URL, r.lastLoad)
+}
+
+// parseMPD 解析 MPD，选择最后一个 Period 中码率最高的视频档位并展开分片列表
+func parseMPD(data []byte, base *urlpkg.URL, now time.Time) (*dashPlan, error) {
+	var mpd dashMPD
+	if err := xml.Unmarshal(data, &mpd); err != nil {
+		return nil, fmt.Errorf("无效的 MPD: %w", err)
+	}
+	if len(mpd.Periods) == 0 {
+		return nil, fmt.Errorf("MPD 中没有 Period")
+	}
+
+	plan := &dashPlan{dynamic: mpd.Type == "dynamic"}
+	if mpd.AvailabilityStartTime != "" {
+		ast, err := parseDASHTime(mpd.AvailabilityStartTime)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 availabilityStartTime: %w", err)
+		}
+		plan.ast = ast
+	}
+	if plan.dynamic && plan.ast.IsZero() {
+		return nil, fmt.Errorf("动态 MPD 缺少 availabilityStartTime")
+	}
+
+	// 直播取最后一个 Period
+	period := mpd.Periods[len(mpd.Periods)-1]
+	plan.periodStart, _ = parseISODuration(period.Start)
+	periodDuration, _ := parseISODuration(period.Duration)
+	if periodDuration == 0 && len(mpd.Periods) == 1 {
+		periodDuration, _ = parseISODuration(mpd.MediaPresentationDuration)
+	}
+
+	// 优先选择码率最高的视频档位，纯音频的 MPD 选择码率最高的音频档位
+	var set *dashAdaptationSet
+	var rep *dashRepresentation
+	for _, content := range []string{"video", "audio"} {
+		for i := range period.AdaptationSets {
+			as := &period.AdaptationSets[i]
+			for j := range as.Representations {
+				rp := &as.Representations[j]
+				mime := rp.MimeType
+				if mime == "" {
+					mime = as.MimeType
+				}
+				if !strings.HasPrefix(mime, content+"/") && as.ContentType != content {
+					continue
+				}
+				if rep == nil || rp.Bandwidth > rep.Bandwidth {
+					set, rep = as, rp
+				}
+			}
+		}
+		if rep != nil {
+			break
+		}
+	}
+	if rep == nil {
+		return nil, fmt.Errorf("MPD 中没有音视频档位")
+	}
+	plan.codec = rep.Codecs
+	plan.bandwidth = rep.Bandwidth
+
+	tmpl := mergeSegmentTemplate(set.SegmentTemplate, rep.SegmentTemplate)
+	if tmpl == nil || tmpl.Media == "" {
+		return nil, fmt.Errorf("暂不支持的 DASH 分段方式（仅支持 SegmentTemplate）")
+	}
+
+	// BaseURL 逐级解析：MPD -> Period -> AdaptationSet -> Representation
+	for _, ref := range []string{mpd.BaseURL, period.BaseURL, set.BaseURL, rep.BaseURL} {
+		if ref = strings.TrimSpace(ref); ref == "" {
+			continue
+		}
+		if u, err := base.Parse(ref); err == nil {
+			base = u
+		}
+	}
+	resolve := func(ref string) string {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+
+	plan.timescale = 1
+	if tmpl.Timescale != nil && *tmpl.Timescale > 0 {
+		plan.timescale = *tmpl.Timescale
+	}
+	if tmpl.PresentationTimeOffset != nil {
+		plan.pto = *tmpl.PresentationTimeOffset
+	}
+	startNumber := int64(1)
+	if tmpl.StartNumber != nil {
+		startNumber = *tmpl.StartNumber
+	}
+	plan.initURL = resolve(fillDASHTemplate(tmpl.Initialization, rep, 0, 0))
+
+	// 当前墙钟对应的媒体时间（模板 timescale 单位）
+	var liveEdge int64
+	if plan.dynamic {
+		elapsed := now.Sub(plan.ast) - plan.periodStart
+		liveEdge = int64(elapsed.Seconds()*float64(plan.timescale)) + int64(plan.pto)
+	}
+
+	switch {
+	case tmpl.Timeline != nil:
+		number := startNumber
+		var t int64
+		for i, s := range tmpl.Timeline.S {
+			if s.T != nil {
+				t = *s.T
+			}
+			if s.D <= 0 {
+				continue
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// r=-1：重复到下一个 S 的 t，最后一个 S 则到直播边缘或 Period 结束
+				end := liveEdge
+				if i+1 < len(tmpl.Timeline.S) && tmpl.Timeline.S[i+1].T != nil {
+					end = *tmpl.Timeline.S[i+1].T
+				} else if !plan.dynamic {
+					end = int64(periodDuration.Seconds()*float64(plan.timescale)) + int64(plan.pto)
+				}
+				repeat = int64(math.Ceil(float64(end-t)/float64(s.D))) - 1
+			}
+			for k := int64(0); k <= repeat; k++ {
+				if plan.dynamic && t+s.D > liveEdge {
+					break
+				}
+				plan.segments = append(plan.segments, dashSegment{
+					url:      resolve(fillDASHTemplate(tmpl.Media, rep, number, t)),
+					key:      t,
+					time:     t,
+					duration: s.D,
+				})
+				number++
+				t += s.D
+			}
+		}
+	case tmpl.Duration != nil && *tmpl.Duration > 0:
+		d := int64(*tmpl.Duration)
+		var count int64
+		if plan.dynamic {
+			// 已完整生成的分片数
+			count = (liveEdge - int64(plan.pto)) / d
+		} else {
+			count = int64(math.Ceil(periodDuration.Seconds() * float64(plan.timescale) / float64(d)))
+		}
+		first := int64(0)
+		if plan.dynamic && count > 10 {
+			// 只保留直播边缘附近的分片
+			first = count - 10
+		}
+		for n := first; n < count; n++ {
+			t := n*d + int64(plan.pto)
+			plan.segments = append(plan.segments, dashSegment{
+				url:      resolve(fillDASHTemplate(tmpl.Media, rep, startNumber+n, t)),
+				key:      startNumber + n,
+				time:     t,
+				duration: d,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("SegmentTemplate 缺少 duration 或 SegmentTimeline")
+	}
+
+	return plan, nil
+}
+
+// mergeSegmentTemplate Representation 级的 SegmentTemplate 覆盖 AdaptationSet 级的同名属性
+func mergeSegmentTemplate(parent, child *dashSegmentTemplate) *dashSegmentTemplate {
+	if parent == nil {
+		return child
+	}
+	if child == nil {
+		return parent
+	}
+	merged := *parent
+	if child.Media != "" {
+		merged.Media = child.Media
+	}
+	if child.Initialization != "" {
+		merged.Initialization = child.Initialization
+	}
+	if child.Timescale != nil {
+		merged.Timescale = child.Timescale
+	}
+	if child.StartNumber != nil {
+		merged.StartNumber = child.StartNumber
+	}
+	if child.Duration != nil {
+		merged.Duration = child.Duration
+	}
+	if child.PresentationTimeOffset != nil {
+		merged.PresentationTimeOffset = child.PresentationTimeOffset
+	}
+	if child.Timeline != nil {
+		merged.Timeline = child.Timeline
+	}
+	return &merged
+}
+
+// dashTemplateRegex 匹配 $Identifier$ 和 $Identifier%0Nd$
+var dashTemplateRegex = regexp.MustCompile(`\$(RepresentationID|Number|Time|Bandwidth)(%0(\d+)d)?\$`)
+
+// fillDASHTemplate 替换 SegmentTemplate 中的标识符
+func fillDASHTemplate(tmpl string, rep *dashRepresentation, number, t int64) string {
+	out := dashTemplateRegex.ReplaceAllStringFunc(tmpl, func(m string) string {
+		sub := dashTemplateRegex.FindStringSubmatch(m)
+		var value int64
+		switch sub[1] {
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			value = number
+		case "Time":
+			value = t
+		case "Bandwidth":
+			value = rep.Bandwidth
+		}
+		if sub[3] != "" {
+			width, _ := strconv.Atoi(sub[3])
+			return fmt.Sprintf("%0*d", width, value)
+		}
+		return strconv.FormatInt(value, 10)
+	})
+	return strings.ReplaceAll(out, "$$", "$")
+}
+
+// reload 按分片时长等待后刷新 MPD，返回 false 表示采样时间内不会再有新分片
+func (r *dashReader) reload() (bool, error) {
+	if !r.plan.dynamic {
+		return false, nil
+	}
+
+	// 有新分片时间隔一个分片时长，无变化时间隔一半
+	last := r.plan.segments[len(r.plan.segments)-1]
+	interval := time.Duration(float64(last.duration) / float64(r.plan.timescale) * float64(time.Second))
+	if !r.changed {
+		interval /= 2
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	next := r.lastLoad.Add(interval)
+	if next.After(r.deadline) {
+		return false, nil
+	}
+
+	select {
+	case <-time.After(time.Until(next)):
+	case <-r.ctx.Done():
+		return false, r.ctx.Err()
+	}
+
+	plan, err := r.fetchMPD(nil)
+	if err != nil {
+		return false, err
+	}
+	if len(plan.segments) == 0 {
+		r.changed = false
+		return true, nil
+	}
+	r.plan = plan
+
+	r.changed = false
+	for _, seg := range plan.segments {
+		if seg.key > r.lastKey {
+			r.queue = append(r.queue, seg)
+			r.lastKey = seg.key
+			r.changed = true
+		}
+	}
+	return true, nil
+}
+
+// ReadPacket 读取下一个音视频包，分片读完后自动下载下一个分片
+func (r *dashReader) ReadPacket() (av.Packet, error) {
+	for len(r.pending) == 0 {
+		for len(r.queue) == 0 {
+			ok, err := r.reload()
+			if err != nil {
+				return av.Packet{}, err
+			}
+			if !ok {
+				return av.Packet{}, io.EOF
+			}
+		}
+
+		seg := r.queue[0]
+		r.queue = r.queue[1:]
+		r.backfilled = r.backfillLeft > 0
+		if r.backfilled {
+			r.backfillLeft--
+		}
+		if err := r.fetchSegment(seg); err != nil {
+			return av.Packet{}, err
+		}
+	}
+
+	pkt := r.pending[0]
+	r.pending = r.pending[1:]
+	return pkt, nil
+}
+
+// backfilling 当前包是否来自起播时回溯的历史分片
+func (r *dashReader) backfilling() bool {
+	return r.backfilled
+}
+
+// fetchSegment 下载并解析一个媒体分片，统计下载耗时和 availabilityStartTime 偏差
+func (r *dashReader) fetchSegment(seg dashSegment) error {
+	fetchStart := time.Now()
+	resp, err := httpGet(r.ctx, seg.url, r.header)
+	if err != nil {
+		return fmt.Errorf("下载分片失败: %w", err)
+	}
+	data, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("下载分片失败: %w", err)
+	}
+	r.fetchCount++
+	r.fetchTotal += time.Since(fetchStart)
+	r.stats.segmentFetchLatency = float64(r.fetchTotal.Milliseconds()) / float64(r.fetchCount)
+
+	samples, err := parseMP4Fragment(data, r.init)
+	if err != nil {
+		return fmt.Errorf("解析分片失败: %w", err)
+	}
+
+	var videoEnd float64
+	for i := range samples {
+		s := &samples[i]
+		r.pending = append(r.pending, s.packet())
+		if s.track.handler == "vide" {
+			videoEnd = float64(s.dts+int64(s.duration)) / float64(s.track.timescale)
+		}
+	}
+
+	// 偏差 = 请求时刻按 availabilityStartTime 推算的媒体时间 - 分片实际结束时间（tfdt），取本次检查最小值
+	if r.plan.dynamic && videoEnd > 0 {
+		wallclock := (fetchStart.Sub(r.plan.ast) - r.plan.periodStart).Seconds()
+		skew := wallclock - (videoEnd - float64(r.plan.pto)/float64(r.plan.timescale))
+		if !r.skewSet || skew < r.stats.astSkew {
+			r.stats.astSkew = skew
+			r.skewSet = true
+		}
+	}
+	return nil
+}
+
+// codecName 返回选中档位的视频编码名称
+func (r *dashReader) codecName() string {
+	for _, t := range r.init.tracks {
+		if t.handler == "vide" {
+			return mp4CodecName(t.codec)
+		}
+	}
+	return ""
+}
+
+// audioCodecName 返回初始化分片中音频轨道的编码名称
+func (r *dashReader) audioCodecName() string {
+	for _, t := range r.init.tracks {
+		if t.handler == "soun" {
+			return audioCodecName(t.codec)
+		}
+	}
+	return ""
+}
+
+// Close 释放资源
+func (r *dashReader) Close() error {
+	r.pending = nil
+	return nil
+}
+
+// parseDASHTime 解析 xs:dateTime（允许省略时区，按 UTC 处理）
+func parseDASHTime(s string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("无法解析时间: %s", s)
+}
+
+// isoDurationRegex 匹配 xs:duration，例如 PT2.5S、P1DT1H30M
+var isoDurationRegex = regexp.MustCompile(`^P(?:(\d+(?:\.\d+)?)Y)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)D)?(?:T(?:(\d+(?:\.\d+)?)H)?(?:(\d+(?:\.\d+)?)M)?(?:(\d+(?:\.\d+)?)S)?)?$`)
+
+// parseISODuration 解析 xs:duration，年按 365 天、月按 30 天计算
+func parseISODuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, nil
+	}
+	m := isoDurationRegex.FindStringSubmatch(s)
+	if m == nil {
+		return 0, fmt.Errorf("无效的时长: %s", s)
+	}
+	units := []float64{365 * 86400, 30 * 86400, 86400, 3600, 60, 1}
+	var seconds float64
+	for i, unit := range units {
+		if m[i+1] != "" {
+			v, _ := strconv.ParseFloat(m[i+1], 64)
+			seconds += v * unit
+		}
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// isDASHURL 根据扩展名判断是否为 DASH 地址
+func isDASHURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".mpd")
+}
+
+// dashProber DASH 探测器
+type dashProber struct{}
+
+// Open 加载 MPD 和初始化分片并准备读取
+func (dashProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openDASH(ctx, opts.URL, opts.Header, opts.SampleDuration, opts.Log)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r:            &avPacketReader{r: r, videoCodec: r.codecName, audioCodec: r.audioCodecName, backfill: r.backfilling},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			rep.stats = r.stats
+			// 分片按下载突发到达，到达间隔不反映网络抖动
+			rep.NetworkJitter = 0
+			opts.Log.Debug("DASH 检查完成",
+				"AST偏差秒", fmt.Sprintf("%.2f", r.stats.astSkew),
+				"分片下载ms", fmt.Sprintf("%.1f", r.stats.segmentFetchLatency))
+		},
+	}, nil
+}
+
+// fill 写入 DASH 指标
+func (s dashStats) fill(m *Metrics) {
+	m.DASHAvailabilitySkew = s.astSkew
+	m.DASHSegmentFetchLatency = s.segmentFetchLatency
+}
@@ -0,0 +1,209 @@
+package stream
+
+import (
+	urlpkg "net/url"
+	"testing"
+	"time"
+)
+
+func TestParseMPD(t *testing.T) {
+	base, _ := urlpkg.Parse("https://example.com/live/manifest.mpd?token=abc")
+	ast := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := ast.Add(30 * time.Second)
+
+	tests := []struct {
+		name      string
+		mpd       string
+		initURL   string
+		codec     string
+		count     int
+		firstURL  string
+		lastURL   string
+		firstKey  int64
+		firstTime int64
+		wantErr   bool
+	}{
+		{
+			name: "动态 SegmentTimeline 选择最高码率视频",
+			mpd: `<MPD type="dynamic" availabilityStartTime="2024-01-01T00:00:00Z">
+<BaseURL>https://cdn.example.com/live/</BaseURL>
+<Period start="PT0S">
+<AdaptationSet mimeType="video/mp4">
+<SegmentTemplate timescale="90000" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Time$.m4s">
+<SegmentTimeline><S t="1800000" d="180000" r="5"/></SegmentTimeline>
+</SegmentTemplate>
+<Representation id="low" bandwidth="500000" codecs="avc1.64001e"/>
+<Representation id="hi" bandwidth="1500000" codecs="avc1.64001f"/>
+</AdaptationSet>
+<AdaptationSet mimeType="audio/mp4"><Representation id="a" bandwidth="3000000"/></AdaptationSet>
+</Period></MPD>`,
+			initURL: "https://cdn.example.com/live/hi/init.mp4",
+			codec:   "avc1.64001f",
+			// 第 6 个分片结束于 32s，超过直播边缘
+			count:     5,
+			firstURL:  "https://cdn.example.com/live/hi/seg-1800000.m4s",
+			lastURL:   "https://cdn.example.com/live/hi/seg-2520000.m4s",
+			firstKey:  1800000,
+			firstTime: 1800000,
+		},
+		{
+			name: "动态 duration 模板只保留直播边缘附近的分片",
+			mpd: `<MPD type="dynamic" availabilityStartTime="2024-01-01T00:00:00Z">
+<Period start="PT0S"><AdaptationSet contentType="video">
+<SegmentTemplate timescale="90000" duration="180000" startNumber="1" initialization="init.mp4" media="num-$Number%05d$.m4s"/>
+<Representation id="v" bandwidth="1000000"/>
+</AdaptationSet></Period></MPD>`,
+			initURL:   "https://example.com/live/init.mp4",
+			count:     10,
+			firstURL:  "https://example.com/live/num-00006.m4s",
+			lastURL:   "https://example.com/live/num-00015.m4s",
+			firstKey:  6,
+			firstTime: 5 * 180000,
+		},
+		{
+			name: "静态 MPD 按总时长展开",
+			mpd: `<MPD type="static" mediaPresentationDuration="PT9S">
+<Period><AdaptationSet mimeType="video/mp4">
+<SegmentTemplate duration="2" startNumber="0" initialization="init.mp4" media="$Number$.m4s"/>
+<Representation id="v" bandwidth="1000000"/>
+</AdaptationSet></Period></MPD>`,
+			initURL:  "https://example.com/live/init.mp4",
+			count:    5,
+			firstURL: "https://example.com/live/0.m4s",
+			lastURL:  "https://example.com/live/4.m4s",
+		},
+		{
+			name: "r=-1 重复到 Period 结束",
+			mpd: `<MPD type="static">
+<Period duration="PT10S"><AdaptationSet mimeType="video/mp4">
+<SegmentTemplate initialization="init.mp4" media="$Time$.m4s"><SegmentTimeline><S t="0" d="2" r="-1"/></SegmentTimeline></SegmentTemplate>
+<Representation id="v" bandwidth="1000000"/>
+</AdaptationSet></Period></MPD>`,
+			initURL:  "https://example.com/live/init.mp4",
+			count:    5,
+			firstURL: "https://example.com/live/0.m4s",
+			lastURL:  "https://example.com/live/8.m4s",
+		},
+		{
+			name: "Representation 的模板覆盖 AdaptationSet 的模板",
+			mpd: `<MPD type="static" mediaPresentationDuration="PT4S">
+<Period><AdaptationSet mimeType="video/mp4">
+<SegmentTemplate timescale="1000" duration="2000" initialization="init.mp4" media="as-$Number$.m4s"/>
+<Representation id="v" bandwidth="1000000"><SegmentTemplate media="rep-$Bandwidth$-$Number$.m4s"/></Representation>
+</AdaptationSet></Period></MPD>`,
+			initURL:  "https://example.com/live/init.mp4",
+			count:    2,
+			firstURL: "https://example.com/live/rep-1000000-1.m4s",
+			lastURL:  "https://example.com/live/rep-1000000-2.m4s",
+			firstKey: 1,
+		},
+		{
+			name: "纯音频 MPD",
+			mpd: `<MPD type="static" mediaPresentationDuration="PT2S">
+<Period><AdaptationSet mimeType="audio/mp4">
+<SegmentTemplate duration="2" initialization="init.mp4" media="$Number$.m4s"/>
+<Representation id="a" bandwidth="64000" codecs="mp4a.40.2"/>
+</AdaptationSet></Period></MPD>`,
+			initURL:  "https://example.com/live/init.mp4",
+			codec:    "mp4a.40.2",
+			count:    1,
+			firstURL: "https://example.com/live/1.m4s",
+			lastURL:  "https://example.com/live/1.m4s",
+			firstKey: 1,
+		},
+		{name: "不是 XML", mpd: "#EXTM3U", wantErr: true},
+		{name: "没有 Period", mpd: `<MPD type="static"/>`, wantErr: true},
+		{name: "动态 MPD 缺少 availabilityStartTime", mpd: `<MPD type="dynamic"><Period/></MPD>`, wantErr: true},
+		{name: "没有音视频档位", mpd: `<MPD type="static"><Period><AdaptationSet mimeType="text/vtt"><Representation id="t"/></AdaptationSet></Period></MPD>`, wantErr: true},
+		{
+			name:    "SegmentBase 不支持",
+			mpd:     `<MPD type="static"><Period><AdaptationSet mimeType="video/mp4"><Representation id="v"/></AdaptationSet></Period></MPD>`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := parseMPD([]byte(tt.mpd), base, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if plan.initURL != tt.initURL || plan.codec != tt.codec {
+				t.Errorf("initURL=%q codec=%q, want %q %q", plan.initURL, plan.codec, tt.initURL, tt.codec)
+			}
+			if len(plan.segments) != tt.count {
+				t.Fatalf("segments = %d, want %d", len(plan.segments), tt.count)
+			}
+			first, last := plan.segments[0], plan.segments[len(plan.segments)-1]
+			if first.url != tt.firstURL || last.url != tt.lastURL {
+				t.Errorf("segments = %s ... %s, want %s ... %s", first.url, last.url, tt.firstURL, tt.lastURL)
+			}
+			if first.key != tt.firstKey || first.time != tt.firstTime {
+				t.Errorf("first key=%d time=%d, want %d %d", first.key, first.time, tt.firstKey, tt.firstTime)
+			}
+		})
+	}
+}
+
+func TestFillDASHTemplate(t *testing.T) {
+	rep := &dashRepresentation{ID: "video_1", Bandwidth: 2500000}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"$RepresentationID$/init.mp4", "video_1/init.mp4"},
+		{"seg-$Number$.m4s", "seg-42.m4s"},
+		{"seg-$Number%05d$.m4s", "seg-00042.m4s"},
+		{"$Bandwidth$/$Time$.m4s", "2500000/900000.m4s"},
+		{"t-$Time%012d$.m4s", "t-000000900000.m4s"},
+		{"price$$-$Number$.m4s", "price$-42.m4s"},
+		{"$Unknown$.m4s", "$Unknown$.m4s"},
+	}
+	for _, tt := range tests {
+		if got := fillDASHTemplate(tt.tmpl, rep, 42, 900000); got != tt.want {
+			t.Errorf("fillDASHTemplate(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"PT2S", 2 * time.Second, false},
+		{"PT1.5S", 1500 * time.Millisecond, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"PT0S", 0, false},
+		{"2S", 0, true},
+		{"PT", 0, false},
+		{"P1S", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseISODuration(tt.s)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseISODuration(%q) = %v, %v, want %v wantErr %v", tt.s, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseDASHTime(t *testing.T) {
+	want := time.Date(2024, 1, 1, 8, 0, 0, 500000000, time.UTC)
+	for _, s := range []string{"2024-01-01T08:00:00.5Z", "2024-01-01T16:00:00.5+08:00", "2024-01-01T08:00:00.5"} {
+		got, err := parseDASHTime(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseDASHTime(%q) = %v, %v", s, got, err)
+		}
+	}
+	if _, err := parseDASHTime("yesterday"); err == nil {
+		t.Error("want error")
+	}
+}
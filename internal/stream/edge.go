@@ -0,0 +1,216 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	urlpkg "net/url"
+	"sync"
+	"time"
+
+	"video-exporter/internal/config"
+	"video-exporter/internal/logger"
+)
+
+// edgeInfo 实际提供流的节点：第一个请求（流地址、播放列表、MPD 或 WHEP offer）经过的跳转链和最终响应
+type edgeInfo struct {
+	host   string   // 最终响应的主机名
+	ip     string   // 最终连接的远端 IP
+	server string   // Server 响应头
+	via    string   // Via 响应头
+	cache  string   // X-Cache 响应头
+	chain  []string // 跳转链（不含查询参数，避免记录签名），最后一项为最终地址
+	hops   int      // 跳转次数
+}
+
+// traceKey 在 context 中保存本次检查的 startupTrace
+type traceKey struct{}
+
+// traceFrom 返回 context 中的 startupTrace，没有时返回 nil
+func traceFrom(ctx context.Context) *startupTrace {
+	t, _ := ctx.Value(traceKey{}).(*startupTrace)
+	return t
+}
+
+// edgePin 多边缘检查中固定的边缘节点：发往 host 的请求直接连接 ip
+type edgePin struct {
+	host string
+	ip   string
+}
+
+// pinKey 在 context 中保存本次检查固定的边缘节点
+type pinKey struct{}
+
+// edgeTransport 记录每次请求的响应，用于还原第一个请求的跳转链和最终节点；
+// 请求 context 中固定了边缘节点时，发往该域名的请求改用直连该 IP 的连接池
+type edgeTransport struct {
+	base *http.Transport
+
+	mu     sync.Mutex
+	pinned map[string]*http.Transport // 按边缘节点 IP 单独建立的连接池，避免与按域名解析的连接混用
+}
+
+// RoundTrip 发送请求，并把响应交给请求 context 中的 startupTrace 记录
+func (e *edgeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var rt http.RoundTripper = e.base
+	if pin, ok := req.Context().Value(pinKey{}).(edgePin); ok && req.URL.Hostname() == pin.host {
+		rt = e.pinnedTransport(pin.ip)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err == nil {
+		if t := traceFrom(req.Context()); t != nil {
+			t.recordHop(req, resp)
+		}
+	}
+	return resp, err
+}
+
+// pinnedTransport 返回直连 ip 的连接池，Host 头和 TLS SNI 仍使用请求地址中的域名
+func (e *edgeTransport) pinnedTransport(ip string) *http.Transport {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if tr, ok := e.pinned[ip]; ok {
+		return tr
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	tr := e.base.Clone()
+	tr.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		_, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		return dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+	}
+	if e.pinned == nil {
+		e.pinned = make(map[string]*http.Transport)
+	}
+	e.pinned[ip] = tr
+	return tr
+}
+
+// recordHop 记录第一个请求的一跳：3xx 跳转继续记录，其他响应视为最终节点
+func (t *startupTrace) recordHop(req *http.Request, resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.edgeDone {
+		return
+	}
+
+	u := *req.URL
+	u.RawQuery, u.ForceQuery, u.Fragment = "", false, ""
+	t.edge.chain = append(t.edge.chain, u.String())
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		if resp.Header.Get("Location") != "" {
+			t.edge.hops++
+			return
+		}
+	}
+
+	t.edge.host = req.URL.Hostname()
+	if host, _, err := net.SplitHostPort(t.remoteAddr); err == nil {
+		t.edge.ip = host
+	}
+	t.edge.server = resp.Header.Get("Server")
+	t.edge.via = resp.Header.Get("Via")
+	t.edge.cache = resp.Header.Get("X-Cache")
+	t.recordTLS(t.edge.host, resp.TLS)
+	t.edgeDone = true
+}
+
+// edgeSnapshot 返回第一个请求的最终节点，请求未完成或非 HTTP 类协议时 ok 为 false
+func (t *startupTrace) edgeSnapshot() (edgeInfo, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.edge, t.edgeDone
+}
+
+// NewCheckers 为流创建检查器：未配置 edges 时只有一个（edge 标签为空，与单地址的流相同），
+// 否则 url 和每个边缘各一个，标签中的 url 和 name 都使用流的 url，以 edge 标签区分
+func NewCheckers(cfg config.StreamConfig, project string) []*Checker {
+	if len(cfg.Edges) == 0 {
+		return []*Checker{NewChecker(cfg, project)}
+	}
+
+	log := logger.Get()
+	checkers := make([]*Checker, 0, len(cfg.Edges)+1)
+	seen := make(map[string]bool)
+	for _, edge := range append([]config.EdgeConfig{{}}, cfg.Edges...) {
+		sc, err := newEdgeChecker(cfg, project, edge)
+		if err == nil && seen[sc.edgeName] {
+			err = fmt.Errorf("边缘名称重复: %s", sc.edgeName)
+		}
+		if err != nil {
+			log.Error("忽略边缘配置", "项目", project, "流ID", cfg.ID, "错误", err)
+			continue
+		}
+		seen[sc.edgeName] = true
+		checkers = append(checkers, sc)
+	}
+	return checkers
+}
+
+// newEdgeChecker 创建检查某个边缘的检查器，edge 为零值时检查流的 url
+func newEdgeChecker(cfg config.StreamConfig, project string, edge config.EdgeConfig) (*Checker, error) {
+	target := cfg
+	if edge.URL != "" {
+		target.URL = edge.URL
+		target.Protocol = edge.Protocol
+	} else if edge.Protocol != "" {
+		target.Protocol = edge.Protocol
+	}
+
+	name := edge.Name
+	if edge.IP != "" {
+		if net.ParseIP(edge.IP) == nil {
+			return nil, fmt.Errorf("无效的边缘 IP: %s", edge.IP)
+		}
+		if name == "" {
+			name = edge.IP
+		}
+	}
+	if name == "" {
+		u, err := urlpkg.Parse(target.URL)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("无效的边缘地址: %s", target.URL)
+		}
+		name = u.Host
+	}
+
+	sc := NewChecker(target, project)
+	sc.url = cfg.URL
+	sc.name = extractStreamName(project, cfg.ID, cfg.URL)
+	sc.edgeName = name
+	sc.edgeIP = edge.IP
+	sc.sign = edge.Sign
+	sc.log = sc.log.With("边缘", name)
+	return sc, nil
+}
+
+// pinEdge 把检查固定到配置的边缘节点 IP：RTMP / RTSP / SRT 直接替换地址中的主机，
+// 其他（HTTP 类）协议通过 context 只替换连接地址。未配置 IP 时原样返回
+func (sc *Checker) pinEdge(ctx context.Context, rawURL string) (context.Context, string, error) {
+	if sc.edgeIP == "" {
+		return ctx, rawURL, nil
+	}
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return nil, "", fmt.Errorf("无效的地址: %w", err)
+	}
+
+	if sc.protocol != ProtocolRTMP && sc.protocol != ProtocolRTSP && sc.protocol != ProtocolSRT {
+		return context.WithValue(ctx, pinKey{}, edgePin{host: u.Hostname(), ip: sc.edgeIP}), rawURL, nil
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(sc.edgeIP, port)
+	} else if net.ParseIP(sc.edgeIP).To4() == nil {
+		u.Host = "[" + sc.edgeIP + "]"
+	} else {
+		u.Host = sc.edgeIP
+	}
+	return ctx, u.String(), nil
+}
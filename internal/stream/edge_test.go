@@ -0,0 +1,158 @@
+package stream
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"video-exporter/internal/config"
+)
+
+func TestEdgeTraceRedirectChain(t *testing.T) {
+	final := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("Via", "1.1 edge-a (cache)")
+		w.Header().Set("X-Cache", "HIT from edge-a")
+		w.Write([]byte("ok"))
+	}))
+	defer final.Close()
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, final.URL+"/live/a.flv?token=final", http.StatusMovedPermanently)
+	}))
+	defer second.Close()
+	first := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "gslb")
+		http.Redirect(w, r, second.URL+"/live/a.flv?token=second", http.StatusFound)
+	}))
+	defer first.Close()
+
+	client := newTraceTestClient(first)
+	trace := &startupTrace{start: time.Now()}
+	traceGet(t, client, trace, first.URL+"/live/a.flv?token=first")
+	// 第一个请求完成后的请求（例如分片）不再记录
+	traceGet(t, client, trace, second.URL+"/live/b.flv")
+
+	edge, ok := trace.edgeSnapshot()
+	if !ok {
+		t.Fatal("没有记录最终节点")
+	}
+	wantChain := []string{first.URL + "/live/a.flv", second.URL + "/live/a.flv", final.URL + "/live/a.flv"}
+	if !slices.Equal(edge.chain, wantChain) {
+		t.Errorf("chain = %v, want %v", edge.chain, wantChain)
+	}
+	if edge.hops != 2 {
+		t.Errorf("hops = %d, want 2", edge.hops)
+	}
+	if edge.host != "127.0.0.1" || edge.ip != "127.0.0.1" {
+		t.Errorf("host, ip = %q, %q, want 127.0.0.1", edge.host, edge.ip)
+	}
+	if edge.server != "nginx" || edge.via != "1.1 edge-a (cache)" || edge.cache != "HIT from edge-a" {
+		t.Errorf("server, via, cache = %q, %q, %q", edge.server, edge.via, edge.cache)
+	}
+	if _, ok := trace.tlsSnapshot(); ok {
+		t.Error("HTTP 请求不应记录证书信息")
+	}
+}
+
+func TestEdgeTransportPinned(t *testing.T) {
+	var gotHost, gotSNI string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost, gotSNI = r.Host, r.TLS.ServerName
+		w.Header().Set("X-Cache", "MISS")
+	}))
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+
+	// 连接按固定的 IP 建立，Host 头和 SNI 仍为 example.com（httptest 的证书包含 example.com）
+	client := newTraceTestClient(srv)
+	trace := &startupTrace{start: time.Now()}
+	ctx := context.WithValue(t.Context(), pinKey{}, edgePin{host: "example.com", ip: "127.0.0.1"})
+	req, _ := http.NewRequestWithContext(trace.withContext(ctx), "GET", "https://example.com:"+port+"/live/a.m3u8", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if gotHost != "example.com:"+port || gotSNI != "example.com" {
+		t.Errorf("Host, SNI = %q, %q, want example.com:%s, example.com", gotHost, gotSNI, port)
+	}
+	edge, _ := trace.edgeSnapshot()
+	if edge.host != "example.com" || edge.ip != "127.0.0.1" || edge.cache != "MISS" || edge.hops != 0 {
+		t.Errorf("edge = %+v", edge)
+	}
+	if info, ok := trace.tlsSnapshot(); !ok || !info.hostMatch || info.version == "" {
+		t.Errorf("tlsInfo = %+v, %v, want hostMatch", info, ok)
+	}
+
+	tr := client.Transport.(*edgeTransport)
+	if tr.pinnedTransport("127.0.0.1") != tr.pinned["127.0.0.1"] || len(tr.pinned) != 1 {
+		t.Error("同一 IP 应复用连接池")
+	}
+}
+
+func TestPinEdge(t *testing.T) {
+	tests := []struct {
+		name     string
+		protocol string
+		ip       string
+		url      string
+		wantURL  string
+		wantPin  *edgePin
+	}{
+		{name: "未配置 IP", protocol: ProtocolRTMP, url: "rtmp://live.example.com/app/a", wantURL: "rtmp://live.example.com/app/a"},
+		{name: "RTMP 替换主机", protocol: ProtocolRTMP, ip: "10.0.0.1", url: "rtmp://live.example.com/app/a?k=v", wantURL: "rtmp://10.0.0.1/app/a?k=v"},
+		{name: "RTSP 保留端口", protocol: ProtocolRTSP, ip: "10.0.0.1", url: "rtsp://user:pw@cam.example.com:8554/a", wantURL: "rtsp://user:pw@10.0.0.1:8554/a"},
+		{name: "SRT IPv6", protocol: ProtocolSRT, ip: "2001:db8::1", url: "srt://live.example.com:9000?streamid=a", wantURL: "srt://[2001:db8::1]:9000?streamid=a"},
+		{name: "RTMP IPv6 无端口", protocol: ProtocolRTMP, ip: "2001:db8::1", url: "rtmp://live.example.com/app/a", wantURL: "rtmp://[2001:db8::1]/app/a"},
+		{
+			name: "HTTP 类协议只固定连接", protocol: ProtocolHLS, ip: "10.0.0.1", url: "https://cdn.example.com/live/a.m3u8",
+			wantURL: "https://cdn.example.com/live/a.m3u8", wantPin: &edgePin{host: "cdn.example.com", ip: "10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := &Checker{protocol: tt.protocol, edgeIP: tt.ip}
+			ctx, got, err := sc.pinEdge(t.Context(), tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.wantURL {
+				t.Errorf("url = %q, want %q", got, tt.wantURL)
+			}
+			pin, ok := ctx.Value(pinKey{}).(edgePin)
+			if ok != (tt.wantPin != nil) || ok && pin != *tt.wantPin {
+				t.Errorf("pin = %+v, %v, want %+v", pin, ok, tt.wantPin)
+			}
+		})
+	}
+}
+
+func TestNewCheckers(t *testing.T) {
+	cfg := config.StreamConfig{
+		ID:  "a",
+		URL: "https://cdn.example.com/live/a.flv",
+		Edges: []config.EdgeConfig{
+			{IP: "10.0.0.1"},
+			{Name: "backup", URL: "rtmp://backup.example.com/live/a"},
+			{IP: "not-an-ip"},
+			{Name: "10.0.0.1", IP: "10.0.0.2"}, // 与第一个边缘重名
+			{URL: "https://other.example.com:8443/live/a.flv"},
+		},
+	}
+	var names []string
+	for _, sc := range NewCheckers(cfg, "test") {
+		names = append(names, sc.edgeName)
+		if sc.url != cfg.URL {
+			t.Errorf("%s: url = %q, want %q", sc.edgeName, sc.url, cfg.URL)
+		}
+	}
+	want := []string{"cdn.example.com", "10.0.0.1", "backup", "other.example.com:8443"}
+	if !slices.Equal(names, want) {
+		t.Errorf("edge names = %v, want %v", names, want)
+	}
+}
@@ -0,0 +1,239 @@
+package stream
+
+import (
+	"time"
+
+	"github.com/nareix/joy5/format/flv/flvio"
+)
+
+// Enhanced FLV（E-RTMP）ExVideoTagHeader 的 VideoPacketType
+const (
+	flvExSequenceStart        = 0
+	flvExCodedFrames          = 1
+	flvExSequenceEnd          = 2
+	flvExCodedFramesX         = 3 // 没有 CompositionTime，CTS 为 0
+	flvExMetadata             = 4
+	flvExMPEG2TSSequenceStart = 5
+)
+
+// flvReader 按 FLV tag 输出 Packet（HTTP-FLV 和 RTMP 共用）。
+// 除 AVC / AAC 外还支持 legacy HEVC（CodecID 12）、MP3 和 Enhanced FLV 的音视频 FourCC
+type flvReader struct {
+	readTag func() (flvio.Tag, error)
+}
+
+// ReadPacket 读取下一个可识别的数据包，跳过不支持的 tag
+func (r *flvReader) ReadPacket() (Packet, error) {
+	for {
+		tag, err := r.readTag()
+		if err != nil {
+			return Packet{}, err
+		}
+
+		var pkt Packet
+		var ok bool
+		switch tag.Type {
+		case flvio.TAG_AMF0:
+			pkt, ok = Packet{Kind: PacketMetadata, Data: tag.Data, DTS: flvTime(tag.Time)}, true
+		case flvio.TAG_VIDEO:
+			pkt, ok = parseFLVVideo(tag)
+		case flvio.TAG_AUDIO:
+			pkt, ok = parseFLVAudio(tag)
+		}
+		if ok {
+			return pkt, nil
+		}
+	}
+}
+
+// parseFLVVideo 解析视频 tag，ok 为 false 表示不支持或无需输出
+func parseFLVVideo(tag flvio.Tag) (Packet, bool) {
+	// joy5 已按 legacy 格式解析了头部，Header 与 Data 在同一块内存中连续存放，这里还原完整 tag 数据重新解析
+	raw := tag.Header[:len(tag.Header)+len(tag.Data)]
+	if len(raw) == 0 {
+		return Packet{}, false
+	}
+
+	dts := flvTime(tag.Time)
+	if raw[0]&0x80 != 0 {
+		return parseFLVExVideo(raw, dts)
+	}
+
+	// legacy 格式：FrameType(4) + CodecID(4) + AVCPacketType(8) + CompositionTime(24)
+	var codec string
+	switch tag.VideoFormat {
+	case flvio.VIDEO_H264:
+		codec = "H264"
+	case flvio.VIDEO_H265:
+		codec = "H265"
+	default:
+		return Packet{}, false
+	}
+
+	pkt := Packet{Codec: codec, DTS: dts, Data: tag.Data}
+	switch tag.AVCPacketType {
+	case flvio.AVC_SEQHDR:
+		pkt.Kind = PacketConfig
+	case flvio.AVC_NALU:
+		pkt.Kind = PacketVideo
+		pkt.KeyFrame = tag.FrameType == flvio.FRAME_KEY
+		pkt.CTS = time.Duration(tag.CTime) * time.Millisecond
+	default:
+		return Packet{}, false
+	}
+	return pkt, true
+}
+
+// parseFLVExVideo 解析 Enhanced FLV 的 ExVideoTagHeader：
+// IsExHeader(1) + FrameType(3) + VideoPacketType(4) + FourCC(32)，
+// avc1 / hvc1 的 CodedFrames 之后还有 24 位 CompositionTime
+func parseFLVExVideo(raw []byte, dts time.Duration) (Packet, bool) {
+	frameType := raw[0] >> 4 & 0x07
+	packetType := raw[0] & 0x0f
+	if len(raw) < 5 {
+		return Packet{}, false
+	}
+	fourCC := string(raw[1:5])
+	data := raw[5:]
+
+	codec := mp4CodecName(fourCC)
+	switch codec {
+	case "H264", "H265", "AV1", "VP9":
+	default:
+		return Packet{}, false
+	}
+
+	pkt := Packet{Codec: codec, DTS: dts}
+	switch packetType {
+	case flvExSequenceStart, flvExMPEG2TSSequenceStart:
+		pkt.Kind = PacketConfig
+	case flvExCodedFrames:
+		if fourCC == "avc1" || fourCC == "hvc1" {
+			if len(data) < 3 {
+				return Packet{}, false
+			}
+			// SI24 CompositionTime
+			cts := int32(uint32(data[0])<<16|uint32(data[1])<<8|uint32(data[2])) << 8 >> 8
+			pkt.CTS = time.Duration(cts) * time.Millisecond
+			data = data[3:]
+		}
+		fallthrough
+	case flvExCodedFramesX:
+		pkt.Kind = PacketVideo
+		pkt.KeyFrame = frameType == flvio.FRAME_KEY
+	default:
+		// SequenceEnd、Metadata、Multitrack 等不参与统计
+		return Packet{}, false
+	}
+	pkt.Data = data
+	return pkt, true
+}
+
+// Enhanced FLV（E-RTMP v2）ExAudioTagHeader 的 SoundFormat 和 AudioPacketType
+const (
+	flvSoundFormatExHeader  = 9
+	flvSoundMP38KHz         = 14
+	flvExAudioSequenceStart = 0
+	flvExAudioCodedFrames   = 1
+)
+
+// parseFLVAudio 解析音频 tag：legacy 格式支持 AAC 和 MP3，
+// Enhanced FLV 按 FourCC 支持 mp4a / .mp3 / Opus / ac-3 / ec-3 / fLaC
+func parseFLVAudio(tag flvio.Tag) (Packet, bool) {
+	dts := flvTime(tag.Time)
+	switch tag.SoundFormat {
+	case flvio.SOUND_AAC:
+		pkt := Packet{Codec: "AAC", DTS: dts, Data: tag.Data}
+		switch tag.AACPacketType {
+		case flvio.AAC_SEQHDR:
+			pkt.Kind = PacketConfig
+		case flvio.AAC_RAW:
+			pkt.Kind = PacketAudio
+		default:
+			return Packet{}, false
+		}
+		return pkt, true
+	case flvio.SOUND_MP3, flvSoundMP38KHz:
+		return Packet{Kind: PacketAudio, Codec: "MP3", DTS: dts, Data: tag.Data}, true
+	case flvSoundFormatExHeader:
+		// joy5 只解析了 1 字节头部，与视频一样还原完整 tag 数据：SoundFormat(4) + AudioPacketType(4) + FourCC(32)
+		raw := tag.Header[:len(tag.Header)+len(tag.Data)]
+		if len(raw) < 5 {
+			return Packet{}, false
+		}
+		codec := audioCodecName(string(raw[1:5]))
+		if codec == "" {
+			return Packet{}, false
+		}
+		pkt := Packet{Codec: codec, DTS: dts, Data: raw[5:]}
+		switch raw[0] & 0x0f {
+		case flvExAudioSequenceStart:
+			pkt.Kind = PacketConfig
+		case flvExAudioCodedFrames:
+			pkt.Kind = PacketAudio
+		default:
+			// SequenceEnd、MultichannelConfig、Multitrack 等不参与统计
+			return Packet{}, false
+		}
+		return pkt, true
+	}
+	return Packet{}, false
+}
+
+// parseOnMetaData 解析 onMetaData 脚本 tag（AMF0），返回其中的属性表；
+// 其他脚本 tag（如 onCuePoint）返回 false
+func parseOnMetaData(data []byte) (flvio.AMFMap, bool) {
+	// 解析出错时已解析出的值仍然可用
+	vals, _ := flvio.ParseAMFVals(data, false)
+	isMetaData := false
+	for _, v := range vals {
+		switch v := v.(type) {
+		case string:
+			// 直接写入的是 onMetaData，经 RTMP @setDataFrame 转发的是 @setDataFrame + onMetaData
+			if v == "onMetaData" {
+				isMetaData = true
+			}
+		case flvio.AMFMap:
+			if isMetaData {
+				return v, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// metadataInfo onMetaData 中声明的编码参数
+type metadataInfo struct {
+	width         int
+	height        int
+	framerate     float64
+	videoDataRate float64 // 视频码率（kbps）
+	audioDataRate float64 // 音频码率（kbps）
+	encoder       string
+}
+
+// parseMetadataInfo 从 onMetaData 中取出编码参数，没有任何可用字段时返回 false
+func parseMetadataInfo(data []byte) (metadataInfo, bool) {
+	meta, ok := parseOnMetaData(data)
+	if !ok {
+		return metadataInfo{}, false
+	}
+
+	var info metadataInfo
+	if v, ok := meta.GetFloat64("width"); ok {
+		info.width = int(v)
+	}
+	if v, ok := meta.GetFloat64("height"); ok {
+		info.height = int(v)
+	}
+	info.framerate, _ = meta.GetFloat64("framerate")
+	info.videoDataRate, _ = meta.GetFloat64("videodatarate")
+	info.audioDataRate, _ = meta.GetFloat64("audiodatarate")
+	info.encoder, _ = meta.GetString("encoder")
+	return info, info != metadataInfo{}
+}
+
+// flvTime 把 FLV 毫秒时间戳转换为 time.Duration
+func flvTime(ts uint32) time.Duration {
+	return time.Duration(ts) * time.Millisecond
+}
@@ -0,0 +1,490 @@
+package stream
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// mp4Track 初始化分片（moov）中的轨道信息
+type mp4Track struct {
+	id         uint32
+	handler    string // vide / soun
+	timescale  uint32
+	codec      string // avc1 / avc3 / hvc1 / hev1 / mp4a ...
+	lengthSize int    // NALU 长度字段字节数（来自 avcC / hvcC）
+	paramSets  []byte // avcC / hvcC 中的参数集（Annex-B 格式），补在关键帧前
+
+	audioConfig []byte // esds 中的 AudioSpecificConfig 或 Opus 的 dOps
+
+	// trex 中的默认值
+	defaultDuration uint32
+	defaultSize     uint32
+	defaultFlags    uint32
+}
+
+// mp4Init 解析后的初始化分片
+type mp4Init struct {
+	tracks map[uint32]*mp4Track
+}
+
+// mp4Sample 媒体分片中的一个样本
+type mp4Sample struct {
+	track    *mp4Track
+	dts      int64 // 解码时间（轨道 timescale 单位）
+	cts      int64 // 显示时间偏移（轨道 timescale 单位）
+	duration uint32
+	keyFrame bool
+	data     []byte
+}
+
+// mp4Boxes 依次回调 data 中的 box，offset 为 box 在 data 中的起始位置
+func mp4Boxes(data []byte, fn func(typ string, body []byte, offset int) error) error {
+	offset := 0
+	for len(data)-offset >= 8 {
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		typ := string(data[offset+4 : offset+8])
+		header := uint64(8)
+		switch size {
+		case 0:
+			size = uint64(len(data) - offset)
+		case 1:
+			if len(data)-offset < 16 {
+				return fmt.Errorf("box 长度无效: %s", typ)
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+			header = 16
+		}
+		if size < header || size > uint64(len(data)-offset) {
+			return fmt.Errorf("box 长度无效: %s", typ)
+		}
+		if err := fn(typ, data[offset+int(header):offset+int(size)], offset); err != nil {
+			return err
+		}
+		offset += int(size)
+	}
+	return nil
+}
+
+// parseMP4Init 解析初始化分片，提取轨道的 timescale、编码和 trex 默认值
+func parseMP4Init(data []byte) (*mp4Init, error) {
+	init := &mp4Init{tracks: make(map[uint32]*mp4Track)}
+	var trex [][]byte
+
+	err := mp4Boxes(data, func(typ string, body []byte, _ int) error {
+		if typ != "moov" {
+			return nil
+		}
+		return mp4Boxes(body, func(typ string, body []byte, _ int) error {
+			switch typ {
+			case "trak":
+				t, err := parseMP4Trak(body)
+				if err != nil {
+					return err
+				}
+				init.tracks[t.id] = t
+			case "mvex":
+				return mp4Boxes(body, func(typ string, body []byte, _ int) error {
+					if typ == "trex" {
+						trex = append(trex, body)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(init.tracks) == 0 {
+		return nil, fmt.Errorf("初始化分片中没有轨道")
+	}
+
+	for _, b := range trex {
+		if len(b) < 24 {
+			continue
+		}
+		if t, ok := init.tracks[binary.BigEndian.Uint32(b[4:])]; ok {
+			t.defaultDuration = binary.BigEndian.Uint32(b[12:])
+			t.defaultSize = binary.BigEndian.Uint32(b[16:])
+			t.defaultFlags = binary.BigEndian.Uint32(b[20:])
+		}
+	}
+	return init, nil
+}
+
+// parseMP4Trak 解析 trak：tkhd（轨道 ID）、mdhd（timescale）、hdlr（类型）、stsd（编码）
+func parseMP4Trak(data []byte) (*mp4Track, error) {
+	t := &mp4Track{lengthSize: 4}
+
+	var walk func(data []byte) error
+	walk = func(data []byte) error {
+		return mp4Boxes(data, func(typ string, body []byte, _ int) error {
+			switch typ {
+			case "mdia", "minf", "stbl":
+				return walk(body)
+			case "tkhd":
+				if len(body) > 0 && body[0] == 1 && len(body) >= 24 {
+					t.id = binary.BigEndian.Uint32(body[20:])
+				} else if len(body) >= 16 {
+					t.id = binary.BigEndian.Uint32(body[12:])
+				}
+			case "mdhd":
+				if len(body) > 0 && body[0] == 1 && len(body) >= 24 {
+					t.timescale = binary.BigEndian.Uint32(body[20:])
+				} else if len(body) >= 16 {
+					t.timescale = binary.BigEndian.Uint32(body[12:])
+				}
+			case "hdlr":
+				if len(body) >= 12 {
+					t.handler = string(body[8:12])
+				}
+			case "stsd":
+				if len(body) >= 8 {
+					return parseMP4SampleEntry(t, body[8:])
+				}
+			}
+			return nil
+		})
+	}
+	if err := walk(data); err != nil {
+		return nil, err
+	}
+	if t.timescale == 0 {
+		return nil, fmt.Errorf("轨道 %d 缺少 timescale", t.id)
+	}
+	return t, nil
+}
+
+// parseMP4SampleEntry 读取第一个样本描述的编码类型和 NALU 长度字段大小
+func parseMP4SampleEntry(t *mp4Track, data []byte) error {
+	return mp4Boxes(data, func(typ string, body []byte, _ int) error {
+		if t.codec != "" {
+			return nil
+		}
+		t.codec = typ
+		// AudioSampleEntry 固定部分 28 字节，之后是 esds / dOps 等子 box
+		if t.handler == "soun" && len(body) >= 28 {
+			return mp4Boxes(body[28:], func(typ string, body []byte, _ int) error {
+				switch typ {
+				case "esds":
+					t.audioConfig = esdsAudioConfig(body)
+				case "dOps":
+					t.audioConfig = body
+				}
+				return nil
+			})
+		}
+		// VisualSampleEntry 固定部分 78 字节，之后是 avcC / hvcC 等子 box
+		if t.handler != "vide" || len(body) < 78 {
+			return nil
+		}
+		return mp4Boxes(body[78:], func(typ string, body []byte, _ int) error {
+			switch typ {
+			case "avcC":
+				if len(body) >= 5 {
+					t.lengthSize = int(body[4]&0x03) + 1
+				}
+				t.paramSets = annexB(configRecordNALUs("H264", body))
+			case "hvcC":
+				if len(body) >= 22 {
+					t.lengthSize = int(body[21]&0x03) + 1
+				}
+				t.paramSets = annexB(configRecordNALUs("H265", body))
+			}
+			return nil
+		})
+	})
+}
+
+// esdsAudioConfig 从 esds（FullBox + ES_Descriptor）中取出 DecoderSpecificInfo，即 AudioSpecificConfig
+func esdsAudioConfig(body []byte) []byte {
+	if len(body) < 4 {
+		return nil
+	}
+	b := body[4:]
+	for len(b) >= 2 {
+		tag := b[0]
+		// 描述符长度为 1~4 字节的变长编码
+		size, n := 0, 1
+		for ; n <= 4 && n < len(b); n++ {
+			size = size<<7 | int(b[n]&0x7f)
+			if b[n]&0x80 == 0 {
+				break
+			}
+		}
+		n++
+		if n+size > len(b) {
+			return nil
+		}
+		payload := b[n : n+size]
+
+		switch tag {
+		case 0x03: // ES_Descriptor: ES_ID(16) + flags(8) [+ dependsOn_ES_ID(16)] [+ URL] [+ OCR_ES_Id(16)]
+			if len(payload) < 3 {
+				return nil
+			}
+			flags := payload[2]
+			skip := 3
+			if flags&0x80 != 0 {
+				skip += 2
+			}
+			if flags&0x40 != 0 && skip < len(payload) {
+				skip += 1 + int(payload[skip])
+			}
+			if flags&0x20 != 0 {
+				skip += 2
+			}
+			if skip > len(payload) {
+				return nil
+			}
+			b = payload[skip:]
+		case 0x04: // DecoderConfigDescriptor: 固定 13 字节后是 DecoderSpecificInfo
+			if len(payload) < 13 {
+				return nil
+			}
+			b = payload[13:]
+		case 0x05: // DecoderSpecificInfo
+			return payload
+		default:
+			b = b[n+size:]
+		}
+	}
+	return nil
+}
+
+// parseMP4Fragment 解析媒体分片（moof + mdat），按 trun 还原每个样本
+func parseMP4Fragment(data []byte, init *mp4Init) ([]mp4Sample, error) {
+	var samples []mp4Sample
+	err := mp4Boxes(data, func(typ string, body []byte, offset int) error {
+		if typ != "moof" {
+			return nil
+		}
+		moofStart := offset
+		return mp4Boxes(body, func(typ string, body []byte, _ int) error {
+			if typ != "traf" {
+				return nil
+			}
+			s, err := parseMP4Traf(body, data, moofStart, init)
+			samples = append(samples, s...)
+			return err
+		})
+	})
+	return samples, err
+}
+
+// parseMP4Traf 解析一个轨道分片，数据偏移相对 moof 起始位置（default-base-is-moof）
+func parseMP4Traf(traf, segment []byte, moofStart int, init *mp4Init) ([]mp4Sample, error) {
+	var t *mp4Track
+	var baseOffset int64 = int64(moofStart)
+	var defaultDuration, defaultSize, defaultFlags uint32
+	var baseTime int64
+	var samples []mp4Sample
+
+	err := mp4Boxes(traf, func(typ string, body []byte, _ int) error {
+		switch typ {
+		case "tfhd":
+			if len(body) < 8 {
+				return fmt.Errorf("tfhd 长度无效")
+			}
+			flags := binary.BigEndian.Uint32(body) & 0xFFFFFF
+			var ok bool
+			if t, ok = init.tracks[binary.BigEndian.Uint32(body[4:])]; !ok {
+				return nil
+			}
+			defaultDuration, defaultSize, defaultFlags = t.defaultDuration, t.defaultSize, t.defaultFlags
+			p := body[8:]
+			read := func() uint32 {
+				if len(p) < 4 {
+					return 0
+				}
+				v := binary.BigEndian.Uint32(p)
+				p = p[4:]
+				return v
+			}
+			if flags&0x01 != 0 && len(p) >= 8 {
+				baseOffset = int64(binary.BigEndian.Uint64(p))
+				p = p[8:]
+			}
+			if flags&0x02 != 0 {
+				read() // sample_description_index
+			}
+			if flags&0x08 != 0 {
+				defaultDuration = read()
+			}
+			if flags&0x10 != 0 {
+				defaultSize = read()
+			}
+			if flags&0x20 != 0 {
+				defaultFlags = read()
+			}
+		case "tfdt":
+			if len(body) >= 12 && body[0] == 1 {
+				baseTime = int64(binary.BigEndian.Uint64(body[4:]))
+			} else if len(body) >= 8 {
+				baseTime = int64(binary.BigEndian.Uint32(body[4:]))
+			}
+		case "trun":
+			if t == nil {
+				return nil
+			}
+			s, err := parseMP4Trun(body, segment, baseOffset, baseTime, t, defaultDuration, defaultSize, defaultFlags)
+			if err != nil {
+				return err
+			}
+			samples = append(samples, s...)
+			if n := len(s); n > 0 {
+				// 同一 traf 中的多个 trun 时间连续
+				baseTime = s[n-1].dts + int64(s[n-1].duration)
+			}
+		}
+		return nil
+	})
+	return samples, err
+}
+
+// parseMP4Trun 按 trun 的字段标志读取样本时长、大小、标志和显示时间偏移
+func parseMP4Trun(body, segment []byte, baseOffset, baseTime int64, t *mp4Track, defaultDuration, defaultSize, defaultFlags uint32) ([]mp4Sample, error) {
+	if len(body) < 8 {
+		return nil, fmt.Errorf("trun 长度无效")
+	}
+	version := body[0]
+	flags := binary.BigEndian.Uint32(body) & 0xFFFFFF
+	count := binary.BigEndian.Uint32(body[4:])
+	p := body[8:]
+	read := func() uint32 {
+		if len(p) < 4 {
+			return 0
+		}
+		v := binary.BigEndian.Uint32(p)
+		p = p[4:]
+		return v
+	}
+
+	offset := baseOffset
+	if flags&0x01 != 0 {
+		offset += int64(int32(read()))
+	}
+	firstFlags, hasFirstFlags := uint32(0), flags&0x04 != 0
+	if hasFirstFlags {
+		firstFlags = read()
+	}
+
+	samples := make([]mp4Sample, 0, count)
+	dts := baseTime
+	for i := uint32(0); i < count; i++ {
+		s := mp4Sample{track: t, dts: dts, duration: defaultDuration}
+		size := defaultSize
+		sampleFlags := defaultFlags
+		if flags&0x100 != 0 {
+			s.duration = read()
+		}
+		if flags&0x200 != 0 {
+			size = read()
+		}
+		if flags&0x400 != 0 {
+			sampleFlags = read()
+		}
+		if i == 0 && hasFirstFlags {
+			sampleFlags = firstFlags
+		}
+		if flags&0x800 != 0 {
+			if version == 0 {
+				s.cts = int64(read())
+			} else {
+				s.cts = int64(int32(read()))
+			}
+		}
+
+		if offset < 0 || offset+int64(size) > int64(len(segment)) {
+			return samples, fmt.Errorf("样本数据超出分片范围")
+		}
+		s.data = segment[offset : offset+int64(size)]
+		offset += int64(size)
+
+		// sample_is_non_sync_sample 为 0 表示同步样本（关键帧）
+		s.keyFrame = sampleFlags&0x00010000 == 0
+		samples = append(samples, s)
+		dts += int64(s.duration)
+	}
+	return samples, nil
+}
+
+// packet 把样本转换为 av.Packet，视频 NALU 转为 Annex-B 格式
+func (s *mp4Sample) packet() av.Packet {
+	pkt := av.Packet{
+		Time:  mp4Duration(s.dts, s.track.timescale),
+		CTime: mp4Duration(s.cts, s.track.timescale),
+	}
+	if s.track.handler == "vide" {
+		// 统一以 av.H264 类型进入采样循环，实际编码由 mp4Track.codec 给出
+		pkt.Type = av.H264
+		pkt.IsKeyFrame = s.keyFrame
+		pkt.Data = s.data
+		if codec := mp4CodecName(s.track.codec); codec == "H264" || codec == "H265" {
+			pkt.Data = lengthPrefixedToAnnexB(s.data, s.track.lengthSize)
+			// 与 MPEG-TS 一致，参数集随关键帧带内传输，便于从中解析 SPS
+			if s.keyFrame && len(s.track.paramSets) > 0 {
+				pkt.Data = append(append([]byte{}, s.track.paramSets...), pkt.Data...)
+			}
+		}
+	} else {
+		pkt.Type = av.AAC
+		pkt.Data = s.data
+	}
+	return pkt
+}
+
+// mp4Duration 把 timescale 单位的时间转换为 time.Duration，
+// 先拆分整秒再换算，避免直播流基于纪元的大 tfdt 溢出
+func mp4Duration(v int64, timescale uint32) time.Duration {
+	scale := int64(timescale)
+	return time.Duration(v/scale)*time.Second + time.Duration(v%scale)*time.Second/time.Duration(scale)
+}
+
+// lengthPrefixedToAnnexB 把长度前缀的 NALU 序列转换为起始码分隔
+func lengthPrefixedToAnnexB(data []byte, lengthSize int) []byte {
+	out := make([]byte, 0, len(data)+16)
+	for len(data) >= lengthSize {
+		n := 0
+		for _, b := range data[:lengthSize] {
+			n = n<<8 | int(b)
+		}
+		data = data[lengthSize:]
+		if n > len(data) {
+			break
+		}
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, data[:n]...)
+		data = data[n:]
+	}
+	return out
+}
+
+// annexB 把 NALU 列表拼接为起始码分隔的格式
+func annexB(nalus [][]byte) []byte {
+	var out []byte
+	for _, nalu := range nalus {
+		out = append(out, 0, 0, 0, 1)
+		out = append(out, nalu...)
+	}
+	return out
+}
+
+// mp4CodecName 把样本描述类型转换为指标中使用的编码名称
+func mp4CodecName(codec string) string {
+	switch codec {
+	case "avc1", "avc3":
+		return "H264"
+	case "hvc1", "hev1":
+		return "H265"
+	case "av01":
+		return "AV1"
+	case "vp09":
+		return "VP9"
+	}
+	return codec
+}
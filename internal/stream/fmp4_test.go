@@ -0,0 +1,254 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// testMP4SPS 1280x720 High@3.1 的 SPS
+var testMP4SPS, _ = hex.DecodeString("6764001facd9405005bb011000000300100000030320f1831960")
+
+// mp4TestBox 拼接 box 内容并加上 8 字节头
+func mp4TestBox(typ string, parts ...[]byte) []byte {
+	body := bytes.Join(parts, nil)
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], typ)
+	return append(out, body...)
+}
+
+// mp4U32 把若干 uint32 编码为大端字节
+func mp4U32(v ...uint32) []byte {
+	out := make([]byte, 4*len(v))
+	for i, x := range v {
+		binary.BigEndian.PutUint32(out[i*4:], x)
+	}
+	return out
+}
+
+// mp4TestTrak 构造 trak，entry 为 stsd 中唯一的样本描述
+func mp4TestTrak(id uint32, handler string, timescale uint32, entry []byte) []byte {
+	tkhd := mp4TestBox("tkhd", mp4U32(0, 0, 0, id), make([]byte, 68))
+	mdhd := mp4TestBox("mdhd", mp4U32(0, 0, 0, timescale, 0, 0))
+	hdlr := mp4TestBox("hdlr", mp4U32(0, 0), []byte(handler), make([]byte, 13))
+	stsd := mp4TestBox("stsd", mp4U32(0, 1), entry)
+	return mp4TestBox("trak", tkhd, mp4TestBox("mdia", mdhd, hdlr, mp4TestBox("minf", mp4TestBox("stbl", stsd))))
+}
+
+// genMP4Init 生成初始化分片：轨道 1 为 H.264（90kHz），轨道 2 为 48kHz 立体声 AAC-LC（trex 默认时长 1024）
+func genMP4Init() []byte {
+	avcC := mp4TestBox("avcC", []byte{1, 0x64, 0, 0x1f, 0xff, 0xe1, 0, byte(len(testMP4SPS))}, testMP4SPS, []byte{1, 0, 4, 0x68, 0xce, 0x38, 0x80})
+	avc1 := mp4TestBox("avc1", make([]byte, 78), avcC)
+
+	dsi := []byte{0x05, 2, 0x11, 0x90}
+	dcd := append([]byte{0x04, byte(13 + len(dsi)), 0x40, 0x15}, make([]byte, 11)...)
+	es := append(append([]byte{0x03, byte(3 + len(dcd) + len(dsi) + 3), 0, 1, 0}, dcd...), dsi...)
+	es = append(es, 0x06, 1, 2)
+	mp4a := mp4TestBox("mp4a", make([]byte, 28), mp4TestBox("esds", mp4U32(0), es))
+
+	mvex := mp4TestBox("mvex",
+		mp4TestBox("trex", mp4U32(0, 1, 1, 0, 0, 0)),
+		mp4TestBox("trex", mp4U32(0, 2, 1, 1024, 0, 0)))
+	return append(mp4TestBox("ftyp", []byte("iso6"), mp4U32(0)),
+		mp4TestBox("moov", mp4TestBox("mvhd", make([]byte, 100)),
+			mp4TestTrak(1, "vide", 90000, avc1), mp4TestTrak(2, "soun", 48000, mp4a), mvex)...)
+}
+
+// genMP4Fragment 生成从 baseTime（90kHz）开始的 2 秒媒体分片：
+// 50 个 25fps 视频帧（首帧为关键帧，显示时间偏移一帧）+ 94 个 200 字节的 AAC 帧
+func genMP4Fragment(baseTime uint64) []byte {
+	const frames, audioFrames = 50, 94
+	var vdata, adata []byte
+	var vsizes []uint32
+	for i := 0; i < frames; i++ {
+		nalType := byte(1)
+		if i == 0 {
+			nalType = 5
+		}
+		nalu := append([]byte{nalType}, bytes.Repeat([]byte{0xab}, 3000)...)
+		vdata = append(vdata, mp4U32(uint32(len(nalu)))...)
+		vdata = append(vdata, nalu...)
+		vsizes = append(vsizes, uint32(4+len(nalu)))
+	}
+	adata = bytes.Repeat([]byte{0x21}, 200*audioFrames)
+
+	tfdt := func(t uint64) []byte {
+		return mp4TestBox("tfdt", []byte{1, 0, 0, 0}, binary.BigEndian.AppendUint64(nil, t))
+	}
+	build := func(videoOffset, audioOffset uint32) []byte {
+		trun := mp4U32(0x000F01, frames, videoOffset)
+		for i, size := range vsizes {
+			flags := uint32(0x00010000) // sample_is_non_sync_sample
+			if i == 0 {
+				flags = 0x02000000
+			}
+			trun = append(trun, mp4U32(3600, size, flags, 3600)...)
+		}
+		video := mp4TestBox("traf", mp4TestBox("tfhd", mp4U32(0x020000, 1)), tfdt(baseTime), mp4TestBox("trun", trun))
+		// 音频使用 tfhd 中的默认样本大小和 trex 中的默认时长
+		audio := mp4TestBox("traf", mp4TestBox("tfhd", mp4U32(0x020010, 2, 200)),
+			tfdt(baseTime*48000/90000), mp4TestBox("trun", mp4U32(0x000001, audioFrames, audioOffset)))
+		return mp4TestBox("moof", mp4TestBox("mfhd", mp4U32(0, 1)), video, audio)
+	}
+	// 先按 0 偏移计算 moof 长度，再填入真实的数据偏移
+	moof := build(0, 0)
+	videoOffset := uint32(len(moof) + 8)
+	moof = build(videoOffset, videoOffset+uint32(len(vdata)))
+	return append(moof, mp4TestBox("mdat", vdata, adata)...)
+}
+
+func TestParseMP4Init(t *testing.T) {
+	init, err := parseMP4Init(genMP4Init())
+	if err != nil {
+		t.Fatal(err)
+	}
+	video, audio := init.tracks[1], init.tracks[2]
+	if video == nil || audio == nil {
+		t.Fatalf("tracks = %v", init.tracks)
+	}
+	if video.handler != "vide" || video.codec != "avc1" || video.timescale != 90000 || video.lengthSize != 4 {
+		t.Errorf("video = %+v", video)
+	}
+	if !bytes.HasPrefix(video.paramSets, append([]byte{0, 0, 0, 1}, testMP4SPS...)) ||
+		!bytes.HasSuffix(video.paramSets, []byte{0, 0, 0, 1, 0x68, 0xce, 0x38, 0x80}) {
+		t.Errorf("paramSets = %x", video.paramSets)
+	}
+	if audio.handler != "soun" || audio.codec != "mp4a" || audio.timescale != 48000 || audio.defaultDuration != 1024 {
+		t.Errorf("audio = %+v", audio)
+	}
+	if !bytes.Equal(audio.audioConfig, []byte{0x11, 0x90}) {
+		t.Errorf("audioConfig = %x, want 1190", audio.audioConfig)
+	}
+
+	if _, err := parseMP4Init(mp4TestBox("ftyp", []byte("iso6"))); err == nil {
+		t.Error("没有 moov 时 want error")
+	}
+}
+
+func TestParseMP4Fragment(t *testing.T) {
+	init, err := parseMP4Init(genMP4Init())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 直播流基于纪元的大 tfdt
+	const baseTime = 1700000000 * 90000
+	samples, err := parseMP4Fragment(genMP4Fragment(baseTime), init)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var video, audio []mp4Sample
+	for _, s := range samples {
+		if s.track.handler == "vide" {
+			video = append(video, s)
+		} else {
+			audio = append(audio, s)
+		}
+	}
+	if len(video) != 50 || len(audio) != 94 {
+		t.Fatalf("video=%d audio=%d, want 50 94", len(video), len(audio))
+	}
+	for i, s := range video {
+		if s.dts != baseTime+int64(i)*3600 || s.cts != 3600 || s.keyFrame != (i == 0) || len(s.data) != 3005 {
+			t.Fatalf("video[%d] dts=%d cts=%d key=%v size=%d", i, s.dts, s.cts, s.keyFrame, len(s.data))
+		}
+	}
+	for i, s := range audio {
+		if s.dts != baseTime*48000/90000+int64(i)*1024 || len(s.data) != 200 || s.data[0] != 0x21 {
+			t.Fatalf("audio[%d] dts=%d size=%d", i, s.dts, len(s.data))
+		}
+	}
+
+	// 关键帧转为 Annex-B 并补上参数集
+	pkt := video[0].packet()
+	if pkt.Type != av.H264 || !pkt.IsKeyFrame || pkt.Time != 1700000000*time.Second || pkt.CTime != 40*time.Millisecond {
+		t.Errorf("packet = %v %v %v %v", pkt.Type, pkt.IsKeyFrame, pkt.Time, pkt.CTime)
+	}
+	if !bytes.HasPrefix(pkt.Data, video[0].track.paramSets) || !isH264KeyFrame(pkt.Data) {
+		t.Errorf("关键帧数据 = %x...", pkt.Data[:16])
+	}
+	if pkt := video[1].packet(); !bytes.HasPrefix(pkt.Data, []byte{0, 0, 0, 1, 1}) {
+		t.Errorf("非关键帧数据 = %x...", pkt.Data[:8])
+	}
+
+	// 数据偏移超出分片
+	data := genMP4Fragment(0)
+	if _, err := parseMP4Fragment(data[:len(data)-100], init); err == nil {
+		t.Error("截断的分片 want error")
+	}
+}
+
+func TestMP4Boxes(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []string
+		wantErr bool
+	}{
+		{"顺序读取", append(mp4TestBox("ftyp", []byte("iso6")), mp4TestBox("moov")...), []string{"ftyp", "moov"}, false},
+		{"size 为 0 延伸到末尾", append(mp4TestBox("ftyp"), 0, 0, 0, 0, 'm', 'd', 'a', 't', 1, 2), []string{"ftyp", "mdat"}, false},
+		{"64 位长度", append(mp4U32(1), append([]byte("mdat"), append(binary.BigEndian.AppendUint64(nil, 18), 1, 2)...)...), []string{"mdat"}, false},
+		{"长度超出数据", mp4U32(100, 0x6d646174), nil, true},
+		{"长度小于头部", mp4U32(4, 0x6d646174), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			err := mp4Boxes(tt.data, func(typ string, _ []byte, _ int) error {
+				got = append(got, typ)
+				return nil
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !slices.Equal(got, tt.want) {
+				t.Errorf("boxes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLengthPrefixedToAnnexB(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		lengthSize int
+		want       []byte
+	}{
+		{"4 字节长度", []byte{0, 0, 0, 2, 0x65, 0x88, 0, 0, 0, 1, 0x06}, 4, []byte{0, 0, 0, 1, 0x65, 0x88, 0, 0, 0, 1, 0x06}},
+		{"2 字节长度", []byte{0, 1, 0x41, 0, 1, 0x01}, 2, []byte{0, 0, 0, 1, 0x41, 0, 0, 0, 1, 0x01}},
+		{"长度超出数据", []byte{0, 0, 0, 1, 0x41, 0, 0, 0, 9, 0x01}, 4, []byte{0, 0, 0, 1, 0x41}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lengthPrefixedToAnnexB(tt.data, tt.lengthSize); !bytes.Equal(got, tt.want) {
+				t.Errorf("lengthPrefixedToAnnexB() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMP4Duration(t *testing.T) {
+	tests := []struct {
+		v         int64
+		timescale uint32
+		want      time.Duration
+	}{
+		{90000, 90000, time.Second},
+		{3600, 90000, 40 * time.Millisecond},
+		{1024, 48000, 21333333 * time.Nanosecond},
+		// 直接乘 time.Second 会溢出
+		{1700000000*90000 + 45000, 90000, 1700000000*time.Second + 500*time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := mp4Duration(tt.v, tt.timescale); got != tt.want {
+			t.Errorf("mp4Duration(%d, %d) = %v, want %v", tt.v, tt.timescale, got, tt.want)
+		}
+	}
+}
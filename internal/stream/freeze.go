@@ -0,0 +1,104 @@
+package stream
+
+import (
+	"hash/fnv"
+	"time"
+)
+
+const (
+	// fingerprintTail 每个 VCL NALU 只取末尾这么多字节计算指纹：
+	// 画面相同时 slice header 中的 frame_num、POC、idr_pic_id 仍会变化，而 slice data 末尾保持一致
+	fingerprintTail = 128
+
+	// minStaticFrameBytes 还没有关键帧作参照时，非关键帧小于该值视为静止（全部宏块跳过）
+	minStaticFrameBytes = 64
+
+	// staticFrameRatio 非关键帧小于上一个关键帧的 1/staticFrameRatio 时视为静止
+	staticFrameRatio = 200
+)
+
+// freezeDetector 不解码画面，按视频帧负载的大小和指纹检测画面冻结：
+// 非关键帧极小（全部跳过）或与上一个非关键帧相同、关键帧与上一个关键帧相同，都视为画面没有变化
+type freezeDetector struct {
+	lastKey     uint64 // 上一个关键帧的指纹
+	lastKeySize int
+	hasKey      bool
+
+	lastFrame uint64 // 上一个非关键帧的指纹
+	hasFrame  bool
+
+	prevDTS  time.Duration // 上一个视频帧的 DTS
+	hasPrev  bool
+	inRun    bool
+	runStart time.Duration // 当前静止区间开始的 DTS（第一个静止帧的前一帧）
+	longest  time.Duration // 最长静止区间
+}
+
+// add 处理一个视频帧，dts 为展开后的解码时间戳
+func (d *freezeDetector) add(codec string, data []byte, keyFrame bool, dts time.Duration) {
+	fp, size := frameFingerprint(codec, data)
+
+	var static bool
+	if keyFrame {
+		// 只有指纹相同（各 VCL NALU 长度和末尾数据都相同）才视为重复的关键帧，
+		// CBR 编码的正常画面关键帧大小也可能非常接近
+		static = d.hasKey && fp == d.lastKey
+		d.lastKey, d.lastKeySize, d.hasKey = fp, size, true
+	} else {
+		limit := minStaticFrameBytes
+		if d.hasKey {
+			limit = max(d.lastKeySize/staticFrameRatio, minStaticFrameBytes)
+		}
+		static = size <= limit || d.hasFrame && fp == d.lastFrame
+		d.lastFrame, d.hasFrame = fp, true
+	}
+
+	switch {
+	case static && d.hasPrev:
+		if !d.inRun {
+			d.inRun = true
+			d.runStart = d.prevDTS
+		}
+		d.longest = max(d.longest, dts-d.runStart)
+	case !static:
+		d.inRun = false
+	}
+	d.prevDTS, d.hasPrev = dts, true
+}
+
+// frameFingerprint 计算视频帧的指纹和 VCL 负载大小。H.264 / H.265 只统计 VCL NALU（跳过参数集、SEI 等），
+// 每个 NALU 取长度和末尾若干字节；其他编码按整帧计算
+func frameFingerprint(codec string, data []byte) (uint64, int) {
+	h := fnv.New64a()
+	size := 0
+	write := func(unit []byte) {
+		size += len(unit)
+		n := len(unit)
+		h.Write([]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+		h.Write(unit[max(n-fingerprintTail, 0):])
+	}
+
+	switch codec {
+	case "H264", "H265":
+		for _, nalu := range splitNALUs(data) {
+			if isVCLNALU(codec, nalu) {
+				write(nalu)
+			}
+		}
+	default:
+		write(data)
+	}
+	return h.Sum64(), size
+}
+
+// isVCLNALU 是否为编码条带数据：H.264 类型 1~5，H.265 类型 0~31
+func isVCLNALU(codec string, nalu []byte) bool {
+	if len(nalu) == 0 {
+		return false
+	}
+	if codec == "H264" {
+		t := nalu[0] & 0x1f
+		return t >= 1 && t <= 5
+	}
+	return (nalu[0]>>1)&0x3f < 32
+}
@@ -0,0 +1,106 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFreezeDetector(t *testing.T) {
+	// testFrame 视频帧：key 是否为 IDR，size 为条带数据大小，content 决定条带数据内容
+	type testFrame struct {
+		key     bool
+		size    int
+		content byte
+	}
+	idr := func(size int, content byte) testFrame { return testFrame{true, size, content} }
+	p := func(size int, content byte) testFrame { return testFrame{false, size, content} }
+	repeat := func(n int, f testFrame) []testFrame {
+		out := make([]testFrame, n)
+		for i := range out {
+			out[i] = f
+		}
+		return out
+	}
+	seq := func(parts ...[]testFrame) []testFrame {
+		var out []testFrame
+		for _, part := range parts {
+			out = append(out, part...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name    string
+		frames  []testFrame
+		longest time.Duration
+	}{
+		{
+			name:   "画面正常变化",
+			frames: seq([]testFrame{idr(5000, 1)}, []testFrame{p(3000, 2), p(2800, 3), p(3100, 4)}),
+		},
+		{
+			// 全 I 帧编码的静止画面：IDR 的 slice header 变化，条带数据相同
+			name:    "连续相同的 IDR",
+			frames:  repeat(5, idr(5000, 1)),
+			longest: 4 * 40 * time.Millisecond,
+		},
+		{
+			name:    "关键帧后接近零字节的 P 帧",
+			frames:  seq([]testFrame{idr(5000, 1)}, repeat(10, p(10, 0))),
+			longest: 10 * 40 * time.Millisecond,
+		},
+		{
+			name:    "相同的非关键帧",
+			frames:  seq([]testFrame{idr(5000, 1)}, repeat(5, p(3000, 7))),
+			longest: 4 * 40 * time.Millisecond,
+		},
+		{
+			// CBR 编码的正常画面，关键帧大小相差不到 1%
+			name:   "大小相近但内容不同的关键帧",
+			frames: []testFrame{idr(5000, 1), idr(5010, 2), idr(4995, 3), idr(5000, 4)},
+		},
+		{
+			name: "取多个静止区间中最长的",
+			frames: seq([]testFrame{idr(5000, 1)}, repeat(3, p(10, 0)), []testFrame{p(3000, 2)},
+				repeat(6, p(10, 0)), []testFrame{p(3000, 3)}, repeat(2, p(10, 0))),
+			longest: 6 * 40 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var d freezeDetector
+			for i, f := range tt.frames {
+				// NAL 头 + 每帧不同的 slice header 字节 + 条带数据
+				nalType := byte(0x41)
+				if f.key {
+					nalType = 0x65
+				}
+				data := append([]byte{0, 0, 0, 1, nalType, byte(i)}, bytes.Repeat([]byte{f.content}, f.size)...)
+				d.add("H264", data, f.key, time.Duration(i)*40*time.Millisecond)
+			}
+			if d.longest != tt.longest {
+				t.Errorf("longest = %v, want %v", d.longest, tt.longest)
+			}
+		})
+	}
+}
+
+func TestFrameFingerprint(t *testing.T) {
+	sei := []byte{0, 0, 0, 1, 0x06, 0x05, 0x01, 0x02}
+	slice := []byte{0, 0, 0, 1, 0x41, 0x9a, 0x11, 0x22}
+
+	fp1, size := frameFingerprint("H264", append(append([]byte{}, sei...), slice...))
+	if size != 4 {
+		t.Errorf("size = %d, want 4（只统计 VCL NALU）", size)
+	}
+	// SEI 变化不影响指纹
+	fp2, _ := frameFingerprint("H264", append([]byte{0, 0, 0, 1, 0x06, 0x05, 0x09, 0x09}, slice...))
+	if fp1 != fp2 {
+		t.Error("非 VCL NALU 变化后指纹不同")
+	}
+	fp3, _ := frameFingerprint("H264", []byte{0, 0, 0, 1, 0x41, 0x9a, 0x11, 0x23})
+	if fp1 == fp3 {
+		t.Error("条带数据变化后指纹相同")
+	}
+}
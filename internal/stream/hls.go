@@ -0,0 +1,556 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	urlpkg "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// hlsVariant 主播放列表中的一个码率档位
+type hlsVariant struct {
+	uri       string
+	bandwidth int64
+}
+
+// hlsKey 分片加密信息
+type hlsKey struct {
+	method string
+	uri    string
+	iv     []byte // 为空时使用媒体序列号作为 IV
+}
+
+// hlsSegment 媒体播放列表中的一个分片
+type hlsSegment struct {
+	uri      string
+	duration float64 // EXTINF（秒）
+	seq      int64   // 媒体序列号
+	key      *hlsKey
+}
+
+// hlsPlaylist 解析后的 m3u8
+type hlsPlaylist struct {
+	variants       []hlsVariant // 非空时为主播放列表
+	targetDuration float64
+	mediaSequence  int64
+	segments       []hlsSegment
+	endList        bool
+	hasMap         bool // 使用 EXT-X-MAP（fMP4 分片）
+}
+
+// lastSeq 返回播放列表中最后一个分片的序列号
+func (p *hlsPlaylist) lastSeq() int64 {
+	return p.mediaSequence + int64(len(p.segments)) - 1
+}
+
+// parseM3U8 解析 m3u8 文本，URI 相对 base 解析为绝对地址
+func parseM3U8(data []byte, base *urlpkg.URL) (*hlsPlaylist, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !scanner.Scan() || !strings.HasPrefix(strings.TrimSpace(scanner.Text()), "#EXTM3U") {
+		return nil, fmt.Errorf("无效的 m3u8（缺少 #EXTM3U）")
+	}
+
+	pl := &hlsPlaylist{}
+	var key *hlsKey
+	var pendingDuration float64
+	var pendingBandwidth int64
+	expectVariantURI := false
+
+	resolve := func(ref string) string {
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			attrs := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-STREAM-INF:"))
+			pendingBandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			expectVariantURI = true
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			pl.targetDuration, _ = strconv.ParseFloat(strings.TrimPrefix(line, "#EXT-X-TARGETDURATION:"), 64)
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			pl.mediaSequence, _ = strconv.ParseInt(strings.TrimPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"), 10, 64)
+		case strings.HasPrefix(line, "#EXTINF:"):
+			v := strings.TrimPrefix(line, "#EXTINF:")
+			if i := strings.IndexByte(v, ','); i >= 0 {
+				v = v[:i]
+			}
+			pendingDuration, _ = strconv.ParseFloat(v, 64)
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			attrs := parseAttributeList(strings.TrimPrefix(line, "#EXT-X-KEY:"))
+			if attrs["METHOD"] == "" || attrs["METHOD"] == "NONE" {
+				key = nil
+				break
+			}
+			key = &hlsKey{method: attrs["METHOD"], uri: resolve(attrs["URI"])}
+			if iv := attrs["IV"]; iv != "" {
+				iv = strings.TrimPrefix(strings.TrimPrefix(iv, "0x"), "0X")
+				key.iv, _ = hex.DecodeString(iv)
+			}
+		case strings.HasPrefix(line, "#EXT-X-MAP:"):
+			pl.hasMap = true
+		case strings.HasPrefix(line, "#EXT-X-ENDLIST"):
+			pl.endList = true
+		case strings.HasPrefix(line, "#"):
+			// 其他标签忽略
+		default:
+			if expectVariantURI {
+				pl.variants = append(pl.variants, hlsVariant{uri: resolve(line), bandwidth: pendingBandwidth})
+				expectVariantURI = false
+				continue
+			}
+			pl.segments = append(pl.segments, hlsSegment{
+				uri:      resolve(line),
+				duration: pendingDuration,
+				seq:      pl.mediaSequence + int64(len(pl.segments)),
+				key:      key,
+			})
+			pendingDuration = 0
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取 m3u8 失败: %w", err)
+	}
+	return pl, nil
+}
+
+// parseAttributeList 解析 KEY=VALUE,KEY="VALUE" 形式的属性列表
+func parseAttributeList(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.TrimSpace(s[:eq])
+		s = s[eq+1:]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			end := strings.IndexByte(s[1:], '"')
+			if end < 0 {
+				value, s = s[1:], ""
+			} else {
+				value, s = s[1:1+end], s[2+end:]
+			}
+			s = strings.TrimPrefix(s, ",")
+		} else if comma := strings.IndexByte(s, ','); comma >= 0 {
+			value, s = s[:comma], s[comma+1:]
+		} else {
+			value, s = s, ""
+		}
+		attrs[name] = value
+	}
+	return attrs
+}
+
+// hlsState 跨检查周期保留的播放列表状态，用于计算播放列表停滞时间
+type hlsState struct {
+	lastSeq   int64     // 最近一次看到的最后分片序列号
+	changedAt time.Time // 最后分片序列号最近一次变化的时间
+}
+
+// hlsStats 一次 HLS 检查得到的协议相关指标
+type hlsStats struct {
+	playlistStaleness   float64 // 播放列表停滞时间（秒）
+	targetDurationDrift float64 // 最长分片 EXTINF 与 TARGETDURATION 之差（秒）
+	mediaSequenceGaps   int64   // 刷新播放列表时跳过的分片数
+}
+
+// hlsReader 以直播播放器的方式读取 HLS：
+// 从直播边缘回溯半个采样时长开始下载分片，之后按 TARGETDURATION 刷新播放列表，
+// 解复用 MPEG-TS 分片输出 av.Packet
+type hlsReader struct {
+	ctx         context.Context
+	header      http.Header
+	playlistURL string
+	deadline    time.Time
+
+	playlist *hlsPlaylist
+	lastLoad time.Time
+	changed  bool // 最近一次刷新时播放列表是否有变化
+	queue    []hlsSegment
+	nextSeq  int64
+	keys     map[string][]byte
+
+	body         io.ReadCloser
+	demuxer      *tsDemuxer
+	backfillLeft int  // 起播时回溯的历史分片中尚未开始读取的数量（不含直播边缘分片）
+	backfilled   bool // 当前分片是否为回溯的历史分片
+
+	responseTime int64 // 首次请求播放列表的响应时间（毫秒）
+	state        hlsState
+	stats        hlsStats
+	log          *slog.Logger
+}
+
+// openHLS 加载播放列表（主播放列表时选择码率最高的档位）并准备读取
+func openHLS(ctx context.Context, rawURL string, header http.Header, sampleDuration time.Duration, prev hlsState, log *slog.Logger) (*hlsReader, error) {
+	r := &hlsReader{
+		ctx:         ctx,
+		header:      header,
+		playlistURL: rawURL,
+		deadline:    time.Now().Add(sampleDuration),
+		keys:        make(map[string][]byte),
+		state:       prev,
+		log:         log,
+	}
+
+	reqStart := time.Now()
+	pl, err := r.fetchPlaylist(rawURL, func() { r.responseTime = time.Since(reqStart).Milliseconds() })
+	if err != nil {
+		return nil, err
+	}
+
+	if len(pl.variants) > 0 {
+		best := pl.variants[0]
+		for _, v := range pl.variants[1:] {
+			if v.bandwidth > best.bandwidth {
+				best = v
+			}
+		}
+		r.log.Debug("选择 HLS 码率档位", "URL", best.uri, "带宽", best.bandwidth)
+		r.playlistURL = best.uri
+		if pl, err = r.fetchPlaylist(best.uri, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if pl.hasMap {
+		return nil, fmt.Errorf("暂不支持 fMP4 分片的 HLS")
+	}
+	if len(pl.segments) == 0 {
+		return nil, fmt.Errorf("HLS 播放列表没有分片")
+	}
+
+	r.setPlaylist(pl)
+
+	// 从直播边缘回溯半个采样时长，至少一个分片
+	start := len(pl.segments) - 1
+	covered := pl.segments[start].duration
+	for start > 0 && covered < sampleDuration.Seconds()/2 {
+		start--
+		covered += pl.segments[start].duration
+	}
+	r.queue = append(r.queue, pl.segments[start:]...)
+	r.backfillLeft = len(r.queue) - 1
+	r.nextSeq = pl.lastSeq() + 1
+
+	return r, nil
+}
+
+// fetchPlaylist 下载并解析播放列表，onResponse 在收到响应头时调用
+func (r *hlsReader) fetchPlaylist(rawURL string, onResponse func()) (*hlsPlaylist, error) {
+	resp, err := httpGet(r.ctx, rawURL, r.header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if onResponse != nil {
+		onResponse()
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4*1024*1024))
+	if err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %w", err)
+	}
+	r.lastLoad = time.Now()
+
+	// 以重定向后的最终地址作为相对 URI 的基准
+	return parseM3U8(data, resp.Request.URL)
+}
+
+// setPlaylist 更新当前媒体播放列表及停滞状态、时长偏差
+func (r *hlsReader) setPlaylist(pl *hlsPlaylist) {
+	r.playlist = pl
+
+	lastSeq := pl.lastSeq()
+	r.changed = lastSeq != r.state.lastSeq || r.state.changedAt.IsZero()
+	if r.changed {
+		r.state.lastSeq = lastSeq
+		r.state.changedAt = r.lastLoad
+	}
+	r.stats.playlistStaleness = time.Since(r.state.changedAt).Seconds()
+
+	maxDuration := 0.0
+	for _, seg := range pl.segments {
+		if seg.duration > maxDuration {
+			maxDuration = seg.duration
+		}
+	}
+	r.stats.targetDurationDrift = maxDuration - pl.targetDuration
+}
+
+// reload 按播放器规则等待后刷新播放列表，返回 false 表示采样时间内不会再有新分片
+func (r *hlsReader) reload() (bool, error) {
+	if r.playlist.endList {
+		return false, nil
+	}
+
+	// 有变化时间隔一个 TARGETDURATION，无变化时间隔一半（RFC 8216 6.3.4）
+	interval := time.Duration(r.playlist.targetDuration * float64(time.Second))
+	if !r.changed {
+		interval /= 2
+	}
+	if interval <= 0 {
+		interval = time.Second
+	}
+	next := r.lastLoad.Add(interval)
+	if next.After(r.deadline) {
+		return false, nil
+	}
+
+	select {
+	case <-time.After(time.Until(next)):
+	case <-r.ctx.Done():
+		return false, r.ctx.Err()
+	}
+
+	pl, err := r.fetchPlaylist(r.playlistURL, nil)
+	if err != nil {
+		return false, err
+	}
+	r.setPlaylist(pl)
+
+	switch {
+	case pl.mediaSequence > r.nextSeq:
+		// 需要的分片已经滑出播放列表
+		r.stats.mediaSequenceGaps += pl.mediaSequence - r.nextSeq
+		r.log.Debug("HLS 媒体序列号跳变", "期望", r.nextSeq, "实际", pl.mediaSequence)
+		r.nextSeq = pl.mediaSequence
+	case pl.lastSeq()+1 < r.nextSeq:
+		// 序列号回退（推流重启），从新的直播边缘继续
+		r.log.Debug("HLS 媒体序列号回退", "期望", r.nextSeq, "实际", pl.lastSeq())
+		r.nextSeq = pl.lastSeq()
+	}
+
+	for _, seg := range pl.segments {
+		if seg.seq >= r.nextSeq {
+			r.queue = append(r.queue, seg)
+		}
+	}
+	r.nextSeq = pl.lastSeq() + 1
+	return true, nil
+}
+
+// ReadPacket 读取下一个音视频包，分片读完后自动切换到下一个分片
+func (r *hlsReader) ReadPacket() (av.Packet, error) {
+	for {
+		if r.demuxer != nil {
+			pkt, err := r.demuxer.ReadPacket()
+			if err == nil {
+				return pkt, nil
+			}
+			r.closeSegment()
+			if err != io.EOF {
+				return av.Packet{}, err
+			}
+		}
+
+		for len(r.queue) == 0 {
+			ok, err := r.reload()
+			if err != nil {
+				return av.Packet{}, err
+			}
+			if !ok {
+				return av.Packet{}, io.EOF
+			}
+		}
+
+		seg := r.queue[0]
+		r.queue = r.queue[1:]
+		r.backfilled = r.backfillLeft > 0
+		if r.backfilled {
+			r.backfillLeft--
+		}
+		if err := r.openSegment(seg); err != nil {
+			return av.Packet{}, err
+		}
+	}
+}
+
+// openSegment 下载分片（加密分片先解密）并创建 TS 解复用器
+func (r *hlsReader) openSegment(seg hlsSegment) error {
+	resp, err := httpGet(r.ctx, seg.uri, r.header)
+	if err != nil {
+		return fmt.Errorf("下载分片失败: %w", err)
+	}
+
+	if seg.key == nil {
+		r.body = resp.Body
+		r.demuxer = newTSDemuxer(resp.Body)
+		return nil
+	}
+
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("下载分片失败: %w", err)
+	}
+	if data, err = r.decryptSegment(seg, data); err != nil {
+		return err
+	}
+	r.body = io.NopCloser(bytes.NewReader(data))
+	r.demuxer = newTSDemuxer(r.body)
+	return nil
+}
+
+// codec 返回当前分片的视频编码
+func (r *hlsReader) codec() string {
+	if r.demuxer == nil {
+		return ""
+	}
+	return r.demuxer.codec()
+}
+
+// backfilling 当前分片是否为起播时回溯的历史分片
+func (r *hlsReader) backfilling() bool {
+	return r.backfilled
+}
+
+// decryptSegment 解密 AES-128 分片
+func (r *hlsReader) decryptSegment(seg hlsSegment, data []byte) ([]byte, error) {
+	if seg.key.method != "AES-128" {
+		return nil, fmt.Errorf("不支持的 HLS 加密方式: %s", seg.key.method)
+	}
+
+	key, ok := r.keys[seg.key.uri]
+	if !ok {
+		resp, err := httpGet(r.ctx, seg.key.uri, r.header)
+		if err != nil {
+			return nil, fmt.Errorf("下载密钥失败: %w", err)
+		}
+		key, err = io.ReadAll(io.LimitReader(resp.Body, 64))
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("下载密钥失败: %w", err)
+		}
+		r.keys[seg.key.uri] = key
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 HLS 密钥: %w", err)
+	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("加密分片长度无效: %d", len(data))
+	}
+
+	iv := seg.key.iv
+	if len(iv) != aes.BlockSize {
+		iv = make([]byte, aes.BlockSize)
+		binary.BigEndian.PutUint64(iv[8:], uint64(seg.seq))
+	}
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(data, data)
+
+	// 去掉 PKCS7 填充
+	if n := len(data); n > 0 {
+		if pad := int(data[n-1]); pad > 0 && pad <= aes.BlockSize && pad <= n {
+			data = data[:n-pad]
+		}
+	}
+	return data, nil
+}
+
+// closeSegment 关闭当前分片
+func (r *hlsReader) closeSegment() {
+	if r.body != nil {
+		r.body.Close()
+		r.body = nil
+	}
+	r.demuxer = nil
+}
+
+// Close 释放资源
+func (r *hlsReader) Close() error {
+	r.closeSegment()
+	return nil
+}
+
+// isHLSURL 根据扩展名判断是否为 HLS 地址
+func isHLSURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// httpGet 使用全局 HTTP 客户端发起带附加请求头的 GET 请求，非 200 状态码视为错误
+func httpGet(ctx context.Context, rawURL string, header http.Header) (*http.Response, error) {
+	initHTTPClient()
+
+	req, err := newHTTPRequest(ctx, "GET", rawURL, nil, header)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+	resp, err := globalHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
+	}
+	return resp, nil
+}
+
+// hlsProber HLS 探测器，保存跨检查周期的播放列表状态
+type hlsProber struct {
+	state hlsState
+}
+
+// Open 加载播放列表并准备读取分片
+func (p *hlsProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openHLS(ctx, opts.URL, opts.Header, opts.SampleDuration, p.state, opts.Log)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r:            &avPacketReader{r: r, videoCodec: r.codec, backfill: r.backfilling},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			p.state = r.state
+			rep.stats = r.stats
+			// 分片按下载突发到达，到达间隔不反映网络抖动
+			rep.NetworkJitter = 0
+			opts.Log.Debug("HLS 检查完成",
+				"播放列表停滞秒", fmt.Sprintf("%.1f", r.stats.playlistStaleness),
+				"分片时长偏差秒", fmt.Sprintf("%.2f", r.stats.targetDurationDrift),
+				"序列号跳变", r.stats.mediaSequenceGaps)
+		},
+	}, nil
+}
+
+// fill 写入 HLS 指标
+func (s hlsStats) fill(m *Metrics) {
+	m.HLSPlaylistStaleness = s.playlistStaleness
+	m.HLSTargetDurationDrift = s.targetDurationDrift
+	m.HLSMediaSequenceGaps = s.mediaSequenceGaps
+}
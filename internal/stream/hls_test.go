@@ -0,0 +1,112 @@
+package stream
+
+import (
+	"bytes"
+	urlpkg "net/url"
+	"testing"
+)
+
+func TestParseM3U8(t *testing.T) {
+	base, _ := urlpkg.Parse("https://example.com/live/index.m3u8?token=abc")
+
+	t.Run("主播放列表", func(t *testing.T) {
+		pl, err := parseM3U8([]byte("#EXTM3U\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=1280x720,CODECS=\"avc1.64001f,mp4a.40.2\"\n"+
+			"720p.m3u8\n"+
+			"#EXT-X-STREAM-INF:BANDWIDTH=2500000\n"+
+			"https://cdn.example.com/1080p.m3u8\n"), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []hlsVariant{
+			{uri: "https://example.com/live/720p.m3u8", bandwidth: 800000},
+			{uri: "https://cdn.example.com/1080p.m3u8", bandwidth: 2500000},
+		}
+		if len(pl.variants) != len(want) {
+			t.Fatalf("variants = %+v", pl.variants)
+		}
+		for i := range want {
+			if pl.variants[i] != want[i] {
+				t.Errorf("variants[%d] = %+v, want %+v", i, pl.variants[i], want[i])
+			}
+		}
+	})
+
+	t.Run("媒体播放列表", func(t *testing.T) {
+		pl, err := parseM3U8([]byte("#EXTM3U\n"+
+			"#EXT-X-VERSION:3\n"+
+			"#EXT-X-TARGETDURATION:4\n"+
+			"#EXT-X-MEDIA-SEQUENCE:100\n"+
+			"#EXTINF:4.000,\n"+
+			"seg100.ts\n"+
+			"#EXT-X-KEY:METHOD=AES-128,URI=\"key.bin\",IV=0x000102030405060708090a0b0c0d0e0f\n"+
+			"#EXTINF:3.5,title\n"+
+			"seg101.ts\n"+
+			"#EXT-X-KEY:METHOD=NONE\n"+
+			"#EXTINF:4,\n"+
+			"/other/seg102.ts\n"+
+			"#EXT-X-ENDLIST\n"), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pl.targetDuration != 4 || pl.mediaSequence != 100 || !pl.endList || pl.hasMap {
+			t.Errorf("target=%v seq=%d end=%v map=%v", pl.targetDuration, pl.mediaSequence, pl.endList, pl.hasMap)
+		}
+		if len(pl.segments) != 3 || pl.lastSeq() != 102 {
+			t.Fatalf("segments = %+v", pl.segments)
+		}
+
+		tests := []struct {
+			uri      string
+			duration float64
+			seq      int64
+			keyURI   string
+		}{
+			{"https://example.com/live/seg100.ts", 4, 100, ""},
+			{"https://example.com/live/seg101.ts", 3.5, 101, "https://example.com/live/key.bin"},
+			{"https://example.com/other/seg102.ts", 4, 102, ""},
+		}
+		for i, tt := range tests {
+			seg := pl.segments[i]
+			keyURI := ""
+			if seg.key != nil {
+				keyURI = seg.key.uri
+			}
+			if seg.uri != tt.uri || seg.duration != tt.duration || seg.seq != tt.seq || keyURI != tt.keyURI {
+				t.Errorf("segments[%d] = %s %v %d key=%q, want %s %v %d key=%q", i, seg.uri, seg.duration, seg.seq, keyURI, tt.uri, tt.duration, tt.seq, tt.keyURI)
+			}
+		}
+		if iv := pl.segments[1].key.iv; !bytes.Equal(iv, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}) {
+			t.Errorf("IV = %x", iv)
+		}
+	})
+
+	t.Run("fMP4 分片", func(t *testing.T) {
+		pl, err := parseM3U8([]byte("#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:2,\nseg1.m4s\n"), base)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !pl.hasMap || len(pl.segments) != 1 {
+			t.Errorf("hasMap=%v segments=%d", pl.hasMap, len(pl.segments))
+		}
+	})
+
+	t.Run("缺少 EXTM3U", func(t *testing.T) {
+		if _, err := parseM3U8([]byte("#EXTINF:2,\nseg1.ts\n"), base); err == nil {
+			t.Error("want error")
+		}
+	})
+}
+
+func TestParseAttributeList(t *testing.T) {
+	got := parseAttributeList(`METHOD=AES-128,URI="https://k.example.com/key?a=1,b=2",IV=0x01`)
+	want := map[string]string{"METHOD": "AES-128", "URI": "https://k.example.com/key?a=1,b=2", "IV": "0x01"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
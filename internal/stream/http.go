@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nareix/joy5/format/flv"
+)
+
+// tsStats HTTP-TS 的协议相关指标
+type tsStats struct {
+	continuityErrors map[int]int64 // PID -> 连续计数器错误数
+}
+
+// fill 写入 HTTP-TS 指标
+func (s tsStats) fill(m *Metrics) {
+	m.TSContinuityErrors = s.continuityErrors
+}
+
+// httpProber HTTP 渐进式流探测器，按响应内容区分 HTTP-FLV 和 HTTP-TS
+type httpProber struct{}
+
+// Open 发起 GET 请求并按前几个字节或 Content-Type 选择解复用器
+func (httpProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	// 初始化全局HTTP客户端（如果还未初始化）
+	initHTTPClient()
+
+	// 记录请求开始时间，用于计算HTTP请求响应时间
+	reqStart := time.Now()
+	req, err := newHTTPRequest(ctx, "GET", opts.URL, nil, opts.Header)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %w", err)
+	}
+
+	// 使用全局HTTP客户端，复用连接池
+	resp, err := globalHTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
+	}
+
+	s := &readerSession{
+		closer:       resp.Body.Close,
+		responseTime: time.Since(reqStart).Milliseconds(),
+	}
+
+	// HTTP-FLV 和 HTTP-TS 可以共用同一地址配置
+	body := bufio.NewReaderSize(resp.Body, tsPacketSize*64)
+	if !sniffTS(body, resp.Header.Get("Content-Type")) {
+		s.r = &flvReader{readTag: flv.NewDemuxer(body).ReadTag}
+		s.finish = func(rep *Report) {
+			rep.Protocol = ProtocolFLV
+		}
+		return s, nil
+	}
+
+	ts := newTSDemuxer(body)
+	s.r = &avPacketReader{r: ts, videoCodec: ts.codec}
+	s.finish = func(rep *Report) {
+		st := tsStats{continuityErrors: ts.continuityErrors()}
+		rep.Protocol = ProtocolTS
+		rep.stats = st
+
+		var total int64
+		for _, n := range st.continuityErrors {
+			total += n
+		}
+		opts.Log.Debug("HTTP-TS 检查完成", "PID数", len(st.continuityErrors), "CC错误", total)
+	}
+	return s, nil
+}
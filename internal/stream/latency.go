@@ -0,0 +1,181 @@
+package stream
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nareix/joy5/format/flv/flvio"
+)
+
+// seiUserDataUnregistered SEI payloadType：user_data_unregistered（16 字节 UUID + 自定义数据）
+const seiUserDataUnregistered = 5
+
+// latencyProbe 从编码端嵌入的系统时间计算端到端延迟（到达时间 - 嵌入时间）。
+// 支持 H.264/H.265 SEI user_data_unregistered（按 UUID 匹配）和 FLV onTextData / onFI 脚本消息（按字段名匹配），
+// 要求编码端与本机时钟同步
+type latencyProbe struct {
+	seiUUID []byte // 为空时不解析 SEI
+	amfKey  string // 为空时不解析脚本消息
+
+	count int
+	sum   float64 // 毫秒
+}
+
+// parseSEIUUID 解析配置中的 UUID，允许带 - 分隔
+func parseSEIUUID(s string) ([]byte, error) {
+	uuid, err := hex.DecodeString(strings.ReplaceAll(s, "-", ""))
+	if err != nil || len(uuid) != 16 {
+		return nil, fmt.Errorf("无效的 SEI UUID: %s", s)
+	}
+	return uuid, nil
+}
+
+// addVideo 从视频帧的 SEI 中查找嵌入时间
+func (p *latencyProbe) addVideo(codec string, data []byte, arrival time.Time) {
+	if len(p.seiUUID) == 0 || codec != "H264" && codec != "H265" {
+		return
+	}
+	for _, nalu := range splitNALUs(data) {
+		var payload []byte
+		switch {
+		case codec == "H264" && len(nalu) > 1 && nalu[0]&0x1f == 6:
+			payload = nalu[1:]
+		case codec == "H265" && len(nalu) > 2 && ((nalu[0]>>1)&0x3f == 39 || (nalu[0]>>1)&0x3f == 40):
+			// prefix / suffix SEI，NALU 头 2 字节
+			payload = nalu[2:]
+		default:
+			continue
+		}
+		if at, ok := p.findSEITime(newRBSPReader(payload).data); ok {
+			p.observe(arrival.Sub(at))
+			return
+		}
+	}
+}
+
+// findSEITime 遍历 SEI 消息，返回 UUID 匹配的 user_data_unregistered 中的时间
+func (p *latencyProbe) findSEITime(rbsp []byte) (time.Time, bool) {
+	for len(rbsp) >= 2 && rbsp[0] != 0x80 {
+		// payloadType 和 payloadSize 都以若干个 0xFF 加最后一个字节累加表示
+		var payloadType, size int
+		for len(rbsp) > 0 && rbsp[0] == 0xff {
+			payloadType += 0xff
+			rbsp = rbsp[1:]
+		}
+		if len(rbsp) == 0 {
+			break
+		}
+		payloadType += int(rbsp[0])
+		rbsp = rbsp[1:]
+		for len(rbsp) > 0 && rbsp[0] == 0xff {
+			size += 0xff
+			rbsp = rbsp[1:]
+		}
+		if len(rbsp) == 0 {
+			break
+		}
+		size += int(rbsp[0])
+		rbsp = rbsp[1:]
+		if size > len(rbsp) {
+			break
+		}
+
+		msg := rbsp[:size]
+		rbsp = rbsp[size:]
+		if payloadType == seiUserDataUnregistered && len(msg) > 16 && string(msg[:16]) == string(p.seiUUID) {
+			return parseEmbeddedTime(msg[16:])
+		}
+	}
+	return time.Time{}, false
+}
+
+// addScript 从 onTextData / onFI 脚本消息的配置字段中查找嵌入时间
+func (p *latencyProbe) addScript(data []byte, arrival time.Time) {
+	if p.amfKey == "" {
+		return
+	}
+	vals, _ := flvio.ParseAMFVals(data, false)
+	matched := false
+	for _, v := range vals {
+		switch v := v.(type) {
+		case string:
+			// 经 RTMP @setDataFrame 转发时前面多一个 @setDataFrame
+			if v == "onTextData" || v == "onFI" {
+				matched = true
+			}
+		case flvio.AMFMap:
+			if !matched {
+				continue
+			}
+			var at time.Time
+			var ok bool
+			value, _ := v.GetV(p.amfKey)
+			switch t := value.(type) {
+			case float64:
+				at, ok = epochTime(t)
+			case string:
+				at, ok = parseEmbeddedTime([]byte(t))
+			}
+			if ok {
+				p.observe(arrival.Sub(at))
+			}
+			return
+		}
+	}
+}
+
+// observe 记录一次延迟
+func (p *latencyProbe) observe(d time.Duration) {
+	p.count++
+	p.sum += float64(d) / float64(time.Millisecond)
+}
+
+// average 返回平均延迟（毫秒），没有找到嵌入时间时 ok 为 false
+func (p *latencyProbe) average() (float64, bool) {
+	if p.count == 0 {
+		return 0, false
+	}
+	return p.sum / float64(p.count), true
+}
+
+// parseEmbeddedTime 解析嵌入的时间：文本为 Unix 时间戳（秒 / 毫秒 / 微秒 / 纳秒，可带小数）或 RFC 3339，
+// 非文本时取前 8 字节按大端 Unix 时间戳解析
+func parseEmbeddedTime(b []byte) (time.Time, bool) {
+	text := strings.TrimRight(string(b), "\x00 \r\n")
+	printable := text != ""
+	for i := 0; i < len(text); i++ {
+		if text[i] < 0x20 || text[i] > 0x7e {
+			printable = false
+			break
+		}
+	}
+
+	if printable {
+		if v, err := strconv.ParseFloat(text, 64); err == nil {
+			return epochTime(v)
+		}
+		if t, err := time.Parse(time.RFC3339Nano, text); err == nil {
+			return t, true
+		}
+		return time.Time{}, false
+	}
+	if len(b) >= 8 {
+		return epochTime(float64(binary.BigEndian.Uint64(b)))
+	}
+	return time.Time{}, false
+}
+
+// epochTime 按数量级判断 Unix 时间戳的单位（秒 / 毫秒 / 微秒 / 纳秒），只接受 2000~2100 年之间的时间
+func epochTime(v float64) (time.Time, bool) {
+	const minSec, maxSec = 946684800, 4102444800 // 2000-01-01 ~ 2100-01-01
+	for _, unit := range []float64{1, 1e3, 1e6, 1e9} {
+		if sec := v / unit; sec >= minSec && sec < maxSec {
+			return time.Unix(0, int64(sec*1e9)), true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,217 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/format/flv/flvio"
+)
+
+// testEmbedded 测试中嵌入的编码端时间，到达时间比它晚 150ms
+var testEmbedded = time.Date(2024, 5, 1, 8, 0, 0, 123000000, time.UTC)
+
+func TestParseEmbeddedTime(t *testing.T) {
+	sec := testEmbedded.Truncate(time.Second)
+	binaryMs := binary.BigEndian.AppendUint64(nil, uint64(testEmbedded.UnixMilli()))
+
+	tests := []struct {
+		name string
+		data []byte
+		want time.Time
+		ok   bool
+	}{
+		{"秒", []byte(strconv.FormatInt(sec.Unix(), 10)), sec, true},
+		{"带小数的秒", []byte(strconv.FormatInt(sec.Unix(), 10) + ".5"), sec.Add(500 * time.Millisecond), true},
+		{"毫秒", []byte(strconv.FormatInt(testEmbedded.UnixMilli(), 10)), testEmbedded, true},
+		{"微秒", []byte(strconv.FormatInt(testEmbedded.UnixMicro(), 10)), testEmbedded, true},
+		{"纳秒", []byte(strconv.FormatInt(testEmbedded.UnixNano(), 10)), testEmbedded, true},
+		{"RFC 3339", []byte("2024-05-01T16:00:00.123+08:00"), testEmbedded, true},
+		{"末尾 NUL 和换行", []byte(strconv.FormatInt(testEmbedded.UnixMilli(), 10) + "\r\n\x00\x00"), testEmbedded, true},
+		{"8 字节大端毫秒", binaryMs, testEmbedded, true},
+		{"超出 2000~2100 年", []byte("12345"), time.Time{}, false},
+		{"无法解析的文本", []byte("hello"), time.Time{}, false},
+		{"二进制不足 8 字节", []byte{0x01, 0x8f, 0x32}, time.Time{}, false},
+		{"空", nil, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseEmbeddedTime(tt.data)
+			// 按浮点换算单位，允许亚微秒误差
+			if ok != tt.ok || got.Sub(tt.want).Abs() > time.Microsecond {
+				t.Errorf("parseEmbeddedTime(%q) = %v, %v, want %v, %v", tt.data, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestEpochTime(t *testing.T) {
+	tests := []struct {
+		name string
+		v    float64
+		ok   bool
+	}{
+		{"秒", float64(testEmbedded.Unix()), true},
+		{"毫秒", float64(testEmbedded.UnixMilli()), true},
+		{"微秒", float64(testEmbedded.UnixMicro()), true},
+		{"纳秒", float64(testEmbedded.UnixNano()), true},
+		{"2000 年之前", 946684799, false},
+		{"2100 年之后的纳秒", 4102444800e9, false},
+		{"零", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := epochTime(tt.v)
+			if ok != tt.ok {
+				t.Fatalf("epochTime(%v) ok = %v, want %v", tt.v, ok, tt.ok)
+			}
+			if ok && got.Sub(testEmbedded.Truncate(time.Second)).Abs() > time.Second {
+				t.Errorf("epochTime(%v) = %v", tt.v, got)
+			}
+		})
+	}
+}
+
+// seiMessage 构造一条 SEI 消息，payloadType 和 payloadSize 按 0xFF 扩展编码
+func seiMessage(payloadType int, payload []byte) []byte {
+	var out []byte
+	for _, v := range []int{payloadType, len(payload)} {
+		for ; v >= 0xff; v -= 0xff {
+			out = append(out, 0xff)
+		}
+		out = append(out, byte(v))
+	}
+	return append(out, payload...)
+}
+
+// addEmulationPrevention 在 RBSP 中插入防竞争字节（00 00 后接 00~03 时插入 03）
+func addEmulationPrevention(rbsp []byte) []byte {
+	var out []byte
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 3 {
+			out = append(out, 3)
+			zeros = 0
+		}
+		out = append(out, b)
+		if b == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+	return out
+}
+
+func TestLatencyProbeSEI(t *testing.T) {
+	uuid := mustHex("dc45e9bde6d948b7962cd820d923eeef")
+	zeroUUID := mustHex("00000001000000020000000300000004") // 含需要防竞争字节的序列
+	otherUUID := mustHex("11111111222222223333333344444444")
+	embedded := []byte(strconv.FormatInt(testEmbedded.UnixMilli(), 10))
+
+	h264SEI := func(messages ...[]byte) []byte {
+		rbsp := append(bytes.Join(messages, nil), 0x80)
+		return append([]byte{0, 0, 0, 1, 0x06}, addEmulationPrevention(rbsp)...)
+	}
+	h265SEI := func(messages ...[]byte) []byte {
+		rbsp := append(bytes.Join(messages, nil), 0x80)
+		return append([]byte{0, 0, 0, 1, 39 << 1, 0x01}, addEmulationPrevention(rbsp)...)
+	}
+	slice := []byte{0, 0, 0, 1, 0x65, 0x88, 0x84}
+
+	tests := []struct {
+		name  string
+		uuid  []byte
+		codec string
+		frame []byte
+		found bool
+	}{
+		{
+			name: "单条消息", uuid: uuid, codec: "H264",
+			frame: append(h264SEI(seiMessage(5, append(uuid, embedded...))), slice...), found: true,
+		},
+		{
+			// 前面是其他 UUID 的消息和 payloadType、payloadSize 都超过 255 的消息
+			name: "多条消息与 0xFF 扩展长度", uuid: uuid, codec: "H264",
+			frame: h264SEI(
+				seiMessage(5, append(otherUUID, embedded...)),
+				seiMessage(300, bytes.Repeat([]byte{0x5a}, 300)),
+				seiMessage(5, append(uuid, embedded...)),
+			),
+			found: true,
+		},
+		{
+			name: "UUID 和负载中的防竞争字节", uuid: zeroUUID, codec: "H264",
+			frame: h264SEI(seiMessage(5, append(zeroUUID, binary.BigEndian.AppendUint64(nil, uint64(testEmbedded.UnixMilli()))...))),
+			found: true,
+		},
+		{
+			name: "H.265 prefix SEI", uuid: uuid, codec: "H265",
+			frame: h265SEI(seiMessage(5, append(uuid, embedded...))), found: true,
+		},
+		{
+			name: "UUID 不匹配", uuid: uuid, codec: "H264",
+			frame: h264SEI(seiMessage(5, append(otherUUID, embedded...))),
+		},
+		{
+			name: "payloadSize 超出数据", uuid: uuid, codec: "H264",
+			frame: append([]byte{0, 0, 0, 1, 0x06, 5, 200}, append(uuid, embedded...)...),
+		},
+		{
+			name: "不是 H.264 / H.265", uuid: uuid, codec: "AV1",
+			frame: h264SEI(seiMessage(5, append(uuid, embedded...))),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &latencyProbe{seiUUID: tt.uuid}
+			p.addVideo(tt.codec, tt.frame, testEmbedded.Add(150*time.Millisecond))
+			avg, ok := p.average()
+			if ok != tt.found || ok && math.Abs(avg-150) > 0.01 {
+				t.Errorf("average() = %v, %v, want 150 %v", avg, ok, tt.found)
+			}
+		})
+	}
+}
+
+func TestLatencyProbeScript(t *testing.T) {
+	ms := float64(testEmbedded.UnixMilli())
+	tests := []struct {
+		name  string
+		vals  []any
+		found bool
+	}{
+		{"onTextData 毫秒", []any{"onTextData", flvio.AMFMap{{K: "text", V: "hi"}, {K: "ts", V: ms}}}, true},
+		{"@setDataFrame 转发的 onTextData", []any{"@setDataFrame", "onTextData", flvio.AMFMap{{K: "ts", V: ms}}}, true},
+		{"onFI RFC 3339", []any{"onFI", flvio.AMFMap{{K: "ts", V: "2024-05-01T08:00:00.123Z"}}}, true},
+		{"onMetaData 不解析", []any{"onMetaData", flvio.AMFMap{{K: "ts", V: ms}}}, false},
+		{"缺少字段", []any{"onTextData", flvio.AMFMap{{K: "text", V: "hi"}}}, false},
+		{"时间超出范围", []any{"onTextData", flvio.AMFMap{{K: "ts", V: float64(42)}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &latencyProbe{amfKey: "ts"}
+			p.addScript(flvio.FillAMF0ValsMalloc(tt.vals), testEmbedded.Add(150*time.Millisecond))
+			avg, ok := p.average()
+			if ok != tt.found || ok && math.Abs(avg-150) > 0.01 {
+				t.Errorf("average() = %v, %v, want 150 %v", avg, ok, tt.found)
+			}
+		})
+	}
+}
+
+func TestParseSEIUUID(t *testing.T) {
+	for _, s := range []string{"dc45e9bd-e6d9-48b7-962c-d820d923eeef", "DC45E9BDE6D948B7962CD820D923EEEF"} {
+		if uuid, err := parseSEIUUID(s); err != nil || !bytes.Equal(uuid, mustHex("dc45e9bde6d948b7962cd820d923eeef")) {
+			t.Errorf("parseSEIUUID(%q) = %x, %v", s, uuid, err)
+		}
+	}
+	for _, s := range []string{"", "dc45e9bd", "zz45e9bde6d948b7962cd820d923eeef"} {
+		if _, err := parseSEIUUID(s); err == nil {
+			t.Errorf("parseSEIUUID(%q) want error", s)
+		}
+	}
+}
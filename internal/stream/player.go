@@ -0,0 +1,83 @@
+package stream
+
+import "time"
+
+// playerSim 模拟一个简单的播放器缓冲区：缓冲满 startupBuffer 的媒体时长后开始按实时播放，
+// 播放位置追上已收到的最后一个时间戳即卡顿，重新缓冲满后继续播放
+type playerSim struct {
+	startupBuffer time.Duration
+
+	started      bool
+	firstArrival time.Time
+	lastArrival  time.Time
+	firstMedia   time.Duration // 第一个包的媒体时间戳
+	bufferedEnd  time.Duration // 已收到的最大媒体时间戳
+
+	playing   bool
+	playWall  time.Time     // 本次开始（或恢复）播放的系统时间
+	playMedia time.Duration // 开始播放时的媒体位置，暂停时为当前位置
+
+	stalled    bool
+	stallStart time.Time
+	rebuffers  int           // 开始播放后的卡顿次数
+	stallTime  time.Duration // 卡顿总时长（不含首次缓冲）
+}
+
+// add 处理一个到达的包，media 为展开后的媒体时间戳
+func (p *playerSim) add(media time.Duration, arrival time.Time) {
+	if !p.started {
+		p.started = true
+		p.firstArrival = arrival
+		p.firstMedia = media
+		p.bufferedEnd = media
+		p.playMedia = media
+	}
+	p.advance(arrival)
+	p.lastArrival = arrival
+	p.bufferedEnd = max(p.bufferedEnd, media)
+
+	// 缓冲足够后开始或恢复播放
+	if !p.playing && p.bufferedEnd-p.playMedia >= p.startupBuffer {
+		p.playing = true
+		p.playWall = arrival
+		if p.stalled {
+			p.stalled = false
+			p.stallTime += arrival.Sub(p.stallStart)
+		}
+	}
+}
+
+// advance 把播放位置推进到 now，缓冲区耗尽时记一次卡顿
+func (p *playerSim) advance(now time.Time) {
+	if !p.playing {
+		return
+	}
+	if pos := p.playMedia + now.Sub(p.playWall); pos >= p.bufferedEnd {
+		p.playing = false
+		p.stalled = true
+		p.rebuffers++
+		p.stallStart = p.playWall.Add(p.bufferedEnd - p.playMedia)
+		p.playMedia = p.bufferedEnd
+	}
+}
+
+// finish 采样结束时结算仍在进行的卡顿
+func (p *playerSim) finish(end time.Time) {
+	if !p.started {
+		return
+	}
+	p.advance(end)
+	if p.stalled {
+		p.stallTime += end.Sub(p.stallStart)
+		p.stallStart = end
+	}
+}
+
+// realtimeRatio 媒体时间推进量与系统时间的比值，小于 1 表示流到达速度慢于实时
+func (p *playerSim) realtimeRatio() float64 {
+	wall := p.lastArrival.Sub(p.firstArrival)
+	if wall <= 0 {
+		return 0
+	}
+	return float64(p.bufferedEnd-p.firstMedia) / float64(wall)
+}
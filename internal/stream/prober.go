@@ -0,0 +1,244 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nareix/joy5/av"
+
+	"video-exporter/internal/config"
+)
+
+// PacketKind 数据包类型
+type PacketKind int
+
+// 数据包类型
+const (
+	PacketVideo    PacketKind = iota + 1 // 视频帧
+	PacketAudio                          // 音频帧
+	PacketMetadata                       // 元数据（如 FLV onMetaData）
+	PacketConfig                         // 解码配置（如 AVC/AAC sequence header）
+)
+
+// Packet 探测器输出的统一数据包，所有协议共用同一套采样分析逻辑
+type Packet struct {
+	Kind     PacketKind
+	Codec    string        // 编码名称，例如 H264、H265、AAC
+	KeyFrame bool          // 是否为关键帧（仅视频）
+	DTS      time.Duration // 解码时间戳
+	CTS      time.Duration // 显示时间偏移（PTS - DTS）
+	PTSOnly  bool          // DTS 实际是显示时间戳（RTP 来源没有解码时间戳），B 帧会使其回退
+	Backfill bool          // 起播时追赶直播边缘一次性下载的历史分片，不参与实时性统计
+	Data     []byte
+}
+
+// ProbeOptions 打开探测会话时的参数
+type ProbeOptions struct {
+	URL            string
+	SampleDuration time.Duration // 计划采样时长，分片类协议据此决定起播位置和刷新次数
+	RTSPTransport  string
+	Header         http.Header // 附加到每个 HTTP 请求的请求头（仅 HTTP 类协议）
+	Log            *slog.Logger
+}
+
+// Prober 协议探测器，负责建立连接并把媒体数据转换为 Packet 流。
+// 每个 Checker 持有独立的 Prober 实例，可在其中保存跨检查周期的状态
+type Prober interface {
+	Open(ctx context.Context, opts ProbeOptions) (Session, error)
+}
+
+// Session 一次检查中的探测会话
+type Session interface {
+	// ReadPacket 读取下一个数据包，io.EOF 表示采样时间内不会再有数据
+	ReadPacket() (Packet, error)
+	// ResponseTime 建立连接的响应时间（毫秒），各协议定义见指标文档
+	ResponseTime() int64
+	// Finish 采样结束后调用，可用协议层统计覆盖通用分析结果，并附加协议指标
+	Finish(r *Report)
+	Close() error
+}
+
+// Report 一次采样的通用分析结果，由 Session.Finish 补充协议相关信息
+type Report struct {
+	Protocol        string    // 实际协议（HTTP 按内容识别后可能与配置不同）
+	Codec           string    // 视频编码
+	RTT             int64     // 往返时间（毫秒），默认为响应时间
+	PacketLossRatio float64   // 丢包率（0.0-1.0），默认按 DTS 间隔估算
+	NetworkJitter   int64     // 网络抖动（毫秒），默认为视频包到达间隔的标准差
+	FirstVideo      time.Time // 第一个视频包的到达时间
+
+	stats protocolStats
+}
+
+// protocolStats 协议相关指标，写入 Metrics 中对应协议的字段
+type protocolStats interface {
+	fill(m *Metrics)
+}
+
+// proberEntry 注册表中的一个协议
+type proberEntry struct {
+	protocol string
+	match    func(rawURL string) bool // 为 nil 时不参与自动识别
+	factory  func(cfg config.StreamConfig) Prober
+}
+
+var (
+	proberMu sync.RWMutex
+	// probers 按顺序匹配，未匹配时回退到 HTTP（FLV / TS 按内容识别）
+	probers = []proberEntry{
+		{ProtocolRTMP, isRTMPURL, func(config.StreamConfig) Prober { return rtmpProber{} }},
+		{ProtocolRTSP, isRTSPURL, func(config.StreamConfig) Prober { return rtspProber{} }},
+		{ProtocolSRT, isSRTURL, func(cfg config.StreamConfig) Prober { return srtProber{opts: cfg.SRT} }},
+		{ProtocolWHEP, isWHEPURL, func(config.StreamConfig) Prober { return whepProber{} }},
+		{ProtocolHLS, isHLSURL, func(config.StreamConfig) Prober { return &hlsProber{} }},
+		{ProtocolDASH, isDASHURL, func(config.StreamConfig) Prober { return dashProber{} }},
+		{ProtocolTS, isHTTPTSURL, func(config.StreamConfig) Prober { return httpProber{} }},
+		{ProtocolFLV, nil, func(config.StreamConfig) Prober { return httpProber{} }},
+	}
+)
+
+// RegisterProber 注册协议探测器，match 用于未配置 protocol 时按 URL 自动识别（可为 nil），
+// 新注册的协议优先于内置协议匹配，同名协议会被替换
+func RegisterProber(protocol string, match func(rawURL string) bool, factory func(cfg config.StreamConfig) Prober) {
+	proberMu.Lock()
+	defer proberMu.Unlock()
+
+	entries := []proberEntry{{protocol, match, factory}}
+	for _, e := range probers {
+		if e.protocol != protocol {
+			entries = append(entries, e)
+		}
+	}
+	probers = entries
+}
+
+// detectProtocol 根据 URL 判断流协议
+func detectProtocol(rawURL string) string {
+	proberMu.RLock()
+	defer proberMu.RUnlock()
+
+	for _, e := range probers {
+		if e.match != nil && e.match(rawURL) {
+			return e.protocol
+		}
+	}
+	return ProtocolFLV
+}
+
+// newProber 按流配置选择探测器：优先使用配置的 protocol，否则按 URL 自动识别
+func newProber(cfg config.StreamConfig) (string, Prober) {
+	protocol := strings.ToLower(cfg.Protocol)
+	if protocol == "" {
+		protocol = detectProtocol(cfg.URL)
+	}
+
+	proberMu.RLock()
+	defer proberMu.RUnlock()
+
+	for _, e := range probers {
+		if e.protocol == protocol {
+			return protocol, e.factory(cfg)
+		}
+	}
+	// 未知协议按 HTTP 处理
+	return protocol, httpProber{}
+}
+
+// packetReader 输出统一 Packet 的读取器
+type packetReader interface {
+	ReadPacket() (Packet, error)
+}
+
+// readerSession 基于 packetReader 的通用 Session 实现
+type readerSession struct {
+	r            packetReader
+	closer       func() error
+	responseTime int64
+	finish       func(r *Report)
+}
+
+// ReadPacket 读取下一个数据包
+func (s *readerSession) ReadPacket() (Packet, error) {
+	return s.r.ReadPacket()
+}
+
+// ResponseTime 返回建立连接的响应时间（毫秒）
+func (s *readerSession) ResponseTime() int64 {
+	return s.responseTime
+}
+
+// Finish 调用协议相关的收尾逻辑
+func (s *readerSession) Finish(r *Report) {
+	if s.finish != nil {
+		s.finish(r)
+	}
+}
+
+// Close 关闭底层连接
+func (s *readerSession) Close() error {
+	if s.closer != nil {
+		return s.closer()
+	}
+	return nil
+}
+
+// avPacketReader 把输出 av.Packet 的读取器转换为 packetReader
+type avPacketReader struct {
+	r          av.PacketReader
+	videoCodec func() string // 实际视频编码，为 nil 或返回空时按 H264 处理
+	audioCodec func() string // 实际音频编码，为 nil 或返回空时按 AAC 处理
+	ptsOnly    bool          // 时间戳来自 RTP，只有显示时间戳
+	backfill   func() bool   // 当前包是否来自起播时回溯的历史分片，为 nil 时均不是
+}
+
+// ReadPacket 读取并转换下一个数据包
+func (a *avPacketReader) ReadPacket() (Packet, error) {
+	pkt, err := a.r.ReadPacket()
+	if err != nil {
+		return Packet{}, err
+	}
+
+	out := Packet{
+		KeyFrame: pkt.IsKeyFrame,
+		DTS:      pkt.Time,
+		CTS:      pkt.CTime,
+		PTSOnly:  a.ptsOnly,
+		Backfill: a.backfill != nil && a.backfill(),
+		Data:     pkt.Data,
+	}
+	switch pkt.Type {
+	case av.H264, av.H264DecoderConfig:
+		// 非 H.264 的视频同样以 av.H264 类型输出，实际编码由 videoCodec 给出
+		out.Kind = PacketVideo
+		if pkt.Type == av.H264DecoderConfig {
+			out.Kind = PacketConfig
+		}
+		out.Codec = codecOr(a.videoCodec, "H264")
+	case av.AAC, av.AACDecoderConfig:
+		// 非 AAC 的音频同样以 av.AAC 类型输出，实际编码由 audioCodec 给出
+		out.Kind = PacketAudio
+		if pkt.Type == av.AACDecoderConfig {
+			out.Kind = PacketConfig
+		}
+		out.Codec = codecOr(a.audioCodec, "AAC")
+	case av.Metadata:
+		out.Kind = PacketMetadata
+	default:
+		out.Kind = PacketConfig
+	}
+	return out, nil
+}
+
+// codecOr 返回 fn 给出的编码名称，fn 为 nil 或返回空时使用 def
+func codecOr(fn func() string, def string) string {
+	if fn != nil {
+		if codec := fn(); codec != "" {
+			return codec
+		}
+	}
+	return def
+}
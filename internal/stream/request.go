@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"video-exporter/internal/config"
+)
+
+// requestHeader 合并项目级和流级别的请求选项（流级别优先），读取其中的密钥，
+// 生成附加到每个 HTTP 请求的请求头，没有任何选项时返回 nil
+func requestHeader(project, stream config.RequestConfig) (http.Header, error) {
+	h := make(http.Header)
+	cookies := make(map[string]string)
+	for _, rc := range []config.RequestConfig{project, stream} {
+		for name, secret := range rc.Headers {
+			value, err := secret.Resolve()
+			if err != nil {
+				return nil, fmt.Errorf("读取请求头 %s 失败: %w", name, err)
+			}
+			h.Set(name, value)
+		}
+		for name, secret := range rc.Cookies {
+			value, err := secret.Resolve()
+			if err != nil {
+				return nil, fmt.Errorf("读取 Cookie %s 失败: %w", name, err)
+			}
+			cookies[name] = value
+		}
+	}
+
+	if len(cookies) > 0 {
+		names := make([]string, 0, len(cookies))
+		for name := range cookies {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			pairs = append(pairs, (&http.Cookie{Name: name, Value: cookies[name]}).String())
+		}
+		h.Set("Cookie", strings.Join(pairs, "; "))
+	}
+
+	userAgent := stream.UserAgent
+	if userAgent == "" {
+		userAgent = project.UserAgent
+	}
+	if userAgent != "" {
+		h.Set("User-Agent", userAgent)
+	}
+
+	auth := stream.Auth
+	if auth.Username == "" && auth.Token == "" {
+		auth = project.Auth
+	}
+	switch {
+	case auth.Token != "":
+		token, err := auth.Token.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("读取 token 失败: %w", err)
+		}
+		h.Set("Authorization", "Bearer "+token)
+	case auth.Username != "":
+		password, err := auth.Password.Resolve()
+		if err != nil {
+			return nil, fmt.Errorf("读取密码失败: %w", err)
+		}
+		h.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(auth.Username+":"+password)))
+	}
+
+	if len(h) == 0 {
+		return nil, nil
+	}
+	return h, nil
+}
+
+// newHTTPRequest 创建带附加请求头的 HTTP 请求
+func newHTTPRequest(ctx context.Context, method, rawURL string, body io.Reader, header http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return req, nil
+}
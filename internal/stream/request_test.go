@@ -0,0 +1,114 @@
+package stream
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"video-exporter/internal/config"
+)
+
+func TestRequestHeader(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "cookie"), []byte("abc\n"), 0o600)
+	t.Setenv("TEST_REQUEST_TOKEN", "s3cret")
+
+	project := config.RequestConfig{
+		Headers:   map[string]config.Secret{"Referer": "https://player.example.com/", "X-Token": "project"},
+		UserAgent: "project-ua",
+		Auth:      config.AuthConfig{Token: "env:TEST_REQUEST_TOKEN"},
+	}
+
+	tests := []struct {
+		name    string
+		project config.RequestConfig
+		stream  config.RequestConfig
+		want    http.Header
+		wantErr bool
+	}{
+		{name: "没有任何选项", want: nil},
+		{
+			name:    "只有项目级选项",
+			project: project,
+			want: http.Header{
+				"Referer":       {"https://player.example.com/"},
+				"X-Token":       {"project"},
+				"User-Agent":    {"project-ua"},
+				"Authorization": {"Bearer s3cret"},
+			},
+		},
+		{
+			name:    "流级别覆盖项目级",
+			project: project,
+			stream: config.RequestConfig{
+				Headers:   map[string]config.Secret{"x-token": "stream"},
+				Cookies:   map[string]config.Secret{"sid": config.Secret("file:" + filepath.Join(dir, "cookie")), "a": "1"},
+				UserAgent: "stream-ua",
+			},
+			want: http.Header{
+				"Referer":       {"https://player.example.com/"},
+				"X-Token":       {"stream"},
+				"Cookie":        {"a=1; sid=abc"},
+				"User-Agent":    {"stream-ua"},
+				"Authorization": {"Bearer s3cret"},
+			},
+		},
+		{
+			name:    "流级别 Basic 认证覆盖项目级 token",
+			project: project,
+			stream:  config.RequestConfig{Auth: config.AuthConfig{Username: "user", Password: "pass"}},
+			want: http.Header{
+				"Referer":       {"https://player.example.com/"},
+				"X-Token":       {"project"},
+				"User-Agent":    {"project-ua"},
+				"Authorization": {"Basic dXNlcjpwYXNz"},
+			},
+		},
+		{
+			name:    "token 环境变量未设置",
+			stream:  config.RequestConfig{Auth: config.AuthConfig{Token: "env:TEST_REQUEST_MISSING"}},
+			wantErr: true,
+		},
+		{
+			name:    "请求头文件不存在",
+			stream:  config.RequestConfig{Headers: map[string]config.Secret{"X-Key": config.Secret("file:" + filepath.Join(dir, "missing"))}},
+			wantErr: true,
+		},
+		{
+			name:    "密码环境变量未设置",
+			stream:  config.RequestConfig{Auth: config.AuthConfig{Username: "user", Password: "env:TEST_REQUEST_MISSING"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := requestHeader(tt.project, tt.stream)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("requestHeader() err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) || (got == nil) != (tt.want == nil) {
+				t.Fatalf("requestHeader() = %v, want %v", got, tt.want)
+			}
+			for name, values := range tt.want {
+				if g := got.Values(name); len(g) != len(values) || g[0] != values[0] {
+					t.Errorf("%s = %q, want %q", name, g, values)
+				}
+			}
+		})
+	}
+}
+
+func TestNewHTTPRequest(t *testing.T) {
+	header := http.Header{"Referer": {"https://player.example.com/"}, "Cookie": {"a=1"}}
+	req, err := newHTTPRequest(t.Context(), "GET", "https://example.com/live/a.flv", nil, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Referer() != "https://player.example.com/" || req.Header.Get("Cookie") != "a=1" {
+		t.Errorf("请求头 = %v", req.Header)
+	}
+	if _, err := newHTTPRequest(t.Context(), "GET", "://bad", nil, nil); err == nil {
+		t.Error("want error")
+	}
+}
@@ -0,0 +1,132 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	urlpkg "net/url"
+	"time"
+
+	"github.com/nareix/joy5/format/rtmp"
+)
+
+// rtmpStats 一次 RTMP 检查得到的协议相关指标
+type rtmpStats struct {
+	handshakeTime       int64 // C0/C1 发出到 C2 发出的耗时（毫秒）
+	connectToFirstVideo int64 // 发送 connect 命令到收到第一个视频包的耗时（毫秒）
+}
+
+// rtmpReadWriter 为 rtmp.Conn 提供带缓冲的读写
+type rtmpReadWriter struct {
+	*bufio.Reader
+	*bufio.Writer
+}
+
+// rtmpReader 通过 RTMP play 拉流，由 flvReader 解析收到的 tag
+type rtmpReader struct {
+	nc   net.Conn
+	conn *rtmp.Conn
+
+	connectStart time.Time // 握手完成、开始发送 connect 命令的时间
+	responseTime int64     // 拨号开始到 play 成功（onStatus）的耗时（毫秒）
+	stats        rtmpStats
+}
+
+// openRTMP 建立 TCP（rtmps 为 TLS）连接，完成握手、connect、createStream 和 play
+// 整个检查期间的读写都受 deadline 约束
+func openRTMP(ctx context.Context, rawURL string) (*rtmpReader, error) {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 RTMP 地址: %w", err)
+	}
+
+	dialStart := time.Now()
+	var dialer net.Dialer
+	nc, err := dialer.DialContext(ctx, "tcp", rtmp.UrlGetHost(u))
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+	if u.Scheme == "rtmps" {
+		nc = tls.Client(nc, &tls.Config{ServerName: u.Hostname()})
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		nc.SetDeadline(deadline)
+	}
+
+	r := &rtmpReader{nc: nc}
+	rw := &rtmpReadWriter{
+		Reader: bufio.NewReaderSize(nc, rtmp.BufioSize),
+		Writer: bufio.NewWriterSize(nc, rtmp.BufioSize),
+	}
+	r.conn = rtmp.NewConn(rw)
+	r.conn.URL = u
+
+	handshakeStart := time.Now()
+	r.conn.LogStageEvent = func(event string, _ string) {
+		if event == "Rtmp"+rtmp.Stage(rtmp.StageHandshakeDone).String() {
+			r.connectStart = time.Now()
+			r.stats.handshakeTime = r.connectStart.Sub(handshakeStart).Milliseconds()
+		}
+	}
+
+	// 握手 + connect + createStream + play
+	if err := r.conn.Prepare(rtmp.StageCommandDone, rtmp.PrepareReading); err != nil {
+		nc.Close()
+		return nil, fmt.Errorf("RTMP 握手/播放失败: %w", err)
+	}
+	r.responseTime = time.Since(dialStart).Milliseconds()
+
+	return r, nil
+}
+
+// markFirstVideo 记录第一个视频包的到达时间
+func (r *rtmpReader) markFirstVideo(at time.Time) {
+	if !r.connectStart.IsZero() && !at.IsZero() {
+		r.stats.connectToFirstVideo = at.Sub(r.connectStart).Milliseconds()
+	}
+}
+
+// Close 关闭连接
+func (r *rtmpReader) Close() error {
+	return r.nc.Close()
+}
+
+// isRTMPURL 根据 scheme 判断是否为 RTMP 地址
+func isRTMPURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "rtmp" || u.Scheme == "rtmps"
+}
+
+// rtmpProber RTMP 探测器
+type rtmpProber struct{}
+
+// Open 完成握手并开始播放
+func (rtmpProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openRTMP(ctx, opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r:            &flvReader{readTag: r.conn.ReadTag},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			r.markFirstVideo(rep.FirstVideo)
+			rep.stats = r.stats
+			opts.Log.Debug("RTMP 检查完成",
+				"握手ms", r.stats.handshakeTime,
+				"connect到首个视频包ms", r.stats.connectToFirstVideo)
+		},
+	}, nil
+}
+
+// fill 写入 RTMP 指标
+func (s rtmpStats) fill(m *Metrics) {
+	m.RTMPHandshakeTime = s.handshakeTime
+	m.RTMPConnectToFirstVideo = s.connectToFirstVideo
+}
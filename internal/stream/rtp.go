@@ -0,0 +1,106 @@
+package stream
+
+import "time"
+
+// rtpStats RTP 接收统计（RFC 3550 附录 A.3 / A.8）和时间戳展开
+type rtpStats struct {
+	clockRate int
+
+	initialized bool
+	baseSeq     uint16
+	maxSeq      uint16
+	cycles      int64
+	received    int64
+	prevTS      uint32
+	prevArrival int64   // 上一个包的到达时间（RTP 时钟单位）
+	jitter      float64 // 以 RTP 时钟为单位
+
+	firstTS  uint32
+	lastTS   uint32
+	tsCycles int64
+	origin   time.Duration // 首包到达时间（相对会话开始），用于对齐各轨道的时间轴
+}
+
+// extendedTime 把 RTP 时间戳展开为 time.Duration，以首包到达时间为起点，
+// 这样音视频轨道的时间戳大致处在同一时间轴上，可以比较音画同步
+func (t *rtpStats) extendedTime(ts uint32) time.Duration {
+	if ts < t.lastTS && t.lastTS-ts > 1<<31 {
+		t.tsCycles++
+	}
+	t.lastTS = ts
+	ext := t.tsCycles<<32 + int64(ts) - int64(t.firstTS)
+	if t.clockRate <= 0 {
+		return 0
+	}
+	return t.origin + time.Duration(ext)*time.Second/time.Duration(t.clockRate)
+}
+
+// updateStats 按 RFC 3550 更新序列号与到达抖动统计
+func (t *rtpStats) updateStats(seq uint16, ts uint32, arrival time.Time, epoch time.Time) {
+	arrivalTS := int64(arrival.Sub(epoch).Seconds() * float64(t.clockRate))
+
+	if !t.initialized {
+		t.initialized = true
+		t.baseSeq = seq
+		t.maxSeq = seq
+		t.firstTS = ts
+		t.lastTS = ts
+		t.prevTS = ts
+		t.prevArrival = arrivalTS
+		t.origin = arrival.Sub(epoch)
+		t.received = 1
+		return
+	}
+
+	t.received++
+	if delta := seq - t.maxSeq; delta < 0x8000 {
+		// 顺序到达（允许跳号），序列号回绕时累加周期
+		if seq < t.maxSeq {
+			t.cycles++
+		}
+		t.maxSeq = seq
+	}
+
+	// D(i-1,i) = (Rj - Ri) - (Sj - Si)，J += (|D| - J) / 16
+	d := (arrivalTS - t.prevArrival) - int64(int32(ts-t.prevTS))
+	t.prevArrival = arrivalTS
+	t.prevTS = ts
+	if d < 0 {
+		d = -d
+	}
+	t.jitter += (float64(d) - t.jitter) / 16
+}
+
+// expected 期望收到的包数
+func (t *rtpStats) expected() int64 {
+	if !t.initialized {
+		return 0
+	}
+	return t.cycles<<16 + int64(t.maxSeq) - int64(t.baseSeq) + 1
+}
+
+// jitterMs 以毫秒为单位的到达抖动
+func (t *rtpStats) jitterMs() int64 {
+	if t.clockRate <= 0 {
+		return 0
+	}
+	return int64(t.jitter / float64(t.clockRate) * 1000)
+}
+
+// rtpLoss 汇总多个 RTP 流的丢包数和丢包率
+func rtpLoss(streams []*rtpStats) (lost int64, ratio float64) {
+	var expected, received int64
+	for _, t := range streams {
+		if !t.initialized {
+			continue
+		}
+		expected += t.expected()
+		received += t.received
+	}
+	if expected == 0 {
+		return 0, 0
+	}
+	// 重复包会导致收到的比期望的多
+	lost = max(expected-received, 0)
+	return lost, float64(lost) / float64(expected)
+}
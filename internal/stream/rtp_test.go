@@ -0,0 +1,97 @@
+package stream
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRTPStatsLoss(t *testing.T) {
+	tests := []struct {
+		name     string
+		seqs     []uint16
+		expected int64
+		lost     int64
+	}{
+		{"顺序到达", []uint16{10, 11, 12, 13}, 4, 0},
+		{"跳号", []uint16{10, 11, 14, 15}, 6, 2},
+		{"序列号回绕", []uint16{65534, 65535, 0, 1}, 4, 0},
+		{"回绕时丢包", []uint16{65534, 65535, 2}, 5, 2},
+		{"乱序", []uint16{10, 12, 11, 13}, 4, 0},
+		{"回绕附近乱序", []uint16{65535, 1, 0, 2}, 4, 0},
+		{"重复包不计为负丢包", []uint16{10, 11, 11, 12}, 3, 0},
+	}
+	epoch := time.Now()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &rtpStats{clockRate: 90000}
+			for i, seq := range tt.seqs {
+				s.updateStats(seq, uint32(i*3600), epoch.Add(time.Duration(i)*40*time.Millisecond), epoch)
+			}
+			if got := s.expected(); got != tt.expected {
+				t.Errorf("expected() = %d, want %d", got, tt.expected)
+			}
+			lost, ratio := rtpLoss([]*rtpStats{s})
+			if lost != tt.lost || ratio != float64(tt.lost)/float64(tt.expected) {
+				t.Errorf("rtpLoss() = %d, %v, want %d", lost, ratio, tt.lost)
+			}
+		})
+	}
+}
+
+func TestRTPLossMultipleStreams(t *testing.T) {
+	epoch := time.Now()
+	video := &rtpStats{clockRate: 90000}
+	for _, seq := range []uint16{1, 2, 4} {
+		video.updateStats(seq, 0, epoch, epoch)
+	}
+	audio := &rtpStats{clockRate: 48000}
+	audio.updateStats(7, 0, epoch, epoch)
+	// 没有收到包的轨道不参与计算
+	lost, ratio := rtpLoss([]*rtpStats{video, audio, {clockRate: 8000}})
+	if lost != 1 || ratio != 0.2 {
+		t.Errorf("rtpLoss() = %d, %v, want 1 0.2", lost, ratio)
+	}
+}
+
+func TestRTPStatsJitter(t *testing.T) {
+	// 8kHz 时钟，每包 4000（0.5 秒），到达时间 0、0.5、1.25、1.5 秒：
+	// D = 0、2000、-2000，J = 0 -> 125 -> 125 + (2000-125)/16 = 242.1875
+	epoch := time.Now()
+	s := &rtpStats{clockRate: 8000}
+	arrivals := []time.Duration{0, 500 * time.Millisecond, 1250 * time.Millisecond, 1500 * time.Millisecond}
+	for i, arrival := range arrivals {
+		s.updateStats(uint16(i), uint32(i*4000), epoch.Add(arrival), epoch)
+	}
+	if math.Abs(s.jitter-242.1875) > 1e-9 {
+		t.Errorf("jitter = %v, want 242.1875", s.jitter)
+	}
+	if got := s.jitterMs(); got != 30 {
+		t.Errorf("jitterMs() = %d, want 30", got)
+	}
+	if got := (&rtpStats{jitter: 100}).jitterMs(); got != 0 {
+		t.Errorf("时钟频率未知时 jitterMs() = %d, want 0", got)
+	}
+}
+
+func TestRTPExtendedTime(t *testing.T) {
+	s := &rtpStats{clockRate: 90000, firstTS: 1<<32 - 90000, lastTS: 1<<32 - 90000, origin: time.Second}
+	tests := []struct {
+		ts   uint32
+		want time.Duration
+	}{
+		{1<<32 - 90000, time.Second},
+		{1<<32 - 45000, 1500 * time.Millisecond},
+		{0, 2 * time.Second}, // 回绕
+		{90000, 3 * time.Second},
+		{45000, 2500 * time.Millisecond}, // 回绕后的乱序包不再计一次回绕
+	}
+	for _, tt := range tests {
+		if got := s.extendedTime(tt.ts); got != tt.want {
+			t.Errorf("extendedTime(%d) = %v, want %v", tt.ts, got, tt.want)
+		}
+	}
+	if got := (&rtpStats{}).extendedTime(90000); got != 0 {
+		t.Errorf("时钟频率未知时 extendedTime() = %v, want 0", got)
+	}
+}
@@ -0,0 +1,808 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	urlpkg "net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// RTSP 传输方式
+const (
+	RTSPTransportTCP = "tcp"
+	RTSPTransportUDP = "udp"
+)
+
+// rtspResponse RTSP 响应
+type rtspResponse struct {
+	status int
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+// rtspTrack SDP 中的一个媒体轨道
+type rtspTrack struct {
+	media   string // video / audio
+	codec   string // H264 / H265 / MPEG4-GENERIC ...
+	control string
+	fmtp    map[string]string
+
+	paramSets [][]byte // SDP sprop 中的参数集，关键帧不带 SPS 时补上
+
+	rtpStats
+
+	// 视频帧组装
+	frame    [][]byte // 当前访问单元的 NALU
+	frameTS  uint32
+	fuBuffer []byte
+}
+
+// rtspStats 一次 RTSP 检查得到的 RTP 统计
+type rtspStats struct {
+	packetLossRatio float64 // 基于 RTP 序列号的丢包率
+	jitter          int64   // RFC 3550 到达抖动（毫秒）
+	lostPackets     int64
+}
+
+// rtspReader RTSP 客户端，按 RFC 6184/7798 解包 H.264/H.265，输出 av.Packet
+type rtspReader struct {
+	ctx     context.Context
+	conn    net.Conn
+	br      *bufio.Reader
+	url     *urlpkg.URL
+	baseURL string
+	cseq    int
+	session string
+	auth    string // 上一次 401 返回的 WWW-Authenticate
+	user    *urlpkg.Userinfo
+
+	transport string
+	tracks    []*rtspTrack
+	channels  map[int]*rtspTrack // TCP interleaved 通道 -> 轨道
+	udpConns  []net.PacketConn
+	udpPkts   chan rtspUDPPacket
+
+	epoch   time.Time
+	pending []av.Packet
+
+	videoCodec   string
+	responseTime int64 // DESCRIBE 请求响应时间（毫秒）
+}
+
+// rtspUDPPacket UDP 模式收到的 RTP 包
+type rtspUDPPacket struct {
+	track   *rtspTrack
+	data    []byte
+	arrival time.Time
+}
+
+// openRTSP 建立 RTSP 会话：DESCRIBE、SETUP（每个轨道）、PLAY
+func openRTSP(ctx context.Context, rawURL, transport string) (*rtspReader, error) {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 RTSP 地址: %w", err)
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	r := &rtspReader{
+		ctx:       ctx,
+		conn:      conn,
+		br:        bufio.NewReaderSize(conn, 64*1024),
+		user:      u.User,
+		transport: transport,
+		channels:  make(map[int]*rtspTrack),
+		epoch:     time.Now(),
+	}
+	// 请求地址中不携带用户名密码
+	u.User = nil
+	r.url = u
+
+	if err := r.setup(); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// setup 完成 DESCRIBE/SETUP/PLAY
+func (r *rtspReader) setup() error {
+	reqStart := time.Now()
+	resp, err := r.request("DESCRIBE", r.url.String(), map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	r.responseTime = time.Since(reqStart).Milliseconds()
+
+	r.baseURL = r.url.String()
+	if base := resp.header.Get("Content-Base"); base != "" {
+		r.baseURL = base
+	} else if loc := resp.header.Get("Content-Location"); loc != "" {
+		r.baseURL = loc
+	}
+
+	r.tracks = parseSDP(resp.body)
+	var video, audio *rtspTrack
+	for _, t := range r.tracks {
+		if video == nil && t.media == "video" && (t.codec == "H264" || t.codec == "H265") {
+			video = t
+		}
+		if audio == nil && t.media == "audio" && t.codec == "MPEG4-GENERIC" && t.clockRate > 0 {
+			audio = t
+		}
+	}
+	if video == nil && audio == nil {
+		return fmt.Errorf("SDP 中没有 H.264/H.265 视频轨道或 AAC 音频轨道")
+	}
+	if video != nil {
+		r.videoCodec = video.codec
+	}
+
+	// 只建立第一个视频轨道和第一个 AAC 音频轨道
+	for i, t := range r.tracks {
+		if t != video && t != audio {
+			continue
+		}
+		if err := r.setupTrack(t, i); err != nil {
+			return err
+		}
+	}
+
+	// RFC 3640 的 fmtp config 为十六进制的 AudioSpecificConfig
+	if audio != nil {
+		if asc, err := hex.DecodeString(audio.fmtp["config"]); err == nil && len(asc) > 0 {
+			r.pending = append(r.pending, av.Packet{Type: av.AACDecoderConfig, Data: asc})
+		}
+	}
+
+	if _, err := r.request("PLAY", r.baseURL, map[string]string{"Range": "npt=0.000-"}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// setupTrack 对单个轨道发送 SETUP
+func (r *rtspReader) setupTrack(t *rtspTrack, index int) error {
+	control := r.controlURL(t.control)
+
+	if r.transport == RTSPTransportUDP {
+		rtpConn, rtcpConn, err := listenRTPPair()
+		if err != nil {
+			return err
+		}
+		rtpPort := rtpConn.LocalAddr().(*net.UDPAddr).Port
+		resp, err := r.request("SETUP", control, map[string]string{
+			"Transport": fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d", rtpPort, rtpPort+1),
+		})
+		if err != nil {
+			rtpConn.Close()
+			rtcpConn.Close()
+			return err
+		}
+		r.setSession(resp)
+		r.udpConns = append(r.udpConns, rtpConn, rtcpConn)
+		r.startUDPReader(rtpConn, t)
+		return nil
+	}
+
+	channel := index * 2
+	resp, err := r.request("SETUP", control, map[string]string{
+		"Transport": fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", channel, channel+1),
+	})
+	if err != nil {
+		return err
+	}
+	r.setSession(resp)
+
+	// 以服务器实际分配的通道为准
+	if tr := resp.header.Get("Transport"); tr != "" {
+		for _, part := range strings.Split(tr, ";") {
+			if v, ok := strings.CutPrefix(part, "interleaved="); ok {
+				if n, err := strconv.Atoi(strings.SplitN(v, "-", 2)[0]); err == nil {
+					channel = n
+				}
+			}
+		}
+	}
+	r.channels[channel] = t
+	return nil
+}
+
+// setSession 记录 SETUP 返回的会话 ID
+func (r *rtspReader) setSession(resp *rtspResponse) {
+	if s := resp.header.Get("Session"); s != "" && r.session == "" {
+		r.session = strings.TrimSpace(strings.SplitN(s, ";", 2)[0])
+	}
+}
+
+// controlURL 把 SDP 中的 control 属性解析为绝对地址
+func (r *rtspReader) controlURL(control string) string {
+	switch {
+	case control == "" || control == "*":
+		return r.baseURL
+	case strings.HasPrefix(control, "rtsp://") || strings.HasPrefix(control, "rtsps://"):
+		return control
+	case strings.HasSuffix(r.baseURL, "/"):
+		return r.baseURL + control
+	default:
+		return r.baseURL + "/" + control
+	}
+}
+
+// request 发送 RTSP 请求并读取响应，401 时按 Digest/Basic 认证重试一次
+func (r *rtspReader) request(method, uri string, headers map[string]string) (*rtspResponse, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		r.cseq++
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s %s RTSP/1.0\r\n", method, uri)
+		fmt.Fprintf(&b, "CSeq: %d\r\n", r.cseq)
+		b.WriteString("User-Agent: video-exporter\r\n")
+		if r.session != "" {
+			fmt.Fprintf(&b, "Session: %s\r\n", r.session)
+		}
+		if auth := r.authorization(method, uri); auth != "" {
+			fmt.Fprintf(&b, "Authorization: %s\r\n", auth)
+		}
+		for k, v := range headers {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+		b.WriteString("\r\n")
+
+		if _, err := io.WriteString(r.conn, b.String()); err != nil {
+			return nil, fmt.Errorf("发送 %s 失败: %w", method, err)
+		}
+
+		resp, err := r.readResponse()
+		if err != nil {
+			return nil, fmt.Errorf("读取 %s 响应失败: %w", method, err)
+		}
+		if resp.status == 401 && attempt == 0 && r.user != nil {
+			r.auth = resp.header.Get("WWW-Authenticate")
+			continue
+		}
+		if resp.status != 200 {
+			return nil, fmt.Errorf("RTSP %s 状态码: %d", method, resp.status)
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("RTSP %s 认证失败", method)
+}
+
+// authorization 根据服务器的认证质询生成 Authorization 头
+func (r *rtspReader) authorization(method, uri string) string {
+	if r.user == nil || r.auth == "" {
+		return ""
+	}
+	username := r.user.Username()
+	password, _ := r.user.Password()
+
+	if strings.HasPrefix(r.auth, "Basic") {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	params := parseAttributeList(strings.TrimSpace(strings.TrimPrefix(r.auth, "Digest")))
+	realm, nonce := params["realm"], params["nonce"]
+	md5hex := func(s string) string {
+		sum := md5.Sum([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+	ha1 := md5hex(username + ":" + realm + ":" + password)
+	ha2 := md5hex(method + ":" + uri)
+	response := md5hex(ha1 + ":" + nonce + ":" + ha2)
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, realm, nonce, uri, response)
+}
+
+// readResponse 读取一个 RTSP 响应，期间收到的 interleaved 数据照常处理
+func (r *rtspReader) readResponse() (*rtspResponse, error) {
+	for {
+		c, err := r.br.Peek(1)
+		if err != nil {
+			return nil, err
+		}
+		if c[0] == '$' {
+			if err := r.readInterleaved(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		break
+	}
+
+	tp := textproto.NewReader(r.br)
+	line, err := tp.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) < 2 || !strings.HasPrefix(parts[0], "RTSP/") {
+		return nil, fmt.Errorf("无效的 RTSP 响应: %q", line)
+	}
+	status, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("无效的 RTSP 状态码: %q", line)
+	}
+
+	header, err := tp.ReadMIMEHeader()
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	resp := &rtspResponse{status: status, header: header}
+	if n, _ := strconv.Atoi(header.Get("Content-Length")); n > 0 {
+		resp.body = make([]byte, n)
+		if _, err := io.ReadFull(r.br, resp.body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// readInterleaved 读取一个 TCP interleaved 帧（$ + 通道 + 长度 + 数据）
+func (r *rtspReader) readInterleaved() error {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r.br, hdr[:]); err != nil {
+		return err
+	}
+	size := int(binary.BigEndian.Uint16(hdr[2:]))
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r.br, data); err != nil {
+		return err
+	}
+
+	// 奇数通道为 RTCP，忽略
+	if t, ok := r.channels[int(hdr[1])]; ok {
+		r.handleRTP(t, data, time.Now())
+	}
+	return nil
+}
+
+// ReadPacket 读取下一个音视频包
+func (r *rtspReader) ReadPacket() (av.Packet, error) {
+	for len(r.pending) == 0 {
+		if r.transport == RTSPTransportUDP {
+			select {
+			case p := <-r.udpPkts:
+				r.handleRTP(p.track, p.data, p.arrival)
+			case <-r.ctx.Done():
+				return av.Packet{}, r.ctx.Err()
+			}
+			continue
+		}
+
+		c, err := r.br.Peek(1)
+		if err != nil {
+			return av.Packet{}, err
+		}
+		if c[0] == '$' {
+			if err := r.readInterleaved(); err != nil {
+				return av.Packet{}, err
+			}
+			continue
+		}
+		// 服务器主动发来的 RTSP 消息（如 keep-alive 响应），读掉即可
+		if _, err := r.readResponse(); err != nil {
+			return av.Packet{}, err
+		}
+	}
+
+	pkt := r.pending[0]
+	r.pending = r.pending[1:]
+	return pkt, nil
+}
+
+// handleRTP 解析 RTP 头，更新统计并解包
+func (r *rtspReader) handleRTP(t *rtspTrack, data []byte, arrival time.Time) {
+	if len(data) < 12 || data[0]>>6 != 2 {
+		return
+	}
+	padding := data[0]&0x20 != 0
+	extension := data[0]&0x10 != 0
+	csrcCount := int(data[0] & 0x0f)
+	marker := data[1]&0x80 != 0
+	seq := binary.BigEndian.Uint16(data[2:4])
+	ts := binary.BigEndian.Uint32(data[4:8])
+
+	offset := 12 + 4*csrcCount
+	if extension {
+		if len(data) < offset+4 {
+			return
+		}
+		offset += 4 + 4*int(binary.BigEndian.Uint16(data[offset+2:offset+4]))
+	}
+	end := len(data)
+	if padding && end > 0 {
+		end -= int(data[end-1])
+	}
+	if offset > end {
+		return
+	}
+	payload := data[offset:end]
+
+	t.updateStats(seq, ts, arrival, r.epoch)
+
+	switch t.codec {
+	case "H264", "H265":
+		r.depacketizeVideo(t, payload, ts, marker)
+	case "MPEG4-GENERIC":
+		r.depacketizeAAC(t, payload, ts)
+	}
+}
+
+// depacketizeVideo 按 RFC 6184（H.264）/ RFC 7798（H.265）还原 NALU，按时间戳或 marker 组成访问单元
+func (r *rtspReader) depacketizeVideo(t *rtspTrack, payload []byte, ts uint32, marker bool) {
+	if len(payload) < 2 {
+		return
+	}
+
+	// 时间戳变化说明上一帧已结束（marker 丢失时兜底）
+	if len(t.frame) > 0 && ts != t.frameTS {
+		r.flushVideoFrame(t)
+	}
+	t.frameTS = ts
+
+	if t.codec == "H264" {
+		switch naluType := payload[0] & 0x1f; {
+		case naluType >= 1 && naluType <= 23:
+			t.frame = append(t.frame, append([]byte(nil), payload...))
+		case naluType == 24: // STAP-A
+			t.frame = append(t.frame, splitAggregation(payload[1:])...)
+		case naluType == 28: // FU-A
+			if len(payload) < 2 {
+				return
+			}
+			fuHeader := payload[1]
+			if fuHeader&0x80 != 0 {
+				t.fuBuffer = []byte{payload[0]&0xe0 | fuHeader&0x1f}
+			}
+			if t.fuBuffer != nil {
+				t.fuBuffer = append(t.fuBuffer, payload[2:]...)
+			}
+			if fuHeader&0x40 != 0 && t.fuBuffer != nil {
+				t.frame = append(t.frame, t.fuBuffer)
+				t.fuBuffer = nil
+			}
+		}
+	} else {
+		switch naluType := (payload[0] >> 1) & 0x3f; {
+		case naluType < 48:
+			t.frame = append(t.frame, append([]byte(nil), payload...))
+		case naluType == 48: // AP
+			t.frame = append(t.frame, splitAggregation(payload[2:])...)
+		case naluType == 49: // FU
+			if len(payload) < 3 {
+				return
+			}
+			fuHeader := payload[2]
+			if fuHeader&0x80 != 0 {
+				fuType := fuHeader & 0x3f
+				t.fuBuffer = []byte{payload[0]&0x81 | fuType<<1, payload[1]}
+			}
+			if t.fuBuffer != nil {
+				t.fuBuffer = append(t.fuBuffer, payload[3:]...)
+			}
+			if fuHeader&0x40 != 0 && t.fuBuffer != nil {
+				t.frame = append(t.frame, t.fuBuffer)
+				t.fuBuffer = nil
+			}
+		}
+	}
+
+	if marker {
+		r.flushVideoFrame(t)
+	}
+}
+
+// flushVideoFrame 输出一个完整的视频访问单元（Annex-B 格式）
+func (r *rtspReader) flushVideoFrame(t *rtspTrack) {
+	if len(t.frame) == 0 {
+		return
+	}
+
+	keyFrame, hasSPS := false, false
+	for _, nalu := range t.frame {
+		if isKeyFrameNALU(t.codec, nalu) {
+			keyFrame = true
+		}
+		if isSPSNALU(t.codec, nalu) {
+			hasSPS = true
+		}
+	}
+	if keyFrame && !hasSPS {
+		t.frame = append(append([][]byte{}, t.paramSets...), t.frame...)
+	}
+	size := 0
+	for _, nalu := range t.frame {
+		size += 4 + len(nalu)
+	}
+	data := make([]byte, 0, size)
+	for _, nalu := range t.frame {
+		data = append(data, 0, 0, 0, 1)
+		data = append(data, nalu...)
+	}
+	t.frame = nil
+
+	// RTP 解包后统一以 av.H264 类型进入采样循环，实际编码由 videoCodec 给出
+	r.pending = append(r.pending, av.Packet{
+		Type:       av.H264,
+		Data:       data,
+		Time:       t.extendedTime(t.frameTS),
+		IsKeyFrame: keyFrame,
+	})
+}
+
+// depacketizeAAC 按 RFC 3640（AAC-hbr）拆分 AU
+func (r *rtspReader) depacketizeAAC(t *rtspTrack, payload []byte, ts uint32) {
+	if len(payload) < 2 || t.clockRate <= 0 {
+		return
+	}
+	headersLen := int(binary.BigEndian.Uint16(payload[:2])) / 8
+	if 2+headersLen > len(payload) {
+		return
+	}
+	headers := payload[2 : 2+headersLen]
+	data := payload[2+headersLen:]
+
+	base := t.extendedTime(ts)
+	for i := 0; i+2 <= len(headers); i += 2 {
+		size := int(binary.BigEndian.Uint16(headers[i:i+2]) >> 3)
+		if size > len(data) {
+			return
+		}
+		// 每个 AAC 帧 1024 个采样
+		offset := time.Duration(i/2*1024) * time.Second / time.Duration(t.clockRate)
+		r.pending = append(r.pending, av.Packet{
+			Type: av.AAC,
+			Data: data[:size],
+			Time: base + offset,
+		})
+		data = data[size:]
+	}
+}
+
+// splitAggregation 拆分 STAP-A / AP 聚合包（每个 NALU 前有 2 字节长度）
+func splitAggregation(b []byte) [][]byte {
+	var nalus [][]byte
+	for len(b) >= 2 {
+		size := int(binary.BigEndian.Uint16(b[:2]))
+		b = b[2:]
+		if size == 0 || size > len(b) {
+			break
+		}
+		nalus = append(nalus, append([]byte(nil), b[:size]...))
+		b = b[size:]
+	}
+	return nalus
+}
+
+// isKeyFrameNALU 判断 NALU 是否为关键帧（H.264 IDR / H.265 IRAP）
+func isKeyFrameNALU(codec string, nalu []byte) bool {
+	if len(nalu) == 0 {
+		return false
+	}
+	if codec == "H265" {
+		naluType := (nalu[0] >> 1) & 0x3f
+		return naluType >= 16 && naluType <= 21
+	}
+	return nalu[0]&0x1f == 5
+}
+
+// isSPSNALU 判断 NALU 是否为 SPS
+func isSPSNALU(codec string, nalu []byte) bool {
+	if len(nalu) == 0 {
+		return false
+	}
+	if codec == "H265" {
+		return (nalu[0]>>1)&0x3f == 33
+	}
+	return nalu[0]&0x1f == 7
+}
+
+// spropParameterSets 解析 SDP fmtp 中 base64 编码的参数集
+// （H.264 为 sprop-parameter-sets，H.265 为 sprop-vps / sprop-sps / sprop-pps）
+func spropParameterSets(t *rtspTrack) [][]byte {
+	keys := []string{"sprop-parameter-sets"}
+	if t.codec == "H265" {
+		keys = []string{"sprop-vps", "sprop-sps", "sprop-pps"}
+	}
+
+	var sets [][]byte
+	for _, key := range keys {
+		for _, v := range strings.Split(t.fmtp[key], ",") {
+			if b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v)); err == nil && len(b) > 0 {
+				sets = append(sets, b)
+			}
+		}
+	}
+	return sets
+}
+
+// stats 汇总所有轨道的丢包率和视频轨道的抖动
+func (r *rtspReader) stats() rtspStats {
+	var st rtspStats
+	streams := make([]*rtpStats, 0, len(r.tracks))
+	for _, t := range r.tracks {
+		streams = append(streams, &t.rtpStats)
+		if t.media == "video" && t.initialized {
+			st.jitter = t.jitterMs()
+		}
+	}
+	st.lostPackets, st.packetLossRatio = rtpLoss(streams)
+	return st
+}
+
+// listenRTPPair 监听一对相邻端口（RTP 偶数，RTCP 奇数）
+func listenRTPPair() (net.PacketConn, net.PacketConn, error) {
+	for i := 0; i < 16; i++ {
+		rtpConn, err := net.ListenPacket("udp", ":0")
+		if err != nil {
+			return nil, nil, fmt.Errorf("监听 UDP 端口失败: %w", err)
+		}
+		port := rtpConn.LocalAddr().(*net.UDPAddr).Port
+		if port%2 != 0 {
+			rtpConn.Close()
+			continue
+		}
+		rtcpConn, err := net.ListenPacket("udp", fmt.Sprintf(":%d", port+1))
+		if err != nil {
+			rtpConn.Close()
+			continue
+		}
+		return rtpConn, rtcpConn, nil
+	}
+	return nil, nil, fmt.Errorf("无法分配 RTP/RTCP 端口对")
+}
+
+// startUDPReader 在后台读取 UDP RTP 包
+func (r *rtspReader) startUDPReader(conn net.PacketConn, t *rtspTrack) {
+	if r.udpPkts == nil {
+		r.udpPkts = make(chan rtspUDPPacket, 1024)
+	}
+	go func() {
+		buf := make([]byte, 65536)
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			p := rtspUDPPacket{track: t, data: append([]byte(nil), buf[:n]...), arrival: time.Now()}
+			select {
+			case r.udpPkts <- p:
+			case <-r.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close 发送 TEARDOWN 并关闭连接
+func (r *rtspReader) Close() error {
+	if r.session != "" {
+		r.conn.SetDeadline(time.Now().Add(time.Second))
+		r.cseq++
+		fmt.Fprintf(r.conn, "TEARDOWN %s RTSP/1.0\r\nCSeq: %d\r\nSession: %s\r\n\r\n", r.baseURL, r.cseq, r.session)
+	}
+	for _, c := range r.udpConns {
+		c.Close()
+	}
+	return r.conn.Close()
+}
+
+// parseSDP 解析 SDP 中的媒体轨道
+func parseSDP(body []byte) []*rtspTrack {
+	var tracks []*rtspTrack
+	var cur *rtspTrack
+	var payloadType string
+
+	for _, line := range strings.Split(string(body), "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "m="):
+			fields := strings.Fields(line[2:])
+			cur = &rtspTrack{fmtp: make(map[string]string)}
+			if len(fields) > 0 {
+				cur.media = fields[0]
+			}
+			payloadType = ""
+			if len(fields) > 3 {
+				payloadType = fields[3]
+			}
+			tracks = append(tracks, cur)
+		case cur == nil:
+			// 会话级属性忽略
+		case strings.HasPrefix(line, "a=control:"):
+			cur.control = strings.TrimPrefix(line, "a=control:")
+		case strings.HasPrefix(line, "a=rtpmap:"+payloadType+" "):
+			// a=rtpmap:96 H264/90000
+			enc := strings.Split(strings.Fields(line)[1], "/")
+			cur.codec = strings.ToUpper(enc[0])
+			if len(enc) > 1 {
+				cur.clockRate, _ = strconv.Atoi(enc[1])
+			}
+		case strings.HasPrefix(line, "a=fmtp:"+payloadType+" "):
+			params := strings.SplitN(line, " ", 2)[1]
+			for _, kv := range strings.Split(params, ";") {
+				if k, v, ok := strings.Cut(strings.TrimSpace(kv), "="); ok {
+					cur.fmtp[strings.ToLower(k)] = v
+				}
+			}
+		}
+	}
+
+	for _, t := range tracks {
+		if t.clockRate < 0 {
+			t.clockRate = 0
+		}
+		switch {
+		case t.media == "video":
+			if t.clockRate == 0 {
+				t.clockRate = 90000
+			}
+			t.paramSets = spropParameterSets(t)
+		case t.codec == "MPEG4-GENERIC" && t.clockRate == 0:
+			// rtpmap 没有给出或无法解析时钟频率时按 fmtp config 中的采样率，仍未知时不使用该轨道
+			if asc, err := hex.DecodeString(t.fmtp["config"]); err == nil {
+				if info, err := parseAudioSpecificConfig(asc); err == nil {
+					t.clockRate = info.sampleRate
+				}
+			}
+		}
+	}
+	return tracks
+}
+
+// isRTSPURL 根据 scheme 判断是否为 RTSP 地址
+func isRTSPURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "rtsp"
+}
+
+// rtspProber RTSP 探测器
+type rtspProber struct{}
+
+// Open 完成 DESCRIBE/SETUP/PLAY 并开始接收 RTP
+func (rtspProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openRTSP(ctx, opts.URL, opts.RTSPTransport)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r:            &avPacketReader{r: r, videoCodec: func() string { return r.videoCodec }, ptsOnly: true},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			// 使用 RTP 序列号计算真实丢包率，使用 RFC 3550 公式计算抖动
+			st := r.stats()
+			rep.PacketLossRatio = st.packetLossRatio
+			rep.NetworkJitter = st.jitter
+			opts.Log.Debug("RTP 统计", "丢包数", st.lostPackets, "传输方式", opts.RTSPTransport)
+		},
+	}, nil
+}
@@ -0,0 +1,216 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+func TestParseSDP(t *testing.T) {
+	tests := []struct {
+		name      string
+		sdp       string
+		codec     string
+		clockRate int
+	}{
+		{"视频默认 90kHz", "m=video 0 RTP/AVP 96\na=rtpmap:96 H264\n", "H264", 90000},
+		{"音频 rtpmap 给出时钟频率", "m=audio 0 RTP/AVP 97\na=rtpmap:97 mpeg4-generic/48000/2\n", "MPEG4-GENERIC", 48000},
+		{
+			name:  "音频缺少时钟频率时按 config 采样率",
+			sdp:   "m=audio 0 RTP/AVP 97\na=rtpmap:97 MPEG4-GENERIC\na=fmtp:97 streamtype=5; mode=AAC-hbr; config=1210\n",
+			codec: "MPEG4-GENERIC", clockRate: 44100,
+		},
+		{
+			name:  "音频时钟频率无法解析时按 config 采样率",
+			sdp:   "m=audio 0 RTP/AVP 97\na=rtpmap:97 MPEG4-GENERIC/abc\na=fmtp:97 config=1190\n",
+			codec: "MPEG4-GENERIC", clockRate: 48000,
+		},
+		{"音频时钟频率和 config 都缺失", "m=audio 0 RTP/AVP 97\na=rtpmap:97 MPEG4-GENERIC\n", "MPEG4-GENERIC", 0},
+		{"负的时钟频率", "m=audio 0 RTP/AVP 97\na=rtpmap:97 MPEG4-GENERIC/-1\n", "MPEG4-GENERIC", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracks := parseSDP([]byte(tt.sdp))
+			if len(tracks) != 1 {
+				t.Fatalf("tracks = %d, want 1", len(tracks))
+			}
+			if tracks[0].codec != tt.codec || tracks[0].clockRate != tt.clockRate {
+				t.Errorf("codec=%q clockRate=%d, want %q %d", tracks[0].codec, tracks[0].clockRate, tt.codec, tt.clockRate)
+			}
+		})
+	}
+}
+
+// aacRTPPayload 构造 RFC 3640 AAC-hbr 负载（每个 AU 头 13 位长度 + 3 位索引）
+func aacRTPPayload(frames ...[]byte) []byte {
+	out := binary.BigEndian.AppendUint16(nil, uint16(16*len(frames)))
+	for _, f := range frames {
+		out = binary.BigEndian.AppendUint16(out, uint16(len(f)<<3))
+	}
+	for _, f := range frames {
+		out = append(out, f...)
+	}
+	return out
+}
+
+func TestDepacketizeAAC(t *testing.T) {
+	payload := aacRTPPayload([]byte{1, 2, 3}, []byte{4, 5})
+
+	r := &rtspReader{}
+	track := &rtspTrack{codec: "MPEG4-GENERIC", rtpStats: rtpStats{clockRate: 48000}}
+	r.depacketizeAAC(track, payload, 0)
+	if len(r.pending) != 2 {
+		t.Fatalf("pending = %d, want 2", len(r.pending))
+	}
+	if !bytes.Equal(r.pending[1].Data, []byte{4, 5}) || r.pending[1].Time != 1024*time.Second/48000 {
+		t.Errorf("第二帧 data=%x time=%v", r.pending[1].Data, r.pending[1].Time)
+	}
+
+	// 时钟频率未知时丢弃，不能除零
+	r = &rtspReader{}
+	r.depacketizeAAC(&rtspTrack{codec: "MPEG4-GENERIC"}, payload, 0)
+	if len(r.pending) != 0 {
+		t.Errorf("时钟频率为 0 时 pending = %d, want 0", len(r.pending))
+	}
+
+	// AU 长度超出负载
+	r = &rtspReader{}
+	r.depacketizeAAC(track, append(aacRTPPayload(make([]byte, 10))[:4], 1, 2), 0)
+	if len(r.pending) != 0 {
+		t.Errorf("AU 长度超出负载时 pending = %d, want 0", len(r.pending))
+	}
+}
+
+func TestDepacketizeVideo(t *testing.T) {
+	sps := []byte{0x67, 0x64, 0x00, 0x1f}
+	pps := []byte{0x68, 0xce}
+	idr := append([]byte{0x65}, bytes.Repeat([]byte{0xaa}, 6)...)
+	hevcIDR := append([]byte{0x26, 0x01}, bytes.Repeat([]byte{0xbb}, 6)...)
+
+	type rtpPayload struct {
+		data   []byte
+		ts     uint32
+		marker bool
+	}
+	annexB := func(nalus ...[]byte) []byte {
+		var out []byte
+		for _, n := range nalus {
+			out = append(append(out, 0, 0, 0, 1), n...)
+		}
+		return out
+	}
+	aggregate := func(header []byte, nalus ...[]byte) []byte {
+		out := slices.Clone(header)
+		for _, n := range nalus {
+			out = binary.BigEndian.AppendUint16(out, uint16(len(n)))
+			out = append(out, n...)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name      string
+		codec     string
+		paramSets [][]byte
+		payloads  []rtpPayload
+		frames    [][]byte
+		keyFrames []bool
+	}{
+		{
+			name:      "单 NALU 包",
+			codec:     "H264",
+			payloads:  []rtpPayload{{sps, 0, false}, {pps, 0, false}, {idr, 0, true}},
+			frames:    [][]byte{annexB(sps, pps, idr)},
+			keyFrames: []bool{true},
+		},
+		{
+			name:      "STAP-A",
+			codec:     "H264",
+			payloads:  []rtpPayload{{aggregate([]byte{24}, sps, pps), 0, false}, {idr, 0, true}},
+			frames:    [][]byte{annexB(sps, pps, idr)},
+			keyFrames: []bool{true},
+		},
+		{
+			name:  "FU-A 分片，关键帧补上 SDP 中的参数集",
+			codec: "H264", paramSets: [][]byte{sps, pps},
+			payloads: []rtpPayload{
+				{append([]byte{0x7c, 0x85}, idr[1:3]...), 0, false}, // S 位
+				{append([]byte{0x7c, 0x05}, idr[3:5]...), 0, false},
+				{append([]byte{0x7c, 0x45}, idr[5:]...), 0, true}, // E 位
+			},
+			frames:    [][]byte{annexB(sps, pps, idr)},
+			keyFrames: []bool{true},
+		},
+		{
+			name:  "FU-A 缺少起始分片时丢弃",
+			codec: "H264",
+			payloads: []rtpPayload{
+				{append([]byte{0x7c, 0x05}, idr[3:5]...), 0, false},
+				{append([]byte{0x7c, 0x45}, idr[5:]...), 0, true},
+				{[]byte{0x41, 0x9a}, 3600, true},
+			},
+			frames:    [][]byte{annexB([]byte{0x41, 0x9a})},
+			keyFrames: []bool{false},
+		},
+		{
+			name:      "marker 丢失时按时间戳分帧",
+			codec:     "H264",
+			payloads:  []rtpPayload{{[]byte{0x41, 0x01}, 0, false}, {[]byte{0x41, 0x02}, 3600, true}},
+			frames:    [][]byte{annexB([]byte{0x41, 0x01}), annexB([]byte{0x41, 0x02})},
+			keyFrames: []bool{false, false},
+		},
+		{
+			name:  "H.265 AP 和 FU",
+			codec: "H265",
+			payloads: []rtpPayload{
+				{aggregate([]byte{48 << 1, 0x01}, []byte{0x40, 0x01, 0x0c}, []byte{0x42, 0x01, 0x01}), 0, false},
+				{append([]byte{49 << 1, 0x01, 0x80 | 19}, hevcIDR[2:5]...), 0, false},
+				{append([]byte{49 << 1, 0x01, 0x40 | 19}, hevcIDR[5:]...), 0, true},
+			},
+			frames:    [][]byte{annexB([]byte{0x40, 0x01, 0x0c}, []byte{0x42, 0x01, 0x01}, hevcIDR)},
+			keyFrames: []bool{true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &rtspReader{}
+			track := &rtspTrack{codec: tt.codec, paramSets: tt.paramSets, rtpStats: rtpStats{clockRate: 90000}}
+			for _, p := range tt.payloads {
+				r.depacketizeVideo(track, p.data, p.ts, p.marker)
+			}
+			if len(r.pending) != len(tt.frames) {
+				t.Fatalf("frames = %d, want %d", len(r.pending), len(tt.frames))
+			}
+			for i, pkt := range r.pending {
+				if pkt.Type != av.H264 || !bytes.Equal(pkt.Data, tt.frames[i]) || pkt.IsKeyFrame != tt.keyFrames[i] {
+					t.Errorf("frame %d = %x key=%v, want %x key=%v", i, pkt.Data, pkt.IsKeyFrame, tt.frames[i], tt.keyFrames[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSplitAggregation(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"两个 NALU", []byte{0, 2, 0x67, 0x64, 0, 1, 0x68}, [][]byte{{0x67, 0x64}, {0x68}}},
+		{"长度超出数据", []byte{0, 1, 0x67, 0, 9, 0x68}, [][]byte{{0x67}}},
+		{"长度为 0", []byte{0, 0, 0x67}, nil},
+		{"空", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitAggregation(tt.data)
+			if !slices.EqualFunc(got, tt.want, bytes.Equal) {
+				t.Errorf("splitAggregation() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package stream
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	urlpkg "net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"video-exporter/internal/config"
+)
+
+// CDN 签名方式
+const (
+	SignTencent = "tencent" // txSecret = md5(key + StreamName + txTime)，txTime 为十六进制过期时间
+	SignAliyun  = "aliyun"  // auth_key = timestamp-rand-uid-md5(URI-timestamp-rand-uid-key)
+	SignHMAC    = "hmac"    // token = hex(HMAC(key, URI + expires))
+)
+
+// signURL 按 CDN 鉴权方式为地址生成签名参数（已有的同名参数会被替换），未配置签名方式时原样返回
+func signURL(rawURL string, cfg config.SignConfig, now time.Time) (string, error) {
+	if cfg.Type == "" {
+		return rawURL, nil
+	}
+
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("无效的地址: %w", err)
+	}
+	key, err := cfg.Key.Resolve()
+	if err != nil {
+		return "", fmt.Errorf("读取签名密钥失败: %w", err)
+	}
+
+	expire := cfg.Expire
+	if expire <= 0 {
+		expire = 3600
+	}
+	expiry := now.Add(time.Duration(expire) * time.Second).Unix()
+	uri := u.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+
+	var params [][2]string
+	switch strings.ToLower(cfg.Type) {
+	case SignTencent:
+		// StreamName 为路径最后一段去掉扩展名，例如 /live/stream1.flv 中的 stream1
+		streamName := strings.TrimSuffix(path.Base(u.Path), path.Ext(u.Path))
+		txTime := strings.ToUpper(strconv.FormatInt(expiry, 16))
+		params = [][2]string{{"txSecret", md5Hex(key + streamName + txTime)}, {"txTime", txTime}}
+	case SignAliyun:
+		// rand 和 uid 固定为 0
+		timestamp := strconv.FormatInt(expiry, 10)
+		hash := md5Hex(uri + "-" + timestamp + "-0-0-" + key)
+		params = [][2]string{{"auth_key", timestamp + "-0-0-" + hash}}
+	case SignHMAC:
+		newHash, err := hmacHash(cfg.Algorithm)
+		if err != nil {
+			return "", err
+		}
+		tokenParam, expiresParam := cfg.TokenParam, cfg.ExpiresParam
+		if tokenParam == "" {
+			tokenParam = "token"
+		}
+		if expiresParam == "" {
+			expiresParam = "expires"
+		}
+		expires := strconv.FormatInt(expiry, 10)
+		mac := hmac.New(newHash, []byte(key))
+		mac.Write([]byte(uri + expires))
+		params = [][2]string{{tokenParam, hex.EncodeToString(mac.Sum(nil))}, {expiresParam, expires}}
+	default:
+		return "", fmt.Errorf("不支持的签名方式: %s", cfg.Type)
+	}
+	u.RawQuery = setQueryParams(u.RawQuery, params)
+	return u.String(), nil
+}
+
+// setQueryParams 在原查询串末尾追加参数并移除同名的旧参数，其他参数的顺序和转义保持不变，
+// 部分 CDN 按原始查询串校验签名，重新编码会导致校验失败
+func setQueryParams(rawQuery string, params [][2]string) string {
+	var parts []string
+	for _, part := range strings.Split(rawQuery, "&") {
+		if part == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(part, "=")
+		if unescaped, err := urlpkg.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if !slices.ContainsFunc(params, func(p [2]string) bool { return p[0] == name }) {
+			parts = append(parts, part)
+		}
+	}
+	for _, p := range params {
+		parts = append(parts, urlpkg.QueryEscape(p[0])+"="+urlpkg.QueryEscape(p[1]))
+	}
+	return strings.Join(parts, "&")
+}
+
+// redactedError 去掉地址查询参数后的错误，Unwrap 仍返回原错误
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactURLError 去掉错误信息中请求地址的查询参数，避免签名参数和 token 随错误进入日志和指标
+func redactURLError(err error) error {
+	var ue *urlpkg.Error
+	if !errors.As(err, &ue) {
+		return err
+	}
+	u, perr := urlpkg.Parse(ue.URL)
+	if perr != nil || u.RawQuery == "" && !u.ForceQuery && u.Fragment == "" {
+		return err
+	}
+	u.RawQuery, u.ForceQuery, u.Fragment = "", false, ""
+	// url.Error 以 %q 格式输出地址
+	msg := strings.ReplaceAll(err.Error(), strconv.Quote(ue.URL), strconv.Quote(u.String()))
+	return &redactedError{msg: msg, err: err}
+}
+
+// hmacHash 按名称选择 HMAC 的哈希算法，默认 sha256
+func hmacHash(algorithm string) (func() hash.Hash, error) {
+	switch strings.ToLower(algorithm) {
+	case "", "sha256":
+		return sha256.New, nil
+	case "sha1":
+		return sha1.New, nil
+	case "sha512":
+		return sha512.New, nil
+	case "md5":
+		return md5.New, nil
+	default:
+		return nil, fmt.Errorf("不支持的 HMAC 算法: %s", algorithm)
+	}
+}
+
+// md5Hex 返回小写十六进制的 MD5
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	urlpkg "net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"video-exporter/internal/config"
+)
+
+func TestSignURL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expiry := now.Add(time.Hour).Unix()
+	t.Setenv("TEST_SIGN_KEY", "k3y")
+
+	hmacHex := func(newHash func() hash.Hash, msg string) string {
+		mac := hmac.New(newHash, []byte("k3y"))
+		mac.Write([]byte(msg))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+	sha256Token := hmacHex(sha256.New, "/live/stream1.flv"+strconv.FormatInt(expiry, 10))
+	sha1Token := hmacHex(sha1.New, "/live/stream1.flv"+strconv.FormatInt(now.Add(time.Minute).Unix(), 10))
+	txTime := strings.ToUpper(strconv.FormatInt(expiry, 16))
+
+	tests := []struct {
+		name    string
+		url     string
+		cfg     config.SignConfig
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "未配置签名",
+			url:  "https://cdn.example.com/live/stream1.flv?b=2&a=1",
+			want: "https://cdn.example.com/live/stream1.flv?b=2&a=1",
+		},
+		{
+			name: "腾讯云",
+			url:  "https://cdn.example.com/live/stream1.flv",
+			cfg:  config.SignConfig{Type: "tencent", Key: "env:TEST_SIGN_KEY"},
+			want: "https://cdn.example.com/live/stream1.flv?txSecret=" + md5Hex("k3ystream1"+txTime) + "&txTime=" + txTime,
+		},
+		{
+			name: "阿里云保留原参数顺序和转义",
+			url:  "https://cdn.example.com/live/stream1.flv?z=1&a=%2F&plain=x+y",
+			cfg:  config.SignConfig{Type: "aliyun", Key: "k3y"},
+			want: fmt.Sprintf("https://cdn.example.com/live/stream1.flv?z=1&a=%%2F&plain=x+y&auth_key=%d-0-0-%s",
+				expiry, md5Hex(fmt.Sprintf("/live/stream1.flv-%d-0-0-k3y", expiry))),
+		},
+		{
+			name: "HMAC 默认参数名",
+			url:  "https://cdn.example.com/live/stream1.flv",
+			cfg:  config.SignConfig{Type: "HMAC", Key: "k3y"},
+			want: fmt.Sprintf("https://cdn.example.com/live/stream1.flv?token=%s&expires=%d", sha256Token, expiry),
+		},
+		{
+			name: "HMAC 替换已有的同名参数",
+			url:  "https://cdn.example.com/live/stream1.flv?sig=old&foo=bar&e=1",
+			cfg:  config.SignConfig{Type: "hmac", Key: "k3y", Algorithm: "sha1", Expire: 60, TokenParam: "sig", ExpiresParam: "e"},
+			want: fmt.Sprintf("https://cdn.example.com/live/stream1.flv?foo=bar&sig=%s&e=%d", sha1Token, now.Add(time.Minute).Unix()),
+		},
+		{name: "不支持的签名方式", url: "https://cdn.example.com/a.flv", cfg: config.SignConfig{Type: "bogus", Key: "k3y"}, wantErr: true},
+		{name: "不支持的 HMAC 算法", url: "https://cdn.example.com/a.flv", cfg: config.SignConfig{Type: "hmac", Key: "k3y", Algorithm: "crc32"}, wantErr: true},
+		{name: "密钥环境变量未设置", url: "https://cdn.example.com/a.flv", cfg: config.SignConfig{Type: "tencent", Key: "env:TEST_SIGN_MISSING"}, wantErr: true},
+		{name: "无效地址", url: "://bad", cfg: config.SignConfig{Type: "tencent", Key: "k3y"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := signURL(tt.url, tt.cfg, now)
+			if (err != nil) != tt.wantErr || got != tt.want {
+				t.Errorf("signURL() = %q, %v\nwant %q wantErr %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetQueryParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawQuery string
+		params   [][2]string
+		want     string
+	}{
+		{"空查询串", "", [][2]string{{"token", "a b"}}, "token=a+b"},
+		{"保留原顺序", "b=2&a=1", [][2]string{{"token", "t"}}, "b=2&a=1&token=t"},
+		{"移除同名参数", "token=old&a=1&token=older", [][2]string{{"token", "new"}}, "a=1&token=new"},
+		{"移除转义后同名的参数", "to%6Ben=old&a=%2f", [][2]string{{"token", "new"}}, "a=%2f&token=new"},
+		{"保留无值参数", "flag&a=1", [][2]string{{"e", "1"}}, "flag&a=1&e=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := setQueryParams(tt.rawQuery, tt.params); got != tt.want {
+				t.Errorf("setQueryParams() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactURLError(t *testing.T) {
+	ue := &urlpkg.Error{Op: "Get", URL: "https://cdn.example.com/live/a.flv?txSecret=abc&txTime=1", Err: errors.New("dial tcp: i/o timeout")}
+	err := redactURLError(fmt.Errorf("连接失败: %w", ue))
+	want := `连接失败: Get "https://cdn.example.com/live/a.flv": dial tcp: i/o timeout`
+	if err.Error() != want {
+		t.Errorf("err = %q, want %q", err, want)
+	}
+	if !errors.Is(err, ue) {
+		t.Error("脱敏后的错误应能 Unwrap 到原错误")
+	}
+
+	plain := errors.New("HTTP状态码: 403")
+	if got := redactURLError(plain); got != plain {
+		t.Errorf("非 url.Error 应原样返回: %v", got)
+	}
+	noQuery := &urlpkg.Error{Op: "Get", URL: "https://cdn.example.com/live/a.flv", Err: errors.New("EOF")}
+	if got := redactURLError(noQuery); got != error(noQuery) {
+		t.Errorf("没有查询参数时应原样返回: %v", got)
+	}
+}
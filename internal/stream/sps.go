@@ -0,0 +1,780 @@
+package stream
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// videoInfo 从 SPS 解析出的视频参数
+type videoInfo struct {
+	width        int
+	height       int
+	profile      string  // 例如 High、Main 10
+	level        string  // 例如 3.1、4
+	chromaFormat string  // 4:0:0 / 4:2:0 / 4:2:2 / 4:4:4
+	bitDepth     int     // 亮度位深
+	frameRate    float64 // VUI timing_info 中的帧率，0 表示未携带
+}
+
+var errSPSTruncated = errors.New("SPS 数据不完整")
+
+// chromaFormatNames chroma_format_idc 对应的采样格式
+var chromaFormatNames = [...]string{"4:0:0", "4:2:0", "4:2:2", "4:4:4"}
+
+// parseVideoInfo 从解码配置（avcC / hvcC）或视频帧（Annex-B / 长度前缀）中查找 SPS 并解析，
+// 仅支持 H.264 和 H.265
+func parseVideoInfo(codec string, data []byte, config bool) (videoInfo, bool) {
+	var nalus [][]byte
+	if config {
+		nalus = configRecordNALUs(codec, data)
+	} else {
+		nalus = splitNALUs(data)
+	}
+
+	for _, nalu := range nalus {
+		var info videoInfo
+		var err error
+		switch {
+		case codec == "H264" && len(nalu) > 1 && nalu[0]&0x1f == 7:
+			info, err = parseH264SPS(nalu[1:])
+		case codec == "H265" && len(nalu) > 2 && (nalu[0]>>1)&0x3f == 33:
+			info, err = parseH265SPS(nalu[2:])
+		default:
+			continue
+		}
+		if err == nil && info.width > 0 && info.height > 0 {
+			return info, true
+		}
+	}
+	return videoInfo{}, false
+}
+
+// configRecordNALUs 取出 AVCDecoderConfigurationRecord / HEVCDecoderConfigurationRecord 中的参数集
+func configRecordNALUs(codec string, record []byte) [][]byte {
+	var nalus [][]byte
+	switch codec {
+	case "H264":
+		// version(8) profile(8) compat(8) level(8) lengthSizeMinusOne(8) numOfSPS(8)，之后是 SPS 和 PPS
+		if len(record) < 6 {
+			return nil
+		}
+		b := record[6:]
+		count := int(record[5] & 0x1f)
+		for list := 0; list < 2; list++ {
+			for i := 0; i < count && len(b) >= 2; i++ {
+				n := int(binary.BigEndian.Uint16(b))
+				if 2+n > len(b) {
+					return nalus
+				}
+				nalus = append(nalus, b[2:2+n])
+				b = b[2+n:]
+			}
+			if list == 0 {
+				if len(b) < 1 {
+					return nalus
+				}
+				count = int(b[0])
+				b = b[1:]
+			}
+		}
+	case "H265":
+		// 固定部分 22 字节，之后是 numOfArrays 和按 NAL 类型分组的参数集
+		if len(record) < 23 {
+			return nil
+		}
+		b := record[23:]
+		for arrays := int(record[22]); arrays > 0 && len(b) >= 3; arrays-- {
+			count := int(binary.BigEndian.Uint16(b[1:]))
+			b = b[3:]
+			for i := 0; i < count && len(b) >= 2; i++ {
+				n := int(binary.BigEndian.Uint16(b))
+				if 2+n > len(b) {
+					return nalus
+				}
+				nalus = append(nalus, b[2:2+n])
+				b = b[2+n:]
+			}
+		}
+	}
+	return nalus
+}
+
+// splitNALUs 拆分视频帧中的 NALU：以起始码开头按 Annex-B 拆分，否则按 4 字节长度前缀（FLV / RTMP）拆分
+func splitNALUs(data []byte) [][]byte {
+	if len(data) >= 4 && data[0] == 0 && data[1] == 0 && (data[2] == 1 || data[2] == 0 && data[3] == 1) {
+		return splitAnnexB(data)
+	}
+
+	var nalus [][]byte
+	for len(data) >= 4 {
+		n := int(binary.BigEndian.Uint32(data))
+		data = data[4:]
+		if n == 0 || n > len(data) {
+			break
+		}
+		nalus = append(nalus, data[:n])
+		data = data[n:]
+	}
+	return nalus
+}
+
+// splitAnnexB 按 00 00 01 / 00 00 00 01 起始码拆分 NALU
+func splitAnnexB(data []byte) [][]byte {
+	var nalus [][]byte
+	start := -1
+	for i := 0; i+2 < len(data); i++ {
+		if data[i] != 0 || data[i+1] != 0 || data[i+2] != 1 {
+			continue
+		}
+		if start >= 0 {
+			end := i
+			if end > start && data[end-1] == 0 {
+				end--
+			}
+			nalus = append(nalus, data[start:end])
+		}
+		start = i + 3
+		i += 2
+	}
+	if start >= 0 && start < len(data) {
+		nalus = append(nalus, data[start:])
+	}
+	return nalus
+}
+
+// bitReader 按位读取去除防竞争字节后的 RBSP
+type bitReader struct {
+	data []byte
+	pos  int // 位偏移
+}
+
+// newRBSPReader 去除 00 00 03 中的防竞争字节
+func newRBSPReader(b []byte) *bitReader {
+	rbsp := make([]byte, 0, len(b))
+	zeros := 0
+	for _, c := range b {
+		if zeros >= 2 && c == 3 {
+			zeros = 0
+			continue
+		}
+		if c == 0 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+		rbsp = append(rbsp, c)
+	}
+	return &bitReader{data: rbsp}
+}
+
+// bits 读取 n 位（n <= 32）
+func (r *bitReader) bits(n int) (uint32, error) {
+	if r.pos+n > len(r.data)*8 {
+		return 0, errSPSTruncated
+	}
+	var v uint32
+	for i := 0; i < n; i++ {
+		bit := r.data[r.pos/8] >> (7 - r.pos%8) & 1
+		v = v<<1 | uint32(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+// skip 跳过 n 位
+func (r *bitReader) skip(n int) error {
+	if r.pos+n > len(r.data)*8 {
+		return errSPSTruncated
+	}
+	r.pos += n
+	return nil
+}
+
+// ue 读取无符号指数哥伦布编码
+func (r *bitReader) ue() (uint32, error) {
+	zeros := 0
+	for {
+		b, err := r.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		if b == 1 {
+			break
+		}
+		zeros++
+		if zeros > 31 {
+			return 0, fmt.Errorf("指数哥伦布编码过长")
+		}
+	}
+	v, err := r.bits(zeros)
+	if err != nil {
+		return 0, err
+	}
+	return (1<<zeros - 1) + v, nil
+}
+
+// se 读取有符号指数哥伦布编码
+func (r *bitReader) se() (int32, error) {
+	v, err := r.ue()
+	if err != nil {
+		return 0, err
+	}
+	if v&1 == 1 {
+		return int32(v/2 + 1), nil
+	}
+	return -int32(v / 2), nil
+}
+
+// ues 依次读取多个无符号指数哥伦布字段，任一失败即返回错误
+func (r *bitReader) ues(dst ...*uint32) error {
+	for _, d := range dst {
+		v, err := r.ue()
+		if err != nil {
+			return err
+		}
+		*d = v
+	}
+	return nil
+}
+
+// formatLevel 把 level_idc 转换为级别名称，scale 为级别的倍数（H.264 为 10，H.265 为 30），例如 4、3.1
+func formatLevel(levelIdc, scale uint32) string {
+	major, minor := levelIdc/scale, levelIdc%scale*10/scale
+	if minor == 0 {
+		return fmt.Sprintf("%d", major)
+	}
+	return fmt.Sprintf("%d.%d", major, minor)
+}
+
+// h264ProfileName H.264 profile_idc 对应的名称
+func h264ProfileName(profileIdc, constraints uint32) string {
+	switch profileIdc {
+	case 66:
+		if constraints&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4 Predictive"
+	case 44:
+		return "CAVLC 4:4:4 Intra"
+	}
+	return fmt.Sprintf("%d", profileIdc)
+}
+
+// parseH264SPS 解析 H.264 SPS（不含 NAL 头），见 ITU-T H.264 7.3.2.1.1
+func parseH264SPS(b []byte) (videoInfo, error) {
+	r := newRBSPReader(b)
+	profileIdc, err := r.bits(8)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	constraints, _ := r.bits(8)
+	levelIdc, err := r.bits(8)
+	if err != nil {
+		return videoInfo{}, err
+	}
+
+	var spsID uint32
+	if err := r.ues(&spsID); err != nil {
+		return videoInfo{}, err
+	}
+
+	chromaFormatIdc := uint32(1)
+	separateColourPlane := uint32(0)
+	var bitDepthLuma, bitDepthChroma uint32
+	switch profileIdc {
+	case 100, 110, 122, 244, 44, 83, 86, 118, 128, 138, 139, 134, 135:
+		if err := r.ues(&chromaFormatIdc); err != nil {
+			return videoInfo{}, err
+		}
+		if chromaFormatIdc == 3 {
+			separateColourPlane, _ = r.bits(1)
+		}
+		if err := r.ues(&bitDepthLuma, &bitDepthChroma); err != nil {
+			return videoInfo{}, err
+		}
+		r.skip(1) // qpprime_y_zero_transform_bypass_flag
+		scalingMatrix, err := r.bits(1)
+		if err != nil {
+			return videoInfo{}, err
+		}
+		if scalingMatrix == 1 {
+			lists := 8
+			if chromaFormatIdc == 3 {
+				lists = 12
+			}
+			for i := 0; i < lists; i++ {
+				present, err := r.bits(1)
+				if err != nil {
+					return videoInfo{}, err
+				}
+				if present == 0 {
+					continue
+				}
+				size := 16
+				if i >= 6 {
+					size = 64
+				}
+				last, next := int32(8), int32(8)
+				for j := 0; j < size && next != 0; j++ {
+					delta, err := r.se()
+					if err != nil {
+						return videoInfo{}, err
+					}
+					next = (last + delta + 256) % 256
+					if next != 0 {
+						last = next
+					}
+				}
+			}
+		}
+	}
+
+	var log2MaxFrameNum, pocType uint32
+	if err := r.ues(&log2MaxFrameNum, &pocType); err != nil {
+		return videoInfo{}, err
+	}
+	switch pocType {
+	case 0:
+		var log2MaxPOCLsb uint32
+		if err := r.ues(&log2MaxPOCLsb); err != nil {
+			return videoInfo{}, err
+		}
+	case 1:
+		r.skip(1) // delta_pic_order_always_zero_flag
+		r.se()
+		r.se()
+		var cycle uint32
+		if err := r.ues(&cycle); err != nil {
+			return videoInfo{}, err
+		}
+		for i := uint32(0); i < cycle; i++ {
+			if _, err := r.se(); err != nil {
+				return videoInfo{}, err
+			}
+		}
+	}
+
+	var maxRefFrames, widthMbs, heightMapUnits uint32
+	if err := r.ues(&maxRefFrames); err != nil {
+		return videoInfo{}, err
+	}
+	r.skip(1) // gaps_in_frame_num_value_allowed_flag
+	if err := r.ues(&widthMbs, &heightMapUnits); err != nil {
+		return videoInfo{}, err
+	}
+	frameMbsOnly, err := r.bits(1)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	if frameMbsOnly == 0 {
+		r.skip(1) // mb_adaptive_frame_field_flag
+	}
+	r.skip(1) // direct_8x8_inference_flag
+
+	var cropLeft, cropRight, cropTop, cropBottom uint32
+	cropping, err := r.bits(1)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	if cropping == 1 {
+		if err := r.ues(&cropLeft, &cropRight, &cropTop, &cropBottom); err != nil {
+			return videoInfo{}, err
+		}
+	}
+
+	// 裁剪单位见 H.264 表 6-1 和公式 7-19 ~ 7-22
+	cropUnitX, cropUnitY := 1, int(2-frameMbsOnly)
+	if chromaFormatIdc != 0 && separateColourPlane == 0 {
+		subWidthC, subHeightC := 2, 2
+		switch chromaFormatIdc {
+		case 2:
+			subHeightC = 1
+		case 3:
+			subWidthC, subHeightC = 1, 1
+		}
+		cropUnitX = subWidthC
+		cropUnitY = subHeightC * int(2-frameMbsOnly)
+	}
+
+	info := videoInfo{
+		width:    int(widthMbs+1)*16 - cropUnitX*int(cropLeft+cropRight),
+		height:   int(2-frameMbsOnly)*int(heightMapUnits+1)*16 - cropUnitY*int(cropTop+cropBottom),
+		profile:  h264ProfileName(profileIdc, constraints),
+		level:    formatLevel(levelIdc, 10),
+		bitDepth: int(bitDepthLuma) + 8,
+	}
+	if chromaFormatIdc < uint32(len(chromaFormatNames)) {
+		info.chromaFormat = chromaFormatNames[chromaFormatIdc]
+	}
+	// VUI 只用于取帧率，解析失败不影响其他字段
+	if vui, err := r.bits(1); err == nil && vui == 1 {
+		info.frameRate, _ = parseH264VUIFrameRate(r)
+	}
+	// level_idc 11 且 constraint_set3_flag 置位的 Baseline/Main/Extended 为 Level 1b
+	if levelIdc == 11 && constraints&0x10 != 0 && (profileIdc == 66 || profileIdc == 77 || profileIdc == 88) {
+		info.level = "1b"
+	}
+	return info, nil
+}
+
+// h265ProfileName H.265 general_profile_idc 对应的名称
+func h265ProfileName(profileIdc uint32) string {
+	switch profileIdc {
+	case 1:
+		return "Main"
+	case 2:
+		return "Main 10"
+	case 3:
+		return "Main Still Picture"
+	case 4:
+		return "Range Extensions"
+	case 5:
+		return "High Throughput"
+	case 9:
+		return "Screen Content"
+	}
+	return fmt.Sprintf("%d", profileIdc)
+}
+
+// parseH265SPS 解析 H.265 SPS（不含 NAL 头），见 ITU-T H.265 7.3.2.2
+func parseH265SPS(b []byte) (videoInfo, error) {
+	r := newRBSPReader(b)
+	r.skip(4) // sps_video_parameter_set_id
+	maxSubLayersMinus1, err := r.bits(3)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	r.skip(1) // sps_temporal_id_nesting_flag
+
+	// profile_tier_level(1, sps_max_sub_layers_minus1)
+	r.skip(3) // general_profile_space + general_tier_flag
+	profileIdc, err := r.bits(5)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	r.skip(32 + 48) // compatibility flags + constraint flags
+	levelIdc, err := r.bits(8)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	subLayerFlags := make([][2]uint32, maxSubLayersMinus1)
+	for i := range subLayerFlags {
+		subLayerFlags[i][0], _ = r.bits(1)
+		subLayerFlags[i][1], _ = r.bits(1)
+	}
+	if maxSubLayersMinus1 > 0 {
+		r.skip(int(8-maxSubLayersMinus1) * 2)
+	}
+	for _, f := range subLayerFlags {
+		if f[0] == 1 {
+			r.skip(88)
+		}
+		if f[1] == 1 {
+			r.skip(8)
+		}
+	}
+
+	var spsID, chromaFormatIdc, width, height uint32
+	if err := r.ues(&spsID, &chromaFormatIdc); err != nil {
+		return videoInfo{}, err
+	}
+	if chromaFormatIdc == 3 {
+		r.skip(1) // separate_colour_plane_flag
+	}
+	if err := r.ues(&width, &height); err != nil {
+		return videoInfo{}, err
+	}
+
+	conformanceWindow, err := r.bits(1)
+	if err != nil {
+		return videoInfo{}, err
+	}
+	var left, right, top, bottom uint32
+	if conformanceWindow == 1 {
+		if err := r.ues(&left, &right, &top, &bottom); err != nil {
+			return videoInfo{}, err
+		}
+	}
+	var bitDepthLuma, bitDepthChroma uint32
+	if err := r.ues(&bitDepthLuma, &bitDepthChroma); err != nil {
+		return videoInfo{}, err
+	}
+
+	// 之后的字段只用于定位 VUI 中的帧率，解析失败不影响分辨率等参数
+	frameRate, _ := parseH265VUIFrameRate(r, maxSubLayersMinus1)
+
+	// 一致性窗口偏移以色度采样为单位，见 H.265 表 6-1
+	subWidthC, subHeightC := 1, 1
+	switch chromaFormatIdc {
+	case 1:
+		subWidthC, subHeightC = 2, 2
+	case 2:
+		subWidthC = 2
+	}
+
+	info := videoInfo{
+		width:     int(width) - subWidthC*int(left+right),
+		height:    int(height) - subHeightC*int(top+bottom),
+		profile:   h265ProfileName(profileIdc),
+		bitDepth:  int(bitDepthLuma) + 8,
+		frameRate: frameRate,
+	}
+	// general_level_idc 为级别的 30 倍，例如 93 表示 3.1、120 表示 4
+	info.level = formatLevel(levelIdc, 30)
+	if chromaFormatIdc < uint32(len(chromaFormatNames)) {
+		info.chromaFormat = chromaFormatNames[chromaFormatIdc]
+	}
+	return info, nil
+}
+
+// skipVUIHeader 跳过 VUI 开头的宽高比、overscan、视频信号类型和色度位置信息（H.264 / H.265 相同）
+func skipVUIHeader(r *bitReader) error {
+	aspectRatio, err := r.bits(1)
+	if err != nil {
+		return err
+	}
+	if aspectRatio == 1 {
+		idc, err := r.bits(8)
+		if err != nil {
+			return err
+		}
+		if idc == 255 { // Extended_SAR
+			r.skip(32)
+		}
+	}
+	if overscan, _ := r.bits(1); overscan == 1 {
+		r.skip(1)
+	}
+	if signalType, _ := r.bits(1); signalType == 1 {
+		r.skip(4) // video_format + video_full_range_flag
+		if colour, _ := r.bits(1); colour == 1 {
+			r.skip(24)
+		}
+	}
+	if chromaLoc, _ := r.bits(1); chromaLoc == 1 {
+		var top, bottom uint32
+		return r.ues(&top, &bottom)
+	}
+	return nil
+}
+
+// parseH264VUIFrameRate 从 H.264 VUI 的 timing_info 计算帧率，见 H.264 E.1.1 和公式 C-1：
+// 一帧包含两个场，帧率为 time_scale / (2 * num_units_in_tick)
+func parseH264VUIFrameRate(r *bitReader) (float64, error) {
+	if err := skipVUIHeader(r); err != nil {
+		return 0, err
+	}
+	timing, err := r.bits(1)
+	if err != nil || timing == 0 {
+		return 0, err
+	}
+	numUnitsInTick, _ := r.bits(32)
+	timeScale, err := r.bits(32)
+	if err != nil || numUnitsInTick == 0 {
+		return 0, err
+	}
+	return float64(timeScale) / float64(2*uint64(numUnitsInTick)), nil
+}
+
+// parseH265VUIFrameRate 从 bit_depth_chroma 之后继续解析 H.265 SPS，跳到 VUI 并从 vui_timing_info
+// 计算帧率（time_scale / num_units_in_tick），见 H.265 7.3.2.2 和 E.2.1
+func parseH265VUIFrameRate(r *bitReader, maxSubLayersMinus1 uint32) (float64, error) {
+	var log2MaxPOCLsbMinus4 uint32
+	if err := r.ues(&log2MaxPOCLsbMinus4); err != nil {
+		return 0, err
+	}
+	orderingInfo, err := r.bits(1)
+	if err != nil {
+		return 0, err
+	}
+	first := maxSubLayersMinus1
+	if orderingInfo == 1 {
+		first = 0
+	}
+	for i := first; i <= maxSubLayersMinus1; i++ {
+		var decBuffering, numReorder, latency uint32
+		if err := r.ues(&decBuffering, &numReorder, &latency); err != nil {
+			return 0, err
+		}
+	}
+	// 编码块 / 变换块尺寸和变换层级，共 6 个 ue(v)
+	var blockSizes [6]uint32
+	if err := r.ues(&blockSizes[0], &blockSizes[1], &blockSizes[2], &blockSizes[3], &blockSizes[4], &blockSizes[5]); err != nil {
+		return 0, err
+	}
+
+	if scalingList, _ := r.bits(1); scalingList == 1 {
+		if present, _ := r.bits(1); present == 1 {
+			if err := skipH265ScalingListData(r); err != nil {
+				return 0, err
+			}
+		}
+	}
+	r.skip(2) // amp_enabled_flag + sample_adaptive_offset_enabled_flag
+	pcm, err := r.bits(1)
+	if err != nil {
+		return 0, err
+	}
+	if pcm == 1 {
+		r.skip(8) // pcm_sample_bit_depth_luma/chroma_minus1
+		var minSize, diffSize uint32
+		if err := r.ues(&minSize, &diffSize); err != nil {
+			return 0, err
+		}
+		r.skip(1) // pcm_loop_filter_disabled_flag
+	}
+
+	var numShortTermRPS uint32
+	if err := r.ues(&numShortTermRPS); err != nil {
+		return 0, err
+	}
+	if numShortTermRPS > 64 {
+		return 0, fmt.Errorf("无效的 num_short_term_ref_pic_sets: %d", numShortTermRPS)
+	}
+	numDeltaPocs := make([]uint32, numShortTermRPS)
+	for i := range numDeltaPocs {
+		if numDeltaPocs[i], err = skipH265ShortTermRPS(r, i, numDeltaPocs); err != nil {
+			return 0, err
+		}
+	}
+
+	longTerm, err := r.bits(1)
+	if err != nil {
+		return 0, err
+	}
+	if longTerm == 1 {
+		var numLongTerm uint32
+		if err := r.ues(&numLongTerm); err != nil {
+			return 0, err
+		}
+		for i := uint32(0); i < numLongTerm; i++ {
+			// lt_ref_pic_poc_lsb_sps + used_by_curr_pic_lt_sps_flag
+			if err := r.skip(int(log2MaxPOCLsbMinus4) + 4 + 1); err != nil {
+				return 0, err
+			}
+		}
+	}
+	r.skip(2) // sps_temporal_mvp_enabled_flag + strong_intra_smoothing_enabled_flag
+
+	vui, err := r.bits(1)
+	if err != nil || vui == 0 {
+		return 0, err
+	}
+	if err := skipVUIHeader(r); err != nil {
+		return 0, err
+	}
+	r.skip(3) // neutral_chroma_indication_flag + field_seq_flag + frame_field_info_present_flag
+	if window, _ := r.bits(1); window == 1 {
+		var left, right, top, bottom uint32
+		if err := r.ues(&left, &right, &top, &bottom); err != nil {
+			return 0, err
+		}
+	}
+	timing, err := r.bits(1)
+	if err != nil || timing == 0 {
+		return 0, err
+	}
+	numUnitsInTick, _ := r.bits(32)
+	timeScale, err := r.bits(32)
+	if err != nil || numUnitsInTick == 0 {
+		return 0, err
+	}
+	return float64(timeScale) / float64(numUnitsInTick), nil
+}
+
+// skipH265ScalingListData 跳过 scaling_list_data()，见 H.265 7.3.4
+func skipH265ScalingListData(r *bitReader) error {
+	for sizeID := 0; sizeID < 4; sizeID++ {
+		step := 1
+		if sizeID == 3 {
+			step = 3
+		}
+		for matrixID := 0; matrixID < 6; matrixID += step {
+			predMode, err := r.bits(1)
+			if err != nil {
+				return err
+			}
+			if predMode == 0 {
+				var delta uint32
+				if err := r.ues(&delta); err != nil {
+					return err
+				}
+				continue
+			}
+			coefNum := min(64, 1<<(4+sizeID<<1))
+			if sizeID > 1 {
+				coefNum++ // scaling_list_dc_coef_minus8
+			}
+			for i := 0; i < coefNum; i++ {
+				if _, err := r.se(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// skipH265ShortTermRPS 跳过 SPS 中的第 idx 个 st_ref_pic_set()，返回它的 NumDeltaPocs，见 H.265 7.3.7
+func skipH265ShortTermRPS(r *bitReader, idx int, numDeltaPocs []uint32) (uint32, error) {
+	if idx > 0 {
+		interPrediction, err := r.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		if interPrediction == 1 {
+			r.skip(1) // delta_rps_sign
+			var absDeltaRPS uint32
+			if err := r.ues(&absDeltaRPS); err != nil {
+				return 0, err
+			}
+			// 参考前一个 RPS，每个 delta POC 以及当前图像各有一组标志
+			var count uint32
+			for j := uint32(0); j <= numDeltaPocs[idx-1]; j++ {
+				used, err := r.bits(1)
+				if err != nil {
+					return 0, err
+				}
+				useDelta := uint32(1)
+				if used == 0 {
+					useDelta, _ = r.bits(1)
+				}
+				if used == 1 || useDelta == 1 {
+					count++
+				}
+			}
+			return count, nil
+		}
+	}
+
+	var negative, positive uint32
+	if err := r.ues(&negative, &positive); err != nil {
+		return 0, err
+	}
+	if negative > 16 || positive > 16 {
+		return 0, fmt.Errorf("无效的 st_ref_pic_set")
+	}
+	for i := uint32(0); i < negative+positive; i++ {
+		var deltaPOC uint32
+		if err := r.ues(&deltaPOC); err != nil {
+			return 0, err
+		}
+		if err := r.skip(1); err != nil { // used_by_curr_pic_flag
+			return 0, err
+		}
+	}
+	return negative + positive, nil
+}
@@ -0,0 +1,155 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+)
+
+// 测试用的 SPS（含 NAL 头）
+var (
+	testSPS1080p = mustHex("67640028acd940780227e5c04400000300040000030028c3c60c6580")
+	testSPS720p  = mustHex("6764001facd9405005bb011000000300100000030320f1831960")
+	testSPSMain  = mustHex("674d401feca02802dd80880000030008000003019478c18cb0")
+
+	testHEVCSPS1080p = mustHex("420101016000000300900000030000030078a003c0801107cb965654a4c2e01000003e8000061a8080")
+	testHEVCSPS480p  = mustHex("42010101600000030090000003000003005aa006c201e1cde595952930b80400000fa0000186a020")
+	testHEVCSPS422   = mustHex("4201010408000003009d0800000300005db00280802d16595952930b80400000fa0000186a02")
+)
+
+func mustHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestParseVideoInfo(t *testing.T) {
+	annexB := func(nalus ...[]byte) []byte {
+		var out []byte
+		for _, nalu := range nalus {
+			out = append(append(out, 0, 0, 0, 1), nalu...)
+		}
+		return out
+	}
+	lengthPrefixed := func(nalus ...[]byte) []byte {
+		var out []byte
+		for _, nalu := range nalus {
+			out = binary.BigEndian.AppendUint32(out, uint32(len(nalu)))
+			out = append(out, nalu...)
+		}
+		return out
+	}
+	avcC := func(sps []byte) []byte {
+		out := []byte{1, sps[1], sps[2], sps[3], 0xff, 0xe1}
+		out = binary.BigEndian.AppendUint16(out, uint16(len(sps)))
+		out = append(out, sps...)
+		return append(out, 1, 0, 4, 0x68, 0xce, 0x38, 0x80)
+	}
+	hvcC := func(sps []byte) []byte {
+		out := append(make([]byte, 22), 1, 33)
+		out = binary.BigEndian.AppendUint16(out, 1)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(sps)))
+		return append(out, sps...)
+	}
+	aud := []byte{0x09, 0xf0}
+	idr := []byte{0x65, 0x88, 0x84}
+
+	tests := []struct {
+		name   string
+		codec  string
+		data   []byte
+		config bool
+		want   videoInfo
+		ok     bool
+	}{
+		{
+			// num_units_in_tick=4，time_scale=40
+			name: "H.264 1080p High Annex-B", codec: "H264", data: annexB(aud, testSPS1080p, idr),
+			want: videoInfo{1920, 1080, "High", "4", "4:2:0", 8, 5}, ok: true,
+		},
+		{
+			name: "H.264 720p High 长度前缀", codec: "H264", data: lengthPrefixed(testSPS720p, idr),
+			want: videoInfo{1280, 720, "High", "3.1", "4:2:0", 8, 25}, ok: true,
+		},
+		{
+			name: "H.264 Main avcC", codec: "H264", data: avcC(testSPSMain), config: true,
+			want: videoInfo{1280, 720, "Main", "3.1", "4:2:0", 8, 25}, ok: true,
+		},
+		{
+			name: "H.265 1080p Main Annex-B", codec: "H265", data: annexB([]byte{0x40, 0x01, 0x0c}, testHEVCSPS1080p),
+			want: videoInfo{1920, 1080, "Main", "4", "4:2:0", 8, 25}, ok: true,
+		},
+		{
+			name: "H.265 480p hvcC", codec: "H265", data: hvcC(testHEVCSPS480p), config: true,
+			want: videoInfo{854, 480, "Main", "3", "4:2:0", 8, 25}, ok: true,
+		},
+		{
+			name: "H.265 4:2:2 RExt", codec: "H265", data: annexB(testHEVCSPS422),
+			want: videoInfo{1280, 720, "Range Extensions", "3.1", "4:2:2", 8, 25}, ok: true,
+		},
+		{name: "没有 SPS", codec: "H264", data: annexB(aud, idr)},
+		{name: "SPS 不完整", codec: "H264", data: annexB(testSPS720p[:6])},
+		{name: "编码不匹配", codec: "H265", data: annexB(testSPS720p)},
+		{name: "不支持的编码", codec: "AV1", data: annexB(testSPS720p)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseVideoInfo(tt.codec, tt.data, tt.config)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseVideoInfo() = %+v, %v, want %+v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestSplitNALUs(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want [][]byte
+	}{
+		{"4 字节起始码", []byte{0, 0, 0, 1, 0x67, 0x64, 0, 0, 0, 1, 0x68}, [][]byte{{0x67, 0x64}, {0x68}}},
+		{"3 字节起始码", []byte{0, 0, 1, 0x67, 0, 0, 1, 0x65, 0x88}, [][]byte{{0x67}, {0x65, 0x88}}},
+		{"长度前缀", []byte{0, 0, 0, 2, 0x67, 0x64, 0, 0, 0, 1, 0x68}, [][]byte{{0x67, 0x64}, {0x68}}},
+		{"长度超出数据", []byte{0, 0, 0, 2, 0x67, 0x64, 0, 0, 0, 9, 0x68}, [][]byte{{0x67, 0x64}}},
+		{"空", nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitNALUs(tt.data)
+			if len(got) != len(tt.want) {
+				t.Fatalf("splitNALUs() = %x, want %x", got, tt.want)
+			}
+			for i := range got {
+				if !bytes.Equal(got[i], tt.want[i]) {
+					t.Errorf("splitNALUs()[%d] = %x, want %x", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestBitReader(t *testing.T) {
+	// 00 00 03 中的 03 为防竞争字节，读取时跳过
+	r := newRBSPReader([]byte{0x00, 0x00, 0x03, 0x01, 0xa6})
+	if v, err := r.bits(24); err != nil || v != 1 {
+		t.Fatalf("bits(24) = %d, %v, want 1", v, err)
+	}
+
+	// 1 -> 0，010 -> 1，011 -> 2，00111 -> se(-3)
+	r = newRBSPReader([]byte{0b1010_0110, 0b0111_0000})
+	for _, want := range []uint32{0, 1, 2} {
+		if v, err := r.ue(); err != nil || v != want {
+			t.Fatalf("ue() = %d, %v, want %d", v, err, want)
+		}
+	}
+	if v, err := r.se(); err != nil || v != -3 {
+		t.Fatalf("se() = %d, %v, want -3", v, err)
+	}
+	if _, err := r.bits(8); err != errSPSTruncated {
+		t.Errorf("越界读取 err = %v, want errSPSTruncated", err)
+	}
+}
@@ -0,0 +1,937 @@
+package stream
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	urlpkg "net/url"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/nareix/joy5/av"
+
+	"video-exporter/internal/config"
+)
+
+// SRT 协议常量（参考 draft-sharabayko-srt，仅实现 caller 模式接收端所需部分）
+const (
+	srtHeaderSize       = 16
+	srtHandshakeCIFSize = 48
+
+	srtCtrlHandshake = 0x0000
+	srtCtrlKeepalive = 0x0001
+	srtCtrlACK       = 0x0002
+	srtCtrlNAK       = 0x0003
+	srtCtrlShutdown  = 0x0005
+	srtCtrlACKACK    = 0x0006
+	srtCtrlDropReq   = 0x0007
+
+	srtHSInduction  = 0x00000001
+	srtHSConclusion = 0xFFFFFFFF
+	srtHSRejectBase = 1000 // 握手类型 >= 1000 表示被拒绝，减去 1000 为拒绝原因码
+
+	srtMagicCode     = 0x4A17
+	srtHSExtHSReq    = 0x1
+	srtHSExtKMReq    = 0x2
+	srtHSExtConfig   = 0x4
+	srtCmdHSReq      = 1
+	srtCmdHSRsp      = 2
+	srtCmdKMReq      = 3
+	srtCmdKMRsp      = 4
+	srtCmdSID        = 5
+	srtVersion       = 0x00010500 // 1.5.0
+	srtFlagTSBPDSnd  = 0x01
+	srtFlagTSBPDRcv  = 0x02
+	srtFlagCrypt     = 0x04
+	srtFlagTLPktDrop = 0x08
+	srtFlagPeriodNAK = 0x10
+	srtFlagRexmit    = 0x20
+
+	srtRetransmitFlag = 0x04000000 // 数据包第二个字中的 R 标志
+	srtMTU            = 1500
+	srtFlowWindow     = 8192
+	srtACKInterval    = 10 * time.Millisecond
+	srtMinNAKInterval = 20 * time.Millisecond
+	srtHSRetry        = 250 * time.Millisecond
+	srtDefaultLatency = 120
+	srtKMIterations   = 2048
+)
+
+// srtStats 一次 SRT 检查得到的链路指标
+type srtStats struct {
+	rtt           float64 // 平滑 RTT（毫秒），由 ACK/ACKACK 计算
+	retransmitted int64   // 收到的重传包数
+	dropped       int64   // 丢弃的包数（超过 TSBPD 播放时间仍未到达，或发送端 DROPREQ）
+	lost          int64   // 检测到丢失的包数（含之后被重传恢复的）
+	rcvBufferMs   float64 // 接收缓冲区平均水位（毫秒）
+	expected      int64   // 期望收到的包数（按序列号跨度累计）
+}
+
+// srtPacket 接收缓冲区中的数据包
+type srtPacket struct {
+	timestamp int64 // 展开后的发送端时间戳（微秒）
+	payload   []byte
+	dropped   bool // 发送端已声明丢弃，交付时直接跳过
+}
+
+// srtHandshake 握手包的控制信息字段
+type srtHandshake struct {
+	version    uint32
+	encryption uint16
+	extension  uint16
+	isn        uint32
+	mtu        uint32
+	flowWindow uint32
+	hsType     uint32
+	socketID   uint32
+	cookie     uint32
+	peerIP     [16]byte
+	extensions map[uint16][]byte // 扩展块类型 -> 内容
+}
+
+// srtReader 以 caller 模式拉取 SRT 流，按 TSBPD 交付 MPEG-TS 数据后解复用
+type srtReader struct {
+	conn     net.Conn
+	deadline time.Time
+	start    time.Time // 本端启动时间，控制包时间戳以此为基准
+	socketID uint32
+	peerID   uint32
+	isn      uint32
+	latency  time.Duration
+
+	block cipher.Block // 为空表示不加密
+	salt  []byte
+
+	// 接收状态
+	initialized bool
+	firstSeq    uint32
+	deliverSeq  uint32 // 下一个待交付的序列号
+	maxSeq      uint32 // 已收到的最大序列号
+	buffer      map[uint32]*srtPacket
+	lossList    map[uint32]struct{} // 已检测到丢失、尚未收到的序列号
+	tsbpdBase   time.Time
+	lastTS      int64
+	out         []byte // 已交付、等待解复用的 TS 数据
+	closed      bool
+
+	// ACK/NAK 状态
+	ackNo         uint32
+	acksSent      map[uint32]time.Time
+	nextACK       time.Time
+	nextNAK       time.Time
+	lastACK       time.Time
+	pktsSinceACK  int64
+	bytesSinceACK int64
+	rtt           time.Duration
+	rttVar        time.Duration
+	bufSamples    int64
+	bufSum        float64
+
+	rbuf         []byte
+	ts           *tsDemuxer
+	responseTime int64 // 拨号开始到握手完成的耗时（毫秒）
+	st           srtStats
+}
+
+// openSRT 以 caller 模式完成 SRT v5 握手（induction + conclusion），之后开始接收数据
+func openSRT(ctx context.Context, rawURL string, opts config.SRTConfig) (*srtReader, error) {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("无效的 SRT 地址: %w", err)
+	}
+	if u.Port() == "" {
+		return nil, fmt.Errorf("SRT 地址缺少端口: %s", rawURL)
+	}
+
+	streamID := opts.StreamID
+	if streamID == "" {
+		streamID = u.Query().Get("streamid")
+	}
+	latency := opts.Latency
+	if latency <= 0 {
+		latency = srtDefaultLatency
+	}
+	keyLen := opts.PBKeyLen
+	if keyLen == 0 {
+		keyLen = 16
+	}
+	if keyLen != 16 && keyLen != 24 && keyLen != 32 {
+		return nil, fmt.Errorf("无效的 SRT pbkeylen: %d", keyLen)
+	}
+	if n := len(opts.Passphrase); n > 0 && (n < 10 || n > 79) {
+		return nil, fmt.Errorf("SRT passphrase 长度必须为 10-79 个字符")
+	}
+
+	dialStart := time.Now()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "udp", u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("连接失败: %w", err)
+	}
+
+	var ids [8]byte
+	rand.Read(ids[:])
+	r := &srtReader{
+		conn:     conn,
+		start:    time.Now(),
+		socketID: binary.BigEndian.Uint32(ids[:4])&0x3FFFFFFF | 1,
+		isn:      binary.BigEndian.Uint32(ids[4:]) & 0x7FFFFFFF,
+		latency:  time.Duration(latency) * time.Millisecond,
+		buffer:   make(map[uint32]*srtPacket),
+		lossList: make(map[uint32]struct{}),
+		acksSent: make(map[uint32]time.Time),
+		rbuf:     make([]byte, srtMTU),
+	}
+	r.deadline, _ = ctx.Deadline()
+
+	if err := r.handshake(streamID, opts.Passphrase, keyLen); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r.responseTime = time.Since(dialStart).Milliseconds()
+	r.ts = newTSDemuxer(r)
+
+	return r, nil
+}
+
+// handshake 执行 HSv5 握手：induction 获取 cookie，conclusion 携带 HSREQ/KMREQ/SID
+func (r *srtReader) handshake(streamID, passphrase string, keyLen int) error {
+	induction := &srtHandshake{
+		version:    4,
+		extension:  2, // UDT_DGRAM
+		isn:        r.isn,
+		mtu:        srtMTU,
+		flowWindow: srtFlowWindow,
+		hsType:     srtHSInduction,
+		socketID:   r.socketID,
+	}
+	r.fillPeerIP(induction)
+
+	resp, err := r.exchangeHandshake(induction)
+	if err != nil {
+		return fmt.Errorf("SRT 握手失败: %w", err)
+	}
+	if resp.version != 5 || resp.extension != srtMagicCode {
+		return fmt.Errorf("对端不支持 SRT v5 握手（版本 %d）", resp.version)
+	}
+
+	latencyMs := uint32(r.latency / time.Millisecond)
+	hsreq := make([]byte, 12)
+	binary.BigEndian.PutUint32(hsreq[0:], srtVersion)
+	flags := uint32(srtFlagTSBPDSnd | srtFlagTSBPDRcv | srtFlagTLPktDrop | srtFlagPeriodNAK | srtFlagRexmit)
+	if passphrase != "" {
+		flags |= srtFlagCrypt
+	}
+	binary.BigEndian.PutUint32(hsreq[4:], flags)
+	binary.BigEndian.PutUint32(hsreq[8:], latencyMs<<16|latencyMs)
+
+	conclusion := &srtHandshake{
+		version:    5,
+		extension:  srtHSExtHSReq,
+		isn:        r.isn,
+		mtu:        srtMTU,
+		flowWindow: srtFlowWindow,
+		hsType:     srtHSConclusion,
+		socketID:   r.socketID,
+		cookie:     resp.cookie,
+		extensions: map[uint16][]byte{srtCmdHSReq: hsreq},
+	}
+	r.fillPeerIP(conclusion)
+
+	if passphrase != "" {
+		km, err := r.setupCrypto(passphrase, keyLen)
+		if err != nil {
+			return err
+		}
+		conclusion.extension |= srtHSExtKMReq
+		conclusion.encryption = uint16(keyLen / 8)
+		conclusion.extensions[srtCmdKMReq] = km
+	}
+	if streamID != "" {
+		conclusion.extension |= srtHSExtConfig
+		conclusion.extensions[srtCmdSID] = encodeSRTStreamID(streamID)
+	}
+
+	sent := time.Now()
+	if resp, err = r.exchangeHandshake(conclusion); err != nil {
+		return fmt.Errorf("SRT 握手失败: %w", err)
+	}
+	if resp.hsType >= srtHSRejectBase && resp.hsType != srtHSConclusion {
+		return fmt.Errorf("SRT 握手被拒绝，原因码: %d", resp.hsType-srtHSRejectBase)
+	}
+	if resp.hsType != srtHSConclusion {
+		return fmt.Errorf("SRT 握手响应类型异常: %#x", resp.hsType)
+	}
+
+	// 握手往返作为 RTT 初值，之后由 ACK/ACKACK 平滑更新
+	r.rtt = time.Since(sent)
+	r.rttVar = r.rtt / 2
+	r.peerID = resp.socketID
+
+	// 接收延迟取双方协商的较大值（HSRSP 低 16 位为对端发送延迟）
+	if rsp, ok := resp.extensions[srtCmdHSRsp]; ok && len(rsp) >= 12 {
+		if peer := time.Duration(binary.BigEndian.Uint32(rsp[8:])&0xFFFF) * time.Millisecond; peer > r.latency {
+			r.latency = peer
+		}
+	}
+	if passphrase != "" {
+		rsp, ok := resp.extensions[srtCmdKMRsp]
+		if !ok {
+			return fmt.Errorf("对端未返回 KMRSP，不支持加密")
+		}
+		if len(rsp) == 4 {
+			switch binary.BigEndian.Uint32(rsp) {
+			case 3:
+				return fmt.Errorf("对端未设置 passphrase")
+			case 4:
+				return fmt.Errorf("SRT passphrase 错误")
+			}
+		}
+	}
+
+	return nil
+}
+
+// exchangeHandshake 发送握手包并等待对端的握手响应，超时按固定间隔重发
+func (r *srtReader) exchangeHandshake(hs *srtHandshake) (*srtHandshake, error) {
+	for {
+		if err := r.sendControl(srtCtrlHandshake, 0, hs.marshal()); err != nil {
+			return nil, err
+		}
+		wait := time.Now().Add(srtHSRetry)
+		if !r.deadline.IsZero() && r.deadline.Before(wait) {
+			wait = r.deadline
+		}
+		r.conn.SetReadDeadline(wait)
+
+		for {
+			n, err := r.conn.Read(r.rbuf)
+			if err != nil {
+				if errors.Is(err, os.ErrDeadlineExceeded) && (r.deadline.IsZero() || time.Now().Before(r.deadline)) {
+					break
+				}
+				return nil, err
+			}
+			b := r.rbuf[:n]
+			if n < srtHeaderSize+srtHandshakeCIFSize || b[0]&0x80 == 0 ||
+				binary.BigEndian.Uint16(b[0:])&0x7FFF != srtCtrlHandshake {
+				continue
+			}
+			resp, err := parseSRTHandshake(b[srtHeaderSize:])
+			if err != nil || (hs.hsType == srtHSConclusion && resp.hsType == srtHSInduction) {
+				continue // 重发 induction 导致的重复响应
+			}
+			return resp, nil
+		}
+	}
+}
+
+// fillPeerIP 按 libsrt 的约定写入对端 IPv4 地址（每个 32 位字按小端存放）
+func (r *srtReader) fillPeerIP(hs *srtHandshake) {
+	addr, ok := r.conn.RemoteAddr().(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	if ip4 := addr.IP.To4(); ip4 != nil {
+		hs.peerIP[0], hs.peerIP[1], hs.peerIP[2], hs.peerIP[3] = ip4[3], ip4[2], ip4[1], ip4[0]
+		return
+	}
+	ip := addr.IP.To16()
+	for i := 0; i < 16; i += 4 {
+		hs.peerIP[i], hs.peerIP[i+1], hs.peerIP[i+2], hs.peerIP[i+3] = ip[i+3], ip[i+2], ip[i+1], ip[i]
+	}
+}
+
+// setupCrypto 生成 SEK 和 salt，用 PBKDF2 派生的 KEK 包装后构造 KMREQ
+// HSv5 中由 caller 生成的密钥同时用于两个方向
+func (r *srtReader) setupCrypto(passphrase string, keyLen int) ([]byte, error) {
+	salt := make([]byte, 16)
+	sek := make([]byte, keyLen)
+	rand.Read(salt)
+	rand.Read(sek)
+
+	kek, err := pbkdf2.Key(sha1.New, passphrase, salt[8:], srtKMIterations, keyLen)
+	if err != nil {
+		return nil, fmt.Errorf("派生 SRT 密钥失败: %w", err)
+	}
+	wrapped, err := aesKeyWrap(kek, sek)
+	if err != nil {
+		return nil, fmt.Errorf("包装 SRT 密钥失败: %w", err)
+	}
+	if r.block, err = aes.NewCipher(sek); err != nil {
+		return nil, fmt.Errorf("创建 SRT 解密器失败: %w", err)
+	}
+	r.salt = salt
+
+	km := make([]byte, 16, 16+len(salt)+len(wrapped))
+	km[0] = 0x12 // V=1, PT=2（KMmsg）
+	km[1], km[2] = 0x20, 0x29
+	km[3] = 0x01 // 偶数密钥
+	km[8] = 2    // AES-CTR
+	km[10] = 2   // SE: MPEG-TS/SRT
+	km[14] = byte(len(salt) / 4)
+	km[15] = byte(keyLen / 4)
+	km = append(km, salt...)
+	km = append(km, wrapped...)
+	return km, nil
+}
+
+// decrypt 按 SRT 的 AES-CTR 规则原地解密负载，IV 由 salt 与包序列号组成
+func (r *srtReader) decrypt(seq uint32, payload []byte) {
+	var iv [aes.BlockSize]byte
+	copy(iv[:14], r.salt[:14])
+	var pki [4]byte
+	binary.BigEndian.PutUint32(pki[:], seq)
+	for i := range pki {
+		iv[10+i] ^= pki[i]
+	}
+	cipher.NewCTR(r.block, iv[:]).XORKeyStream(payload, payload)
+}
+
+// ReadPacket 读取下一个音视频包
+func (r *srtReader) ReadPacket() (av.Packet, error) {
+	return r.ts.ReadPacket()
+}
+
+// Read 返回按 TSBPD 交付的 TS 数据，没有可交付数据时驱动网络收包和定时器
+func (r *srtReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.closed {
+			return 0, io.EOF
+		}
+		if err := r.poll(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// poll 执行到期的定时任务，然后最多等待到下一次 ACK 收取一个 UDP 包
+func (r *srtReader) poll() error {
+	now := time.Now()
+	if !r.deadline.IsZero() && !now.Before(r.deadline) {
+		return os.ErrDeadlineExceeded
+	}
+	if err := r.onTimer(now); err != nil {
+		return err
+	}
+	if len(r.out) > 0 {
+		return nil
+	}
+
+	wait := r.nextACK
+	if wait.Before(now) {
+		wait = now.Add(srtACKInterval)
+	}
+	if !r.deadline.IsZero() && r.deadline.Before(wait) {
+		wait = r.deadline
+	}
+	r.conn.SetReadDeadline(wait)
+	n, err := r.conn.Read(r.rbuf)
+	if err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			return nil
+		}
+		return err
+	}
+	return r.handlePacket(r.rbuf[:n], time.Now())
+}
+
+// onTimer 处理 TSBPD 交付、周期 ACK 和周期 NAK
+func (r *srtReader) onTimer(now time.Time) error {
+	if !r.initialized {
+		return nil
+	}
+	r.deliver(now)
+
+	if !now.Before(r.nextACK) {
+		r.sampleBuffer()
+		if err := r.sendACK(now); err != nil {
+			return err
+		}
+		r.nextACK = now.Add(srtACKInterval)
+	}
+	if !now.Before(r.nextNAK) {
+		if len(r.lossList) > 0 {
+			if err := r.sendNAK(r.lossRanges()); err != nil {
+				return err
+			}
+		}
+		interval := r.rtt + 4*r.rttVar
+		if interval < srtMinNAKInterval {
+			interval = srtMinNAKInterval
+		}
+		r.nextNAK = now.Add(interval)
+	}
+	return nil
+}
+
+// handlePacket 分发收到的数据包或控制包
+func (r *srtReader) handlePacket(b []byte, now time.Time) error {
+	if len(b) < srtHeaderSize || binary.BigEndian.Uint32(b[12:]) != r.socketID {
+		return nil
+	}
+	if b[0]&0x80 == 0 {
+		r.handleData(b, now)
+		return nil
+	}
+
+	switch binary.BigEndian.Uint16(b[0:]) & 0x7FFF {
+	case srtCtrlKeepalive:
+		return r.sendControl(srtCtrlKeepalive, 0, nil)
+	case srtCtrlACKACK:
+		r.handleACKACK(binary.BigEndian.Uint32(b[4:]), now)
+	case srtCtrlDropReq:
+		if len(b) >= srtHeaderSize+8 {
+			r.handleDropReq(binary.BigEndian.Uint32(b[16:])&0x7FFFFFFF, binary.BigEndian.Uint32(b[20:])&0x7FFFFFFF)
+		}
+	case srtCtrlShutdown:
+		r.closed = true
+	}
+	return nil
+}
+
+// handleData 处理数据包：解密、丢包检测（立即 NAK）并放入接收缓冲区
+func (r *srtReader) handleData(b []byte, now time.Time) {
+	seq := binary.BigEndian.Uint32(b[0:]) & 0x7FFFFFFF
+	flags := binary.BigEndian.Uint32(b[4:])
+	ts := binary.BigEndian.Uint32(b[8:])
+
+	if !r.initialized || srtSeqDiff(seq, r.maxSeq) > srtFlowWindow {
+		r.resync(seq, ts, now)
+	}
+	if srtSeqDiff(seq, r.deliverSeq) < 0 {
+		return // 已交付或已丢弃的迟到包
+	}
+	if _, dup := r.buffer[seq]; dup {
+		return
+	}
+	if flags&srtRetransmitFlag != 0 {
+		r.st.retransmitted++
+	}
+
+	payload := append([]byte(nil), b[srtHeaderSize:]...)
+	if (flags>>27)&0x3 != 0 && r.block != nil {
+		r.decrypt(seq, payload)
+	}
+
+	if d := srtSeqDiff(seq, r.maxSeq); d > 0 {
+		if d > 1 {
+			first, last := srtSeqAdd(r.maxSeq, 1), srtSeqAdd(seq, -1)
+			for s := first; s != seq; s = srtSeqAdd(s, 1) {
+				r.lossList[s] = struct{}{}
+			}
+			r.st.lost += int64(d - 1)
+			r.sendNAK([][2]uint32{{first, last}})
+		}
+		r.maxSeq = seq
+	}
+	delete(r.lossList, seq)
+
+	r.buffer[seq] = &srtPacket{timestamp: r.extendTimestamp(ts), payload: payload}
+	r.pktsSinceACK++
+	r.bytesSinceACK += int64(len(payload))
+}
+
+// resync 以当前包为起点初始化接收状态；序列号跳变超过流量窗口（如发送端重启）时重新同步
+func (r *srtReader) resync(seq, ts uint32, now time.Time) {
+	if r.initialized {
+		r.st.expected += int64(srtSeqDiff(r.maxSeq, r.firstSeq)) + 1
+		clear(r.buffer)
+		clear(r.lossList)
+	}
+	r.initialized = true
+	r.firstSeq = seq
+	r.deliverSeq = seq
+	r.maxSeq = srtSeqAdd(seq, -1)
+	r.lastTS = int64(ts)
+	r.tsbpdBase = now.Add(-time.Duration(ts) * time.Microsecond)
+	r.lastACK = now
+	r.nextACK = now.Add(srtACKInterval)
+	r.nextNAK = now.Add(srtMinNAKInterval)
+}
+
+// extendTimestamp 把 32 位微秒时间戳展开为 64 位，处理约 71 分钟一次的回绕
+func (r *srtReader) extendTimestamp(ts uint32) int64 {
+	ext := r.lastTS + int64(int32(ts-uint32(r.lastTS)))
+	if ext > r.lastTS {
+		r.lastTS = ext
+	}
+	return ext
+}
+
+// playTime 返回数据包的 TSBPD 播放时间
+func (r *srtReader) playTime(pkt *srtPacket) time.Time {
+	return r.tsbpdBase.Add(time.Duration(pkt.timestamp)*time.Microsecond + r.latency)
+}
+
+// deliver 按序交付到达播放时间的包；缺失的包在后续包到达播放时间后放弃（TLPKTDROP）
+func (r *srtReader) deliver(now time.Time) {
+	for len(r.buffer) > 0 {
+		if pkt, ok := r.buffer[r.deliverSeq]; ok {
+			if !pkt.dropped {
+				if now.Before(r.playTime(pkt)) {
+					return
+				}
+				r.out = append(r.out, pkt.payload...)
+			}
+			delete(r.buffer, r.deliverSeq)
+			r.deliverSeq = srtSeqAdd(r.deliverSeq, 1)
+			continue
+		}
+
+		next, pkt := r.nextBuffered()
+		if pkt == nil || (!pkt.dropped && now.Before(r.playTime(pkt))) {
+			return
+		}
+		for s := r.deliverSeq; s != next; s = srtSeqAdd(s, 1) {
+			delete(r.lossList, s)
+			r.st.dropped++
+		}
+		r.deliverSeq = next
+	}
+}
+
+// nextBuffered 返回 deliverSeq 之后第一个已在缓冲区中的包
+func (r *srtReader) nextBuffered() (uint32, *srtPacket) {
+	for s := r.deliverSeq; srtSeqDiff(s, r.maxSeq) <= 0; s = srtSeqAdd(s, 1) {
+		if pkt, ok := r.buffer[s]; ok {
+			return s, pkt
+		}
+	}
+	return 0, nil
+}
+
+// handleDropReq 处理发送端的 DROPREQ：对应区间内尚未收到的包不再等待
+func (r *srtReader) handleDropReq(first, last uint32) {
+	if !r.initialized {
+		return
+	}
+	// 只处理 [deliverSeq, maxSeq] 内的部分，对端可能发来跨越很大范围的区间
+	if srtSeqDiff(first, r.deliverSeq) < 0 {
+		first = r.deliverSeq
+	}
+	if srtSeqDiff(last, r.maxSeq) > 0 {
+		last = r.maxSeq
+	}
+	for s := first; srtSeqDiff(s, last) <= 0; s = srtSeqAdd(s, 1) {
+		if _, ok := r.buffer[s]; ok {
+			continue
+		}
+		delete(r.lossList, s)
+		r.buffer[s] = &srtPacket{dropped: true}
+		r.st.dropped++
+	}
+}
+
+// sampleBuffer 采样接收缓冲区水位（缓冲区内包的时间跨度）
+func (r *srtReader) sampleBuffer() {
+	var minTS, maxTS int64
+	first := true
+	for _, pkt := range r.buffer {
+		if pkt.dropped {
+			continue
+		}
+		if first || pkt.timestamp < minTS {
+			minTS = pkt.timestamp
+		}
+		if first || pkt.timestamp > maxTS {
+			maxTS = pkt.timestamp
+		}
+		first = false
+	}
+	r.bufSum += float64(maxTS-minTS) / 1000
+	r.bufSamples++
+}
+
+// sendACK 发送完整 ACK，确认到第一个未收到的序列号
+func (r *srtReader) sendACK(now time.Time) error {
+	ackSeq := r.deliverSeq
+	for srtSeqDiff(ackSeq, r.maxSeq) <= 0 {
+		if _, ok := r.buffer[ackSeq]; !ok {
+			break
+		}
+		ackSeq = srtSeqAdd(ackSeq, 1)
+	}
+
+	var pktRate, byteRate uint32
+	if elapsed := now.Sub(r.lastACK).Seconds(); elapsed > 0 {
+		pktRate = uint32(float64(r.pktsSinceACK) / elapsed)
+		byteRate = uint32(float64(r.bytesSinceACK) / elapsed)
+	}
+	avail := srtFlowWindow - len(r.buffer)
+	if avail < 2 {
+		avail = 2
+	}
+
+	cif := make([]byte, 28)
+	binary.BigEndian.PutUint32(cif[0:], ackSeq)
+	binary.BigEndian.PutUint32(cif[4:], uint32(r.rtt.Microseconds()))
+	binary.BigEndian.PutUint32(cif[8:], uint32(r.rttVar.Microseconds()))
+	binary.BigEndian.PutUint32(cif[12:], uint32(avail))
+	binary.BigEndian.PutUint32(cif[16:], pktRate)
+	binary.BigEndian.PutUint32(cif[20:], pktRate)
+	binary.BigEndian.PutUint32(cif[24:], byteRate)
+
+	r.ackNo++
+	r.acksSent[r.ackNo] = now
+	r.lastACK = now
+	r.pktsSinceACK = 0
+	r.bytesSinceACK = 0
+	return r.sendControl(srtCtrlACK, r.ackNo, cif)
+}
+
+// handleACKACK 用 ACK 发出到 ACKACK 到达的时间更新 RTT（RFC 6298 式平滑）
+func (r *srtReader) handleACKACK(ackNo uint32, now time.Time) {
+	sent, ok := r.acksSent[ackNo]
+	if !ok {
+		return
+	}
+	for no := range r.acksSent {
+		if no <= ackNo {
+			delete(r.acksSent, no)
+		}
+	}
+
+	sample := now.Sub(sent)
+	diff := r.rtt - sample
+	if diff < 0 {
+		diff = -diff
+	}
+	r.rttVar = (3*r.rttVar + diff) / 4
+	r.rtt = (7*r.rtt + sample) / 8
+}
+
+// sendNAK 发送丢包报告，单个序列号直接编码，区间首个序列号最高位置 1
+func (r *srtReader) sendNAK(ranges [][2]uint32) error {
+	cif := make([]byte, 0, len(ranges)*8)
+	for _, rg := range ranges {
+		if rg[0] == rg[1] {
+			cif = binary.BigEndian.AppendUint32(cif, rg[0])
+		} else {
+			cif = binary.BigEndian.AppendUint32(cif, rg[0]|0x80000000)
+			cif = binary.BigEndian.AppendUint32(cif, rg[1])
+		}
+		if len(cif) >= srtMTU-srtHeaderSize-28 {
+			break
+		}
+	}
+	return r.sendControl(srtCtrlNAK, 0, cif)
+}
+
+// lossRanges 把丢包列表按序合并为连续区间
+func (r *srtReader) lossRanges() [][2]uint32 {
+	seqs := make([]uint32, 0, len(r.lossList))
+	for s := range r.lossList {
+		seqs = append(seqs, s)
+	}
+	sort.Slice(seqs, func(i, j int) bool { return srtSeqDiff(seqs[i], seqs[j]) < 0 })
+
+	var ranges [][2]uint32
+	for _, s := range seqs {
+		if n := len(ranges); n > 0 && srtSeqAdd(ranges[n-1][1], 1) == s {
+			ranges[n-1][1] = s
+			continue
+		}
+		ranges = append(ranges, [2]uint32{s, s})
+	}
+	return ranges
+}
+
+// sendControl 发送控制包
+func (r *srtReader) sendControl(ctrlType uint16, typeInfo uint32, cif []byte) error {
+	b := make([]byte, srtHeaderSize+len(cif))
+	binary.BigEndian.PutUint32(b[0:], 0x80000000|uint32(ctrlType)<<16)
+	binary.BigEndian.PutUint32(b[4:], typeInfo)
+	binary.BigEndian.PutUint32(b[8:], uint32(time.Since(r.start).Microseconds()))
+	binary.BigEndian.PutUint32(b[12:], r.peerID)
+	copy(b[srtHeaderSize:], cif)
+	_, err := r.conn.Write(b)
+	return err
+}
+
+// stats 汇总本次检查的 SRT 链路指标
+func (r *srtReader) stats() srtStats {
+	st := r.st
+	st.rtt = float64(r.rtt.Microseconds()) / 1000
+	if r.bufSamples > 0 {
+		st.rcvBufferMs = r.bufSum / float64(r.bufSamples)
+	}
+	if r.initialized {
+		st.expected += int64(srtSeqDiff(r.maxSeq, r.firstSeq)) + 1
+	}
+	return st
+}
+
+// Close 发送 SHUTDOWN 并关闭连接
+func (r *srtReader) Close() error {
+	if !r.closed {
+		r.conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+		r.sendControl(srtCtrlShutdown, 0, make([]byte, 4))
+	}
+	return r.conn.Close()
+}
+
+// marshal 编码握手控制信息和扩展块
+func (h *srtHandshake) marshal() []byte {
+	b := make([]byte, srtHandshakeCIFSize)
+	binary.BigEndian.PutUint32(b[0:], h.version)
+	binary.BigEndian.PutUint16(b[4:], h.encryption)
+	binary.BigEndian.PutUint16(b[6:], h.extension)
+	binary.BigEndian.PutUint32(b[8:], h.isn)
+	binary.BigEndian.PutUint32(b[12:], h.mtu)
+	binary.BigEndian.PutUint32(b[16:], h.flowWindow)
+	binary.BigEndian.PutUint32(b[20:], h.hsType)
+	binary.BigEndian.PutUint32(b[24:], h.socketID)
+	binary.BigEndian.PutUint32(b[28:], h.cookie)
+	copy(b[32:], h.peerIP[:])
+
+	// 扩展块按固定顺序输出：HSREQ、KMREQ、SID
+	for _, typ := range []uint16{srtCmdHSReq, srtCmdKMReq, srtCmdSID} {
+		data, ok := h.extensions[typ]
+		if !ok {
+			continue
+		}
+		b = binary.BigEndian.AppendUint16(b, typ)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(data)/4))
+		b = append(b, data...)
+	}
+	return b
+}
+
+// parseSRTHandshake 解析握手控制信息和扩展块
+func parseSRTHandshake(b []byte) (*srtHandshake, error) {
+	if len(b) < srtHandshakeCIFSize {
+		return nil, fmt.Errorf("握手包过短")
+	}
+	h := &srtHandshake{
+		version:    binary.BigEndian.Uint32(b[0:]),
+		encryption: binary.BigEndian.Uint16(b[4:]),
+		extension:  binary.BigEndian.Uint16(b[6:]),
+		isn:        binary.BigEndian.Uint32(b[8:]),
+		mtu:        binary.BigEndian.Uint32(b[12:]),
+		flowWindow: binary.BigEndian.Uint32(b[16:]),
+		hsType:     binary.BigEndian.Uint32(b[20:]),
+		socketID:   binary.BigEndian.Uint32(b[24:]),
+		cookie:     binary.BigEndian.Uint32(b[28:]),
+		extensions: make(map[uint16][]byte),
+	}
+	copy(h.peerIP[:], b[32:48])
+
+	for rest := b[srtHandshakeCIFSize:]; len(rest) >= 4; {
+		typ := binary.BigEndian.Uint16(rest[0:])
+		size := int(binary.BigEndian.Uint16(rest[2:])) * 4
+		if 4+size > len(rest) {
+			break
+		}
+		h.extensions[typ] = rest[4 : 4+size]
+		rest = rest[4+size:]
+	}
+	return h, nil
+}
+
+// encodeSRTStreamID 编码 SID 扩展：补零到 4 字节对齐，每个 32 位字按小端存放（与 libsrt 一致）
+func encodeSRTStreamID(streamID string) []byte {
+	b := make([]byte, (len(streamID)+3)/4*4)
+	copy(b, streamID)
+	for i := 0; i < len(b); i += 4 {
+		b[i], b[i+1], b[i+2], b[i+3] = b[i+3], b[i+2], b[i+1], b[i]
+	}
+	return b
+}
+
+// aesKeyWrap 按 RFC 3394 用 KEK 包装密钥
+func aesKeyWrap(kek, key []byte) ([]byte, error) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	n := len(key) / 8
+	out := make([]byte, 8+len(key))
+	copy(out, []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6})
+	copy(out[8:], key)
+
+	var buf [16]byte
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(buf[:8], out[:8])
+			copy(buf[8:], out[8*i:8*i+8])
+			block.Encrypt(buf[:], buf[:])
+			binary.BigEndian.PutUint64(out[:8], binary.BigEndian.Uint64(buf[:8])^uint64(n*j+i))
+			copy(out[8*i:], buf[8:])
+		}
+	}
+	return out, nil
+}
+
+// srtSeqDiff 计算 31 位序列号 a-b 的有符号差值
+func srtSeqDiff(a, b uint32) int32 {
+	return int32((a-b)<<1) >> 1
+}
+
+// srtSeqAdd 31 位序列号加法
+func srtSeqAdd(seq uint32, n int32) uint32 {
+	return (seq + uint32(n)) & 0x7FFFFFFF
+}
+
+// isSRTURL 根据 scheme 判断是否为 SRT 地址
+func isSRTURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "srt"
+}
+
+// srtProber SRT 探测器，opts 为流配置中的 SRT 参数
+type srtProber struct {
+	opts config.SRTConfig
+}
+
+// Open 完成 SRT 握手并开始接收
+func (p srtProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openSRT(ctx, opts.URL, p.opts)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r:            &avPacketReader{r: r, videoCodec: r.ts.codec},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			// RTT 和丢包率来自 SRT 链路层统计
+			st := r.stats()
+			rep.stats = st
+			rep.RTT = int64(math.Round(st.rtt))
+			if st.expected > 0 {
+				rep.PacketLossRatio = math.Min(float64(st.lost)/float64(st.expected), 1.0)
+			}
+			opts.Log.Debug("SRT 检查完成",
+				"RTT毫秒", fmt.Sprintf("%.2f", st.rtt),
+				"丢失包", st.lost,
+				"重传包", st.retransmitted,
+				"丢弃包", st.dropped,
+				"接收缓冲ms", fmt.Sprintf("%.1f", st.rcvBufferMs))
+		},
+	}, nil
+}
+
+// fill 写入 SRT 指标
+func (s srtStats) fill(m *Metrics) {
+	m.SRTRTT = s.rtt
+	m.SRTRetransmittedPackets = s.retransmitted
+	m.SRTDroppedPackets = s.dropped
+	m.SRTReceiveBuffer = s.rcvBufferMs
+}
@@ -0,0 +1,510 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/av"
+
+	"video-exporter/internal/config"
+)
+
+// srtTestPayloadSize 每个数据包携带 7 个 TS 包
+const srtTestPayloadSize = 7 * tsPacketSize
+
+// fakeSRTServer 本地 SRT listener：完成 HSv5 握手后推送一段 TS 数据
+type fakeSRTServer struct {
+	t          *testing.T
+	pc         *net.UDPConn
+	passphrase string
+	data       []byte
+	rexmit     map[int]bool // 首次不发送、收到 NAK 后重传的包下标
+	dropReq    map[int]bool // 不发送、只发 DROPREQ 的包下标
+
+	mu     sync.Mutex
+	start  time.Time
+	peer   *net.UDPAddr
+	caller uint32
+	isn    uint32
+	block  cipher.Block
+	salt   []byte
+	sent   map[uint32]uint32 // 序列号 -> 发送时间戳
+	naks   int
+}
+
+// newFakeSRTServer 在本地 UDP 端口启动 listener，测试结束时关闭
+func newFakeSRTServer(t *testing.T, passphrase string, data []byte) *fakeSRTServer {
+	pc, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+	return &fakeSRTServer{
+		t:          t,
+		pc:         pc,
+		passphrase: passphrase,
+		data:       data,
+		rexmit:     map[int]bool{},
+		dropReq:    map[int]bool{},
+		start:      time.Now(),
+		sent:       map[uint32]uint32{},
+	}
+}
+
+func (s *fakeSRTServer) url() string {
+	return "srt://" + s.pc.LocalAddr().String() + "?streamid=live/abc"
+}
+
+// serve 处理握手，握手成功后推流并响应 ACK / NAK
+func (s *fakeSRTServer) serve() {
+	if !s.handshake() {
+		return
+	}
+	go s.handleControl()
+
+	var packets [][]byte
+	for off := 0; off < len(s.data); off += srtTestPayloadSize {
+		packets = append(packets, s.data[off:min(off+srtTestPayloadSize, len(s.data))])
+	}
+	for i, payload := range packets {
+		seq := srtSeqAdd(s.isn, int32(i))
+		ts := uint32(time.Since(s.start).Microseconds())
+		s.mu.Lock()
+		s.sent[seq] = ts
+		s.mu.Unlock()
+		if !s.rexmit[i] && !s.dropReq[i] {
+			s.sendData(seq, ts, payload, false)
+		}
+		if s.dropReq[i-1] {
+			// 接收端已检测到上一个包丢失，发送端声明放弃
+			prev := srtSeqAdd(seq, -1)
+			cif := make([]byte, 8)
+			binary.BigEndian.PutUint32(cif[0:], prev)
+			binary.BigEndian.PutUint32(cif[4:], prev)
+			s.control(srtCtrlDropReq, 0, cif)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// 等待接收端按 TSBPD 交付完后关闭
+	time.Sleep(300 * time.Millisecond)
+	s.control(srtCtrlShutdown, 0, make([]byte, 4))
+}
+
+// handshake 响应 induction 和 conclusion，返回是否握手成功
+func (s *fakeSRTServer) handshake() bool {
+	buf := make([]byte, srtMTU)
+	for {
+		n, addr, err := s.pc.ReadFromUDP(buf)
+		if err != nil {
+			return false
+		}
+		hs, err := parseSRTHandshake(buf[srtHeaderSize:n])
+		if err != nil {
+			s.t.Errorf("握手包解析失败: %v", err)
+			return false
+		}
+		s.mu.Lock()
+		s.peer, s.caller = addr, hs.socketID
+		s.mu.Unlock()
+
+		if hs.hsType == srtHSInduction {
+			rsp := &srtHandshake{version: 5, extension: srtMagicCode, isn: hs.isn, mtu: srtMTU,
+				flowWindow: srtFlowWindow, hsType: srtHSInduction, socketID: 777, cookie: 0xabcd}
+			s.control(srtCtrlHandshake, 0, rsp.marshal())
+			continue
+		}
+		if hs.cookie != 0xabcd {
+			s.t.Errorf("cookie = %#x, want 0xabcd", hs.cookie)
+		}
+		if sid := encodeSRTStreamID(string(hs.extensions[srtCmdSID])); !bytes.Equal(bytes.TrimRight(sid, "\x00"), []byte("live/abc")) {
+			s.t.Errorf("streamid = %q", sid)
+		}
+		s.isn = hs.isn
+
+		rsp := &srtHandshake{version: 5, isn: hs.isn, mtu: srtMTU, flowWindow: srtFlowWindow,
+			hsType: srtHSConclusion, socketID: 777}
+		hsrsp := make([]byte, 12)
+		binary.BigEndian.PutUint32(hsrsp[0:], srtVersion)
+		binary.BigEndian.PutUint32(hsrsp[8:], 200<<16|200)
+		cif := appendSRTExt(rsp.marshal(), srtCmdHSRsp, hsrsp)
+
+		ok := true
+		if km, exists := hs.extensions[srtCmdKMReq]; exists {
+			kmrsp := km
+			if !s.setupCrypto(km) {
+				kmrsp = []byte{0, 0, 0, 4} // BADSECRET
+				ok = false
+			}
+			cif = appendSRTExt(cif, srtCmdKMRsp, kmrsp)
+		}
+		s.control(srtCtrlHandshake, 0, cif)
+		return ok
+	}
+}
+
+// setupCrypto 用 passphrase 解包 KMREQ 中的 SEK，校验失败返回 false
+func (s *fakeSRTServer) setupCrypto(km []byte) bool {
+	keyLen := int(km[15]) * 4
+	salt := km[16:32]
+	kek, err := pbkdf2.Key(sha1.New, s.passphrase, salt[8:], srtKMIterations, keyLen)
+	if err != nil {
+		s.t.Fatal(err)
+	}
+	sek, ok := aesKeyUnwrap(kek, km[32:])
+	if !ok {
+		return false
+	}
+	s.block, _ = aes.NewCipher(sek)
+	s.salt = salt
+	return true
+}
+
+// handleControl 响应接收端的 ACK（立即回 ACKACK）和 NAK（重传）
+func (s *fakeSRTServer) handleControl() {
+	buf := make([]byte, srtMTU)
+	for {
+		n, _, err := s.pc.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		if n < srtHeaderSize || buf[0]&0x80 == 0 {
+			continue
+		}
+		switch binary.BigEndian.Uint16(buf) & 0x7FFF {
+		case srtCtrlACK:
+			s.control(srtCtrlACKACK, binary.BigEndian.Uint32(buf[4:]), nil)
+		case srtCtrlNAK:
+			s.mu.Lock()
+			s.naks++
+			s.mu.Unlock()
+			cif := buf[srtHeaderSize:n]
+			for i := 0; i+4 <= len(cif); i += 4 {
+				first := binary.BigEndian.Uint32(cif[i:])
+				last := first
+				if first&0x80000000 != 0 && i+8 <= len(cif) {
+					first &= 0x7FFFFFFF
+					i += 4
+					last = binary.BigEndian.Uint32(cif[i:])
+				}
+				for seq := first; srtSeqDiff(seq, last) <= 0; seq = srtSeqAdd(seq, 1) {
+					idx := int(srtSeqDiff(seq, s.isn))
+					if !s.rexmit[idx] {
+						continue
+					}
+					s.mu.Lock()
+					ts := s.sent[seq]
+					s.mu.Unlock()
+					off := idx * srtTestPayloadSize
+					s.sendData(seq, ts, s.data[off:min(off+srtTestPayloadSize, len(s.data))], true)
+				}
+			}
+		}
+	}
+}
+
+// sendData 发送数据包，设置了 passphrase 时用偶数密钥加密
+func (s *fakeSRTServer) sendData(seq, ts uint32, payload []byte, rexmit bool) {
+	b := make([]byte, srtHeaderSize+len(payload))
+	flags := uint32(0xC0000000) // 单独成帧的消息
+	if rexmit {
+		flags |= srtRetransmitFlag
+	}
+	copy(b[srtHeaderSize:], payload)
+	if s.block != nil {
+		flags |= 1 << 27
+		var iv [aes.BlockSize]byte
+		copy(iv[:14], s.salt[:14])
+		var pki [4]byte
+		binary.BigEndian.PutUint32(pki[:], seq)
+		for i := range pki {
+			iv[10+i] ^= pki[i]
+		}
+		cipher.NewCTR(s.block, iv[:]).XORKeyStream(b[srtHeaderSize:], b[srtHeaderSize:])
+	}
+	binary.BigEndian.PutUint32(b[0:], seq)
+	binary.BigEndian.PutUint32(b[4:], flags)
+	binary.BigEndian.PutUint32(b[8:], ts)
+	s.mu.Lock()
+	binary.BigEndian.PutUint32(b[12:], s.caller)
+	peer := s.peer
+	s.mu.Unlock()
+	s.pc.WriteToUDP(b, peer)
+}
+
+// control 发送控制包
+func (s *fakeSRTServer) control(ctrlType uint16, typeInfo uint32, cif []byte) {
+	b := make([]byte, srtHeaderSize+len(cif))
+	binary.BigEndian.PutUint32(b[0:], 0x80000000|uint32(ctrlType)<<16)
+	binary.BigEndian.PutUint32(b[4:], typeInfo)
+	binary.BigEndian.PutUint32(b[8:], uint32(time.Since(s.start).Microseconds()))
+	s.mu.Lock()
+	binary.BigEndian.PutUint32(b[12:], s.caller)
+	peer := s.peer
+	s.mu.Unlock()
+	copy(b[srtHeaderSize:], cif)
+	s.pc.WriteToUDP(b, peer)
+}
+
+// appendSRTExt 追加一个握手扩展块
+func appendSRTExt(b []byte, typ uint16, data []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, typ)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(data)/4))
+	return append(b, data...)
+}
+
+// aesKeyUnwrap 按 RFC 3394 解包密钥，完整性校验失败时 ok 为 false
+func aesKeyUnwrap(kek, wrapped []byte) ([]byte, bool) {
+	block, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, false
+	}
+	n := len(wrapped)/8 - 1
+	a := append([]byte(nil), wrapped[:8]...)
+	key := append([]byte(nil), wrapped[8:]...)
+
+	var buf [16]byte
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			binary.BigEndian.PutUint64(buf[:8], binary.BigEndian.Uint64(a)^uint64(n*j+i))
+			copy(buf[8:], key[8*(i-1):8*i])
+			block.Decrypt(buf[:], buf[:])
+			copy(a, buf[:8])
+			copy(key[8*(i-1):], buf[8:])
+		}
+	}
+	return key, bytes.Equal(a, []byte{0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6, 0xA6})
+}
+
+func TestSRTReader(t *testing.T) {
+	tests := []struct {
+		name       string
+		serverPass string
+		clientPass string
+		wantErr    bool
+	}{
+		{"不加密", "", "", false},
+		{"加密", "0123456789abc", "0123456789abc", false},
+		{"passphrase 错误", "0123456789abc", "wrong-passphrase", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newFakeSRTServer(t, tt.serverPass, genTSSegment(0, 50))
+			srv.rexmit[5], srv.rexmit[40] = true, true
+			srv.dropReq[20] = true
+			go srv.serve()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			r, err := openSRT(ctx, srv.url(), config.SRTConfig{Passphrase: tt.clientPass, Latency: 50})
+			if tt.wantErr {
+				if err == nil {
+					r.Close()
+					t.Fatal("want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+
+			// 对端 HSRSP 中的延迟更大，接收延迟取协商后的较大值
+			if r.latency != 200*time.Millisecond {
+				t.Errorf("latency = %v, want 200ms", r.latency)
+			}
+
+			var video int
+			var lastDTS time.Duration
+			for _, pkt := range readAllPackets(t, r.ts) {
+				if pkt.Type != av.H264 {
+					continue
+				}
+				if video > 0 && pkt.Time <= lastDTS {
+					t.Errorf("DTS 回退: %v -> %v", lastDTS, pkt.Time)
+				}
+				lastDTS = pkt.Time
+				video++
+			}
+			// DROPREQ 丢弃的包最多破坏一帧
+			if video < 49 {
+				t.Errorf("video = %d, want >= 49", video)
+			}
+
+			st := r.stats()
+			wantExpected := int64((len(srv.data) + srtTestPayloadSize - 1) / srtTestPayloadSize)
+			if st.lost != 3 || st.retransmitted != 2 || st.dropped != 1 || st.expected != wantExpected {
+				t.Errorf("lost=%d retransmitted=%d dropped=%d expected=%d, want 3 2 1 %d",
+					st.lost, st.retransmitted, st.dropped, st.expected, wantExpected)
+			}
+			if st.rtt <= 0 || st.rcvBufferMs <= 0 {
+				t.Errorf("rtt=%v rcvBuffer=%v, want > 0", st.rtt, st.rcvBufferMs)
+			}
+			srv.mu.Lock()
+			naks := srv.naks
+			srv.mu.Unlock()
+			if naks == 0 {
+				t.Error("没有收到 NAK")
+			}
+		})
+	}
+}
+
+// newTestSRTReader 返回已用 seq=100 初始化、收到 100-105 中 ok 指定包的接收端
+func newTestSRTReader(now time.Time, ok ...uint32) *srtReader {
+	r := &srtReader{
+		latency:  100 * time.Millisecond,
+		buffer:   make(map[uint32]*srtPacket),
+		lossList: make(map[uint32]struct{}),
+	}
+	r.resync(100, 0, now)
+	r.maxSeq = 105
+	for s := uint32(100); s <= 105; s++ {
+		r.lossList[s] = struct{}{}
+	}
+	for _, s := range ok {
+		delete(r.lossList, s)
+		r.buffer[s] = &srtPacket{timestamp: int64(s-100) * 1000, payload: []byte{byte(s)}}
+	}
+	return r
+}
+
+func TestSRTHandleDropReq(t *testing.T) {
+	now := time.Now()
+	r := newTestSRTReader(now, 100, 102, 105)
+
+	// 101、103、104 未收到；102 已收到不计入；106 超出已收到的范围不计入
+	r.handleDropReq(101, 106)
+	if r.st.dropped != 3 || len(r.lossList) != 0 {
+		t.Fatalf("dropped=%d lossList=%v, want 3 []", r.st.dropped, r.lossList)
+	}
+
+	// 被丢弃的包不等待播放时间，直接跳过
+	r.deliver(now.Add(time.Second))
+	if !bytes.Equal(r.out, []byte{100, 102, 105}) || r.deliverSeq != 106 || r.st.dropped != 3 {
+		t.Errorf("out=%v deliverSeq=%d dropped=%d", r.out, r.deliverSeq, r.st.dropped)
+	}
+
+	tests := []struct {
+		name        string
+		first, last uint32
+		dropped     int64
+	}{
+		{"区间在已交付之前", 10, 99, 0},
+		{"区间在已收到之后", 106, 200, 0},
+		{"区间起点早于 deliverSeq", 50, 101, 1},
+		// 对端发来的超大区间只处理缓冲区范围内的部分，不能逐个遍历
+		{"超大区间", 101, srtSeqAdd(100, 1<<30-1), 3},
+		{"跨越序列号回绕的超大区间", srtSeqAdd(100, -(1 << 30)), srtSeqAdd(100, 1<<30-1), 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestSRTReader(now, 100, 102, 105)
+			done := make(chan struct{})
+			go func() {
+				r.handleDropReq(tt.first, tt.last)
+				close(done)
+			}()
+			select {
+			case <-done:
+			case <-time.After(time.Second):
+				t.Fatal("handleDropReq 超时")
+			}
+			if r.st.dropped != tt.dropped {
+				t.Errorf("dropped = %d, want %d", r.st.dropped, tt.dropped)
+			}
+		})
+	}
+}
+
+func TestSRTDeliver(t *testing.T) {
+	now := time.Now()
+	r := newTestSRTReader(now, 100, 101, 104)
+
+	// 未到播放时间不交付
+	r.deliver(now.Add(50 * time.Millisecond))
+	if len(r.out) != 0 {
+		t.Fatalf("提前交付: %v", r.out)
+	}
+
+	// 100、101 到达播放时间；104 未到播放时间，102、103 继续等待重传
+	r.deliver(now.Add(102 * time.Millisecond))
+	if !bytes.Equal(r.out, []byte{100, 101}) || r.deliverSeq != 102 || r.st.dropped != 0 {
+		t.Fatalf("out=%v deliverSeq=%d dropped=%d", r.out, r.deliverSeq, r.st.dropped)
+	}
+
+	// 104 到达播放时间后放弃 102、103（TLPKTDROP）
+	r.deliver(now.Add(105 * time.Millisecond))
+	if !bytes.Equal(r.out, []byte{100, 101, 104}) || r.deliverSeq != 105 || r.st.dropped != 2 {
+		t.Errorf("out=%v deliverSeq=%d dropped=%d", r.out, r.deliverSeq, r.st.dropped)
+	}
+	if _, ok := r.lossList[105]; !ok || len(r.lossList) != 1 {
+		t.Errorf("lossList = %v, want [105]", r.lossList)
+	}
+}
+
+func TestSRTLossRanges(t *testing.T) {
+	tests := []struct {
+		name string
+		loss []uint32
+		want [][2]uint32
+	}{
+		{"空", nil, nil},
+		{"单个", []uint32{5}, [][2]uint32{{5, 5}}},
+		{"合并连续", []uint32{7, 5, 6, 9, 11, 10}, [][2]uint32{{5, 7}, {9, 11}}},
+		{"序列号回绕", []uint32{0x7FFFFFFE, 0x7FFFFFFF, 0, 2}, [][2]uint32{{0x7FFFFFFE, 0}, {2, 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &srtReader{lossList: make(map[uint32]struct{})}
+			for _, s := range tt.loss {
+				r.lossList[s] = struct{}{}
+			}
+			got := r.lossRanges()
+			if len(got) != len(tt.want) {
+				t.Fatalf("lossRanges() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("lossRanges() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestAESKeyWrap(t *testing.T) {
+	// RFC 3394 4.1 测试向量
+	kek, _ := hex.DecodeString("000102030405060708090A0B0C0D0E0F")
+	key, _ := hex.DecodeString("00112233445566778899AABBCCDDEEFF")
+	want, _ := hex.DecodeString("1FA68B0A8112B447AEF34BD8FB5A7B829D3E862371D2CFE5")
+
+	got, err := aesKeyWrap(kek, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("aesKeyWrap() = %x, want %x", got, want)
+	}
+	if unwrapped, ok := aesKeyUnwrap(kek, got); !ok || !bytes.Equal(unwrapped, key) {
+		t.Errorf("aesKeyUnwrap() = %x %v", unwrapped, ok)
+	}
+}
+
+func TestEncodeSRTStreamID(t *testing.T) {
+	// 每 4 字节按小端存放，不足 4 字节补零
+	want := []byte("evilcba/\x00\x00\x001")
+	if got := encodeSRTStreamID("live/abc1"); !bytes.Equal(got, want) {
+		t.Errorf("encodeSRTStreamID() = %q, want %q", got, want)
+	}
+}
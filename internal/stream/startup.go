@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// startupTrace 通过 httptrace 记录一次检查中 DNS 解析、TCP 连接、TLS 握手和首字节的耗时，
+// 只对 HTTP 类协议（HTTP-FLV / HTTP-TS / HLS / DASH / WHEP）生效。
+// 分片类协议会发起多个请求，每个阶段只记录第一次，复用连接池中的连接时不会触发 DNS、连接和握手。
+// 同时记录第一个请求的跳转链、最终节点（见 edgeTransport）和 TLS 证书信息
+type startupTrace struct {
+	mu    sync.Mutex
+	start time.Time // 开始建立连接的时间，首字节耗时从此计算
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+
+	dns       time.Duration
+	connect   time.Duration
+	tls       time.Duration
+	firstByte time.Duration
+
+	remoteAddr string // 最近一次取得的连接的远端地址
+	connHost   string // 最近一次请求连接的主机名，握手失败时用于匹配证书
+	edge       edgeInfo
+	edgeDone   bool
+	cert       tlsInfo
+	hasCert    bool
+}
+
+// withContext 返回挂载了 ClientTrace 的 context，使用该 context 发出的 HTTP 请求都会被记录
+func (t *startupTrace) withContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, traceKey{}, t)
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.edgeDone {
+				t.connHost, _, _ = net.SplitHostPort(hostPort)
+			}
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			defer t.mu.Unlock()
+			if !t.edgeDone {
+				t.remoteAddr = info.Conn.RemoteAddr().String()
+			}
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.begin(&t.dnsStart)
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			if info.Err == nil {
+				t.end(&t.dnsStart, &t.dns)
+			}
+		},
+		ConnectStart: func(_, _ string) {
+			t.begin(&t.connectStart)
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err == nil {
+				t.end(&t.connectStart, &t.connect)
+			}
+		},
+		TLSHandshakeStart: func() {
+			t.begin(&t.tlsStart)
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				t.end(&t.tlsStart, &t.tls)
+				return
+			}
+			// 证书校验失败（例如已过期）时请求不会返回响应，从错误中取出未校验的证书链
+			var certErr *tls.CertificateVerificationError
+			if errors.As(err, &certErr) {
+				t.mu.Lock()
+				defer t.mu.Unlock()
+				if !t.edgeDone && !t.hasCert {
+					t.cert, t.hasCert = newTLSInfo(t.connHost, certErr.UnverifiedCertificates)
+				}
+			}
+		},
+		GotFirstResponseByte: func() {
+			t.end(&t.start, &t.firstByte)
+		},
+	})
+}
+
+// begin 记录阶段开始时间，已记录过时忽略
+func (t *startupTrace) begin(at *time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if at.IsZero() {
+		*at = time.Now()
+	}
+}
+
+// end 记录阶段耗时，阶段未开始或已记录过时忽略。
+// 开始时间在持锁后读取：Happy Eyeballs 会在多个 goroutine 中并行拨号，begin 可能同时写入
+func (t *startupTrace) end(start *time.Time, d *time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !start.IsZero() && *d == 0 {
+		*d = max(time.Since(*start), time.Microsecond)
+	}
+}
+
+// snapshot 返回各阶段耗时（毫秒），httptrace 的回调可能在传输层的 goroutine 中执行
+func (t *startupTrace) snapshot() (dns, connect, tls, firstByte float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms := func(d time.Duration) float64 { return float64(d) / float64(time.Millisecond) }
+	return ms(t.dns), ms(t.connect), ms(t.tls), ms(t.firstByte)
+}
+
+// sinceStart 返回 at 相对 start 的毫秒数，at 为零值时返回 0
+func sinceStart(start, at time.Time) float64 {
+	if at.IsZero() {
+		return 0
+	}
+	return float64(at.Sub(start)) / float64(time.Millisecond)
+}
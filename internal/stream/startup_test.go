@@ -0,0 +1,119 @@
+package stream
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTraceTestClient 与 globalHTTPClient 结构相同的客户端，信任测试服务端的证书
+func newTraceTestClient(srv *httptest.Server) *http.Client {
+	base := &http.Transport{}
+	if srv.TLS != nil {
+		base = srv.Client().Transport.(*http.Transport).Clone()
+	}
+	return &http.Client{Transport: &edgeTransport{base: base}}
+}
+
+// traceGet 使用 trace 发起 GET 请求并读完响应体
+func traceGet(t *testing.T, client *http.Client, trace *startupTrace, rawURL string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(trace.withContext(t.Context()), "GET", rawURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return resp
+}
+
+func TestStartupTrace(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		io.WriteString(w, "ok")
+	})
+	tlsSrv := httptest.NewTLSServer(handler)
+	defer tlsSrv.Close()
+	plainSrv := httptest.NewServer(handler)
+	defer plainSrv.Close()
+
+	tests := []struct {
+		name    string
+		srv     *httptest.Server
+		url     string
+		wantDNS bool
+		wantTLS bool
+	}{
+		{name: "HTTPS 直连 IP", srv: tlsSrv, url: tlsSrv.URL, wantTLS: true},
+		{name: "HTTP 经过 DNS 解析", srv: plainSrv, url: strings.Replace(plainSrv.URL, "127.0.0.1", "localhost", 1), wantDNS: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTraceTestClient(tt.srv)
+			trace := &startupTrace{start: time.Now()}
+			traceGet(t, client, trace, tt.url+"/live/a.flv")
+
+			dns, connect, tlsMs, firstByte := trace.snapshot()
+			if (dns > 0) != tt.wantDNS || connect <= 0 || (tlsMs > 0) != tt.wantTLS {
+				t.Errorf("dns=%v connect=%v tls=%v, want dns %v tls %v", dns, connect, tlsMs, tt.wantDNS, tt.wantTLS)
+			}
+			if firstByte < 5 {
+				t.Errorf("firstByte = %vms，应包含服务端处理时间", firstByte)
+			}
+
+			// 复用连接的后续请求不改变已记录的耗时
+			traceGet(t, client, trace, tt.url+"/live/b.flv")
+			dns2, connect2, tls2, firstByte2 := trace.snapshot()
+			if dns2 != dns || connect2 != connect || tls2 != tlsMs || firstByte2 != firstByte {
+				t.Errorf("第二个请求改变了耗时: %v %v %v %v", dns2, connect2, tls2, firstByte2)
+			}
+		})
+	}
+}
+
+// TestStartupTraceParallelDial 模拟 Happy Eyeballs 并行拨号：一个 goroutine 开始连接时，
+// 其他 goroutine 同时回调 ConnectDone / DNSDone，配合 -race 运行
+func TestStartupTraceParallelDial(t *testing.T) {
+	trace := &startupTrace{start: time.Now()}
+	ct := httptrace.ContextClientTrace(trace.withContext(t.Context()))
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				ct.ConnectDone("tcp", "192.0.2.1:443", nil)
+				ct.DNSDone(httptrace.DNSDoneInfo{})
+			}
+		}()
+	}
+	ct.DNSStart(httptrace.DNSStartInfo{Host: "example.com"})
+	ct.ConnectStart("tcp", "192.0.2.1:443")
+	wg.Wait()
+	ct.ConnectDone("tcp", "192.0.2.1:443", nil)
+	ct.DNSDone(httptrace.DNSDoneInfo{})
+
+	if dns, connect, _, _ := trace.snapshot(); dns <= 0 || connect <= 0 {
+		t.Errorf("dns=%v connect=%v, want >0", dns, connect)
+	}
+}
+
+func TestStartupTraceEndWithoutBegin(t *testing.T) {
+	trace := &startupTrace{}
+	ct := httptrace.ContextClientTrace(trace.withContext(t.Context()))
+	ct.ConnectDone("tcp", "192.0.2.1:443", nil)
+	ct.GotFirstResponseByte()
+	if _, connect, _, firstByte := trace.snapshot(); connect != 0 || firstByte != 0 {
+		t.Errorf("阶段未开始时 connect=%v firstByte=%v, want 0", connect, firstByte)
+	}
+}
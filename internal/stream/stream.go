@@ -1,8 +1,8 @@
 package stream
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"log/slog"
 	"math"
 	"net/http"
@@ -13,9 +13,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/nareix/joy5/av"
-	"github.com/nareix/joy5/format/flv"
-
 	"video-exporter/internal/config"
 	"video-exporter/internal/logger"
 )
@@ -36,35 +33,110 @@ func initHTTPClient() {
 			IdleConnTimeout:     90 * time.Second, // 空闲连接超时
 			DisableKeepAlives:   false,            // 启用连接复用
 		}
+		// 外层记录每次检查第一个请求的跳转链和最终节点
 		globalHTTPClient = &http.Client{
-			Transport: transport,
+			Transport: &edgeTransport{base: transport},
 			Timeout:   0, // 不限制超时，由我们自己控制
 		}
 	})
 }
 
+// 流协议
+const (
+	ProtocolFLV  = "flv"
+	ProtocolHLS  = "hls"
+	ProtocolRTMP = "rtmp"
+	ProtocolRTSP = "rtsp"
+	ProtocolSRT  = "srt"
+	ProtocolWHEP = "whep"
+	ProtocolDASH = "dash"
+	ProtocolTS   = "ts" // HTTP-TS（MPEG-TS over HTTP）
+)
+
 // Checker 流检查器
 type Checker struct {
-	id      string
-	url     string
-	project string
-	name    string
+	id       string
+	url      string
+	project  string
+	name     string
+	protocol string
+
+	prober Prober // 协议探测器
+
+	avSyncThreshold int                  // 音画不同步阈值（毫秒），0 表示使用全局配置
+	request         config.RequestConfig // 流级别的 HTTP 请求选项
+
+	// 多边缘对比检查，未配置 edges 时均为空
+	target   string            // 实际检查的地址（其他 CDN 的地址），标签仍使用 url
+	edgeName string            // 指标 edge 标签
+	edgeIP   string            // 直接连接的边缘节点 IP
+	sign     config.SignConfig // 边缘级别的签名配置，优先于项目配置
 
 	// 统计数据（当前检查的值，不累积）
-	mu               sync.RWMutex
-	totalPackets     int64 // 本次检查的总包数
-	videoPackets     int64 // 本次检查的视频包数
-	audioPackets     int64 // 本次检查的音频包数
-	keyframes        int64 // 本次检查的关键帧数
-	currentBitrate   float64
-	avgBitrate       float64
-	bitrateHistory   []float64
-	framerate        float64
-	codec            string
-	response         int64
-	gopSize          int
-	width            int
-	height           int
+	mu                  sync.RWMutex
+	totalPackets        int64 // 本次检查的总包数
+	videoPackets        int64 // 本次检查的视频包数
+	audioPackets        int64 // 本次检查的音频包数
+	keyframes           int64 // 本次检查的关键帧数
+	currentBitrate      float64
+	avgBitrate          float64
+	bitrateHistory      []float64
+	framerate           float64
+	codec               string
+	response            int64
+	gopSize             int
+	keyframeIntervalMin float64 // 最短关键帧间隔（秒）
+	keyframeIntervalAvg float64 // 平均关键帧间隔（秒）
+	keyframeIntervalMax float64 // 最长关键帧间隔（秒）
+	gopCV               float64 // 关键帧间隔的变异系数
+	width               int
+	height              int
+	videoProfile        string             // 视频 profile（来自 SPS）
+	videoLevel          string             // 视频 level（来自 SPS）
+	chromaFormat        string             // 色度采样格式，例如 4:2:0
+	bitDepth            int                // 亮度位深
+	audioCodec          string             // 音频编码
+	audioSampleRate     int                // 音频采样率（Hz）
+	audioChannels       int                // 音频声道数
+	audioBitrate        float64            // 音频码率（bps）
+	avSyncDrift         float64            // 音画偏差（毫秒，音频时间戳 - 视频时间戳）
+	avSyncSlope         float64            // 音画偏差变化斜率（毫秒/分钟）
+	avSyncExceeded      bool               // 音画偏差是否超过阈值
+	tsAnomalies         timestampAnomalies // 时间戳异常计数
+	nominalFramerate    float64            // 标称帧率（onMetaData / SPS VUI / 帧间隔中位数）
+	droppedFrames       int64              // 按标称帧率估算的丢帧数
+	frameLossRatio      float64            // 丢帧率（0.0-1.0）
+	metadata            metadataInfo       // onMetaData 声明的编码参数
+	hasMetadata         bool               // 是否解析到 onMetaData
+	bitrateMismatch     bool               // 声明的视频码率与实测相差超过阈值
+	framerateMismatch   bool               // 声明的帧率与实测相差超过阈值
+	frozen              bool               // 画面是否冻结
+	frozenSeconds       float64            // 最长画面静止时长（秒）
+	realtimeRatio       float64            // 媒体时间推进量 / 系统时间
+	longestGap          int64              // 最长包到达间隔（毫秒）
+	rebuffers           int64              // 模拟播放器卡顿次数
+	stallSeconds        float64            // 模拟播放器卡顿总时长（秒）
+
+	// 起播耗时（毫秒）：DNS、连接、TLS 为各阶段耗时，其余从开始建立连接起算，未知时为 0
+	dnsTime             float64
+	connectTime         float64
+	tlsTime             float64
+	timeToFirstByte     float64
+	timeToFirstTag      float64
+	timeToFirstVideo    float64
+	timeToFirstKeyframe float64
+
+	// 第一个 HTTP 请求的跳转链和最终节点（非 HTTP 类协议为空）
+	edge edgeInfo
+
+	// 最近一次尝试的 TLS 连接和证书信息（包括失败的尝试），非 HTTPS 时 hasCert 为 false
+	cert    tlsInfo
+	hasCert bool
+
+	// 端到端延迟（毫秒）：到达时间 - 编码端嵌入的系统时间，没有嵌入时间时 hasGlassLatency 为 false
+	glassLatency    float64
+	hasGlassLatency bool
+
 	quality          string
 	playable         bool
 	bitrateStability string
@@ -78,6 +150,9 @@ type Checker struct {
 	networkJitter   int64   // 网络抖动（毫秒）
 	reconnectCount  int64   // 重连次数（本检查周期内的重连次数，每个周期重置）
 
+	// 协议相关指标（由探测器在 Session.Finish 中提供）
+	stats protocolStats
+
 	log *slog.Logger
 }
 
@@ -127,17 +202,23 @@ func extractStreamName(project, id, rawURL string) string {
 }
 
 // NewChecker 创建流检查器
-func NewChecker(id, url, project string) *Checker {
+func NewChecker(cfg config.StreamConfig, project string) *Checker {
+	protocol, prober := newProber(cfg)
 	return &Checker{
-		id:             id,
-		url:            url,
-		project:        project,
-		name:           extractStreamName(project, id, url),
-		healthy:        false,
-		playable:       false,
-		quality:        "unknown",
-		bitrateHistory: make([]float64, 0, 10),
-		log:            logger.Get(),
+		id:              cfg.ID,
+		url:             cfg.URL,
+		target:          cfg.URL,
+		project:         project,
+		name:            extractStreamName(project, cfg.ID, cfg.URL),
+		protocol:        protocol,
+		prober:          prober,
+		avSyncThreshold: cfg.AVSyncThreshold,
+		request:         cfg.Request,
+		healthy:         false,
+		playable:        false,
+		quality:         "unknown",
+		bitrateHistory:  make([]float64, 0, 10),
+		log:             logger.Get(),
 	}
 }
 
@@ -146,54 +227,37 @@ func (sc *Checker) ID() string {
 	return sc.id
 }
 
+// updateTLS 记录本次尝试的 TLS 证书信息，非 HTTPS 或未取得证书时清空
+func (sc *Checker) updateTLS(trace *startupTrace) {
+	cert, ok := trace.tlsSnapshot()
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.cert, sc.hasCert = cert, ok
+}
+
+// Edge 返回边缘名称，未配置 edges 时为空
+func (sc *Checker) Edge() string {
+	return sc.edgeName
+}
+
 // Check 执行一次流检查
 func (sc *Checker) Check(timeout time.Duration) error {
-	sc.log.Debug("开始检查流", "流ID", sc.id, "URL", sc.url)
+	sc.log.Debug("开始检查流", "流ID", sc.id, "URL", sc.target)
 
 	startTime := time.Now()
 
-	// 初始化全局HTTP客户端（如果还未初始化）
-	initHTTPClient()
-
-	// 记录请求开始时间，用于计算HTTP-FLV请求响应时间
-	reqStart := time.Now()
-	req, err := http.NewRequest("GET", sc.url, nil)
-	if err != nil {
-		return fmt.Errorf("创建请求失败: %w", err)
-	}
-
-	// 使用全局HTTP客户端，复用连接池
-	resp, err := globalHTTPClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("连接失败: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
-	}
-
-	// 将延迟定义为 FLV 的 HTTP 请求响应时间（ms）
-	// 优化：减少锁的使用，在最后统一更新
-	responseTime := time.Since(reqStart).Milliseconds()
-
-	// 创建解复用器
-	demuxer := flv.NewDemuxer(resp.Body)
-
-	// joy5 不需要预先获取流信息，直接读取包即可
-	hasVideo := false
-	hasMetadata := false
-
-	// 采样数据包 - 基于时间采样，更真实
-	packetCount := 0
-	videoCount := 0
-	audioCount := 0
-	keyframeCount := 0
-	totalBytes := int64(0)
-
 	// 从配置读取采样参数，如果未配置则使用默认值
 	sampleDurationSec := 10
 	minKeyframes := 2
+	rtspTransport := RTSPTransportTCP
+	avSyncThreshold := 200
+	jumpThreshold := 1000
+	mismatchThreshold := 30
+	frozenThreshold := 5
+	startupBuffer := 1000
+	var latency latencyProbe
+	var projectRequest config.RequestConfig
+	var projectSign config.SignConfig
 	if cfg := config.GetGlobal(); cfg != nil {
 		if cfg.Exporter.SampleDuration > 0 {
 			sampleDurationSec = cfg.Exporter.SampleDuration
@@ -201,138 +265,122 @@ func (sc *Checker) Check(timeout time.Duration) error {
 		if cfg.Exporter.MinKeyframes > 0 {
 			minKeyframes = cfg.Exporter.MinKeyframes
 		}
-	}
-	sampleDuration := time.Duration(sampleDurationSec) * time.Second
-	sampleStartTime := time.Now()
-
-	// 自动计算最大采样字节数限制
-	// 基于采样时长和常见码率范围（1-10Mbps）自动估算，留出2倍安全余量
-	// 公式: maxBytes = (maxBitrate * sampleDuration) / 8 * 2
-	// 假设最大码率为 10Mbps，转换为字节: 10Mbps * sampleDuration / 8 * 2 (安全系数)
-	maxBitrateBps := int64(10 * 1000 * 1000)                             // 10Mbps = 10,000,000 bps
-	maxSampleBytes := (maxBitrateBps * int64(sampleDurationSec)) / 8 * 2 // 2倍安全余量
-
-	// 用于延迟计算的变量
-	firstPacketTime := time.Time{} // 第一个视频包到达的系统时间（用于是否读到包的判定）
-	firstDTS := int64(0)           // 第一个视频包的DTS
-	lastDTS := int64(0)            // 最后一个视频包的DTS
-	keyframeInterval := 0
-
-	// 用于网络稳定性计算的变量
-	lastVideoTime := time.Time{}   // 上一个视频包到达时间
-	packetIntervals := []float64{} // 包间隔时间（用于计算抖动）
-	expectedPackets := int64(0)    // 期望的包数量
-	actualPackets := int64(0)      // 实际收到的包数量
-	lastVideoDTS := int64(0)       // 上一个视频包的DTS
-
-	for {
-		// 基于时间的采样，提前退出条件：达到采样时间且收集到足够关键帧
-		elapsed := time.Since(sampleStartTime)
-		if elapsed >= sampleDuration && keyframeCount >= minKeyframes {
-			break
+		if cfg.Exporter.RTSPTransport == RTSPTransportUDP {
+			rtspTransport = RTSPTransportUDP
 		}
-
-		// 如果已经超过采样时间，即使关键帧不够也退出（避免长时间阻塞）
-		if elapsed >= sampleDuration*2 {
-			break
+		if cfg.Exporter.AVSyncThreshold > 0 {
+			avSyncThreshold = cfg.Exporter.AVSyncThreshold
 		}
-
-		// 字节数限制：如果设置了最大采样字节数，达到限制后立即退出
-		if maxSampleBytes > 0 && totalBytes >= maxSampleBytes {
-			sc.log.Debug("达到最大采样字节数限制", "流ID", sc.id, "已采样字节", totalBytes, "限制", maxSampleBytes)
-			break
+		if cfg.Exporter.TimestampJumpThreshold > 0 {
+			jumpThreshold = cfg.Exporter.TimestampJumpThreshold
 		}
-
-		pktRecvTime := time.Now() // 记录包到达时间
-		pkt, err := demuxer.ReadPacket()
-		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			return fmt.Errorf("读取数据包失败: %w", err)
+		if cfg.Exporter.MetadataMismatchThreshold > 0 {
+			mismatchThreshold = cfg.Exporter.MetadataMismatchThreshold
 		}
-
-		packetCount++
-		totalBytes += int64(len(pkt.Data))
-
-		// 字节数限制检查（在累加后立即检查，避免超过限制）
-		if maxSampleBytes > 0 && totalBytes >= maxSampleBytes {
-			sc.log.Debug("达到最大采样字节数限制", "流ID", sc.id, "已采样字节", totalBytes, "限制", maxSampleBytes)
-			break
+		if cfg.Exporter.FrozenThreshold > 0 {
+			frozenThreshold = cfg.Exporter.FrozenThreshold
 		}
-
-		// 检查 metadata（只在第一次收到时记录，减少日志输出）
-		if pkt.Type == av.Metadata && !hasMetadata {
-			hasMetadata = true
+		if cfg.Exporter.StartupBuffer > 0 {
+			startupBuffer = cfg.Exporter.StartupBuffer
 		}
 
-		// joy5: 使用 Type 判断包类型
-		switch pkt.Type {
-		case av.H264:
-			videoCount++
-			hasVideo = true
-			actualPackets++
-
-			if pkt.IsKeyFrame {
-				keyframeCount++
+		// 端到端延迟按项目配置嵌入时间戳的位置
+		project := cfg.Projects[sc.project]
+		latency.amfKey = project.Latency.AMFKey
+		projectRequest = project.Request
+		projectSign = project.Sign
+		if project.Latency.SEIUUID != "" {
+			uuid, err := parseSEIUUID(project.Latency.SEIUUID)
+			if err != nil {
+				sc.log.Warn("忽略 SEI 延迟配置", "项目", sc.project, "错误", err)
 			}
+			latency.seiUUID = uuid
+		}
+	}
+	// 流级别的阈值优先
+	if sc.avSyncThreshold > 0 {
+		avSyncThreshold = sc.avSyncThreshold
+	}
+	sampleDuration := time.Duration(sampleDurationSec) * time.Second
 
-			// 记录时间戳和到达时间
-			if firstPacketTime.IsZero() {
-				firstPacketTime = pktRecvTime
-				firstDTS = int64(pkt.Time)
-				lastVideoTime = pktRecvTime
-				lastVideoDTS = int64(pkt.Time)
-			} else {
-				// 计算包间隔时间（用于抖动计算）
-				interval := pktRecvTime.Sub(lastVideoTime).Seconds() * 1000 // 转换为毫秒
-				if interval > 0 {
-					packetIntervals = append(packetIntervals, interval)
-				}
-				lastVideoTime = pktRecvTime
-
-				// 估算丢包（基于DTS时间戳）
-				currentDTS := int64(pkt.Time)
-				if lastVideoDTS > 0 && currentDTS > lastVideoDTS {
-					dtsDiff := currentDTS - lastVideoDTS
-					// 假设帧率为25fps，每帧时间约为40ms（40000000ns）
-					expectedFrames := dtsDiff / 40000000
-					if expectedFrames > 1 {
-						expectedPackets += expectedFrames
-					} else {
-						expectedPackets++
-					}
-				}
-				lastVideoDTS = currentDTS
-			}
-			lastDTS = int64(pkt.Time)
+	// HTTP 请求选项，每次检查重新读取环境变量和文件中的密钥
+	header, err := requestHeader(projectRequest, sc.request)
+	if err != nil {
+		return err
+	}
+	// CDN 鉴权地址每次检查（包括重试）都重新签名，指标标签仍使用未签名的地址
+	if sc.sign.Type != "" {
+		projectSign = sc.sign
+	}
+	playURL, err := signURL(sc.target, projectSign, time.Now())
+	if err != nil {
+		return err
+	}
 
-			// 获取编码信息（避免频繁加锁，只在第一次设置）
-			if sc.codec == "" {
-				sc.codec = "H264"
-			}
-		case av.AAC:
-			audioCount++
-		}
+	// 自动计算最大采样字节数限制
+	// 基于采样时长和常见码率范围（1-10Mbps）自动估算，留出2倍安全余量
+	// 公式: maxBytes = (maxBitrate * sampleDuration) / 8 * 2
+	// 假设最大码率为 10Mbps，转换为字节: 10Mbps * sampleDuration / 8 * 2 (安全系数)
+	maxBitrateBps := int64(10 * 1000 * 1000)                             // 10Mbps = 10,000,000 bps
+	maxSampleBytes := (maxBitrateBps * int64(sampleDurationSec)) / 8 * 2 // 2倍安全余量
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx, playURL, err = sc.pinEdge(ctx, playURL)
+	if err != nil {
+		return err
 	}
 
-	if !hasVideo {
-		return fmt.Errorf("未找到视频流")
+	// 由协议探测器建立连接，统一输出 Packet。HTTP 类协议通过 httptrace 记录起播各阶段耗时
+	openStart := time.Now()
+	trace := &startupTrace{start: openStart}
+	// 每次尝试都更新 TLS 证书信息，证书过期等原因导致连接失败时同样记录
+	defer sc.updateTLS(trace)
+	session, err := sc.prober.Open(trace.withContext(ctx), ProbeOptions{
+		URL:            playURL,
+		SampleDuration: sampleDuration,
+		RTSPTransport:  rtspTransport,
+		Header:         header,
+		Log:            sc.log.With("流ID", sc.id),
+	})
+	if err != nil {
+		return redactURLError(err)
+	}
+	defer session.Close()
+
+	a, err := sc.sample(ctx, session, sampleConfig{
+		duration:      sampleDuration,
+		minKeyframes:  minKeyframes,
+		maxBytes:      maxSampleBytes,
+		jumpGap:       time.Duration(jumpThreshold) * time.Millisecond,
+		startupBuffer: time.Duration(startupBuffer) * time.Millisecond,
+		latency:       latency,
+	})
+	if err != nil {
+		return redactURLError(err)
+	}
+	// 纯音频流同样视为正常，只有音视频都没有时才判定失败
+	if a.video == 0 && a.audio == 0 {
+		return fmt.Errorf("未找到音视频流")
 	}
 
 	duration := time.Since(startTime)
 
-	// 计算 GOP 大小（关键帧间隔的帧数）
-	if keyframeCount > 1 {
-		// 简单方法：总帧数 / 关键帧数
-		keyframeInterval = videoCount / keyframeCount
-	} else if keyframeCount == 1 {
-		// 只有一个关键帧，GOP就是所有帧
-		keyframeInterval = videoCount
-	} else {
-		// 没有关键帧，设为0
-		keyframeInterval = 0
+	// 按标称帧率估算丢帧
+	pts := a.sortedVideoPTS()
+	frameDuration, frameRateSource := a.frameDuration(pts)
+	droppedFrames, frameLossRatio := a.frameLoss(pts, frameDuration)
+
+	// 通用分析结果，RTT 默认使用响应时间作为近似值，协议层统计可在 Finish 中覆盖
+	report := Report{
+		Protocol:        sc.protocol,
+		Codec:           a.codec,
+		RTT:             session.ResponseTime(),
+		PacketLossRatio: frameLossRatio,
+		NetworkJitter:   a.jitter(),
+		FirstVideo:      a.firstVideo,
 	}
+	session.Finish(&report)
 
 	// 更新统计数据（记录本次检查的值）
 	sc.mu.Lock()
@@ -345,29 +393,96 @@ func (sc *Checker) Check(timeout time.Duration) error {
 		sc.log.Info("流恢复", "流ID", sc.id, "重连次数", sc.reconnectCount)
 	}
 
-	sc.totalPackets = int64(packetCount)
-	sc.videoPackets = int64(videoCount)
-	sc.audioPackets = int64(audioCount)
-	sc.keyframes = int64(keyframeCount)
+	sc.totalPackets = int64(a.packets)
+	sc.videoPackets = int64(a.video)
+	sc.audioPackets = int64(a.audio)
+	sc.keyframes = int64(a.keyframes)
 	sc.lastCheckTime = time.Now()
 	sc.healthy = true
 	sc.consecutiveFails = 0
-	sc.gopSize = keyframeInterval
-	sc.response = responseTime // 更新响应时间
+	sc.gopSize = a.gopSize()
+	sc.keyframeIntervalMin, sc.keyframeIntervalAvg, sc.keyframeIntervalMax, sc.gopCV, _ = a.keyframeIntervals()
+	sc.response = session.ResponseTime()
+	sc.protocol = report.Protocol
+	sc.codec = report.Codec
+	sc.rtt = report.RTT
+	sc.packetLossRatio = report.PacketLossRatio
+	sc.networkJitter = report.NetworkJitter
+	sc.stats = report.stats
+
+	// 分辨率和编码参数（SPS 不可用时清空，避免沿用上次的值）
+	info := a.videoInfo
+	sc.width = info.width
+	sc.height = info.height
+	sc.videoProfile = info.profile
+	sc.videoLevel = info.level
+	sc.chromaFormat = info.chromaFormat
+	sc.bitDepth = info.bitDepth
+
+	// 音频参数（与视频分开统计）
+	sc.audioCodec = a.audioCodec
+	sc.audioSampleRate = a.audioInfo.sampleRate
+	sc.audioChannels = a.audioInfo.channels
+	sc.audioBitrate = a.audioBitrate()
+
+	// 音画同步（只有音视频都有时才能计算，否则为 0）
+	drift, slope, ok := a.avSync()
+	sc.avSyncDrift = drift
+	sc.avSyncSlope = slope
+	sc.avSyncExceeded = ok && math.Abs(drift) > float64(avSyncThreshold)
+
+	// 时间戳异常
+	sc.tsAnomalies = a.anomalies
+
+	// 丢帧
+	sc.nominalFramerate = 0
+	if frameDuration > 0 {
+		sc.nominalFramerate = float64(time.Second) / float64(frameDuration)
+	}
+	sc.droppedFrames = droppedFrames
+	sc.frameLossRatio = frameLossRatio
 
 	// 计算帧率和码率（基于 DTS 时间，更准确）
-	if !firstPacketTime.IsZero() && lastDTS > firstDTS {
-		dtsElapsed := float64(lastDTS-firstDTS) / 1e9 // 纳秒转秒
-		if dtsElapsed > 0 {
-			sc.framerate = float64(videoCount) / dtsElapsed
-			// 基于 DTS 时间计算码率更准确
-			sc.currentBitrate = (float64(totalBytes) * 8) / dtsElapsed // bps
-		}
+	if dtsElapsed := a.dtsElapsed(); dtsElapsed > 0 {
+		sc.framerate = float64(a.video) / dtsElapsed
+		// 基于 DTS 时间计算码率更准确
+		sc.currentBitrate = (float64(a.bytes) * 8) / dtsElapsed // bps
 	} else if duration.Seconds() > 0 {
-		// 如果没有 DTS，使用实际耗时
-		sc.currentBitrate = (float64(totalBytes) * 8) / duration.Seconds() // bps
+		// 如果没有 DTS（如纯音频流），使用实际耗时
+		sc.framerate = 0
+		sc.currentBitrate = (float64(a.bytes) * 8) / duration.Seconds() // bps
 	}
 
+	// onMetaData 声明值与实测值对比（声明或实测为 0 时不比较）
+	sc.metadata = a.metadataInfo
+	sc.hasMetadata = a.hasMetadataInfo
+	tolerance := float64(mismatchThreshold) / 100
+	sc.bitrateMismatch = mismatched(sc.metadata.videoDataRate*1000, a.videoBitrate(), tolerance)
+	sc.framerateMismatch = mismatched(sc.metadata.framerate, sc.framerate, tolerance)
+
+	// 画面冻结（按帧负载大小和指纹判断，不解码）
+	sc.frozenSeconds = a.freeze.longest.Seconds()
+	sc.frozen = a.freeze.longest >= time.Duration(frozenThreshold)*time.Second
+
+	// 实时性和模拟播放器卡顿
+	player := a.player()
+	sc.realtimeRatio = player.realtimeRatio()
+	sc.longestGap = a.longestGap.Milliseconds()
+	sc.rebuffers = int64(player.rebuffers)
+	sc.stallSeconds = player.stallTime.Seconds()
+
+	// 起播耗时
+	sc.dnsTime, sc.connectTime, sc.tlsTime, sc.timeToFirstByte = trace.snapshot()
+	sc.timeToFirstTag = sinceStart(openStart, a.firstPacket)
+	sc.timeToFirstVideo = sinceStart(openStart, a.firstVideo)
+	sc.timeToFirstKeyframe = sinceStart(openStart, a.firstKeyframe)
+
+	// 端到端延迟
+	sc.glassLatency, sc.hasGlassLatency = a.latency.average()
+
+	// 边缘节点
+	sc.edge, _ = trace.edgeSnapshot()
+
 	// 更新码率历史（优化：减少计算频率）
 	if sc.currentBitrate > 0 {
 		sc.bitrateHistory = append(sc.bitrateHistory, sc.currentBitrate)
@@ -417,55 +532,22 @@ func (sc *Checker) Check(timeout time.Duration) error {
 		}
 	}
 
-	// 此处延迟已定义为 HTTP-FLV 请求响应时间（在完成HTTP响应后已设置）
-
-	// 计算网络稳定性指标
-	// RTT 使用 HTTP 响应时间作为近似值
-	sc.rtt = responseTime
-
-	// 计算丢包率
-	if expectedPackets > 0 {
-		lostPackets := expectedPackets - actualPackets
-		if lostPackets < 0 {
-			lostPackets = 0
-		}
-		sc.packetLossRatio = float64(lostPackets) / float64(expectedPackets)
-		// 确保在合理范围内
-		if sc.packetLossRatio > 1.0 {
-			sc.packetLossRatio = 1.0
-		}
-		if sc.packetLossRatio < 0 {
-			sc.packetLossRatio = 0
-		}
-	} else {
-		sc.packetLossRatio = 0
-	}
-
-	// 计算网络抖动（包间隔的标准差）
-	if len(packetIntervals) > 1 {
-		// 计算平均间隔
-		var sum float64
-		for _, interval := range packetIntervals {
-			sum += interval
-		}
-		avgInterval := sum / float64(len(packetIntervals))
-
-		// 计算标准差
-		var variance float64
-		for _, interval := range packetIntervals {
-			diff := interval - avgInterval
-			variance += diff * diff
-		}
-		variance /= float64(len(packetIntervals))
-		jitter := math.Sqrt(variance)
-		sc.networkJitter = int64(jitter)
-	} else {
-		sc.networkJitter = 0
-	}
-
 	// 评估质量
-	sc.playable = keyframeCount >= 2 && videoCount > 10
-	if sc.playable {
+	sc.playable = a.keyframes >= 2 && a.video > 10
+	if a.video == 0 {
+		// 纯音频流：按音频包数判断可播放，按音频码率评估质量
+		sc.playable = a.audio > 10
+		switch {
+		case !sc.playable:
+			sc.quality = "poor"
+		case sc.audioBitrate >= 96000:
+			sc.quality = "good"
+		case sc.audioBitrate >= 48000:
+			sc.quality = "fair"
+		default:
+			sc.quality = "poor"
+		}
+	} else if sc.playable {
 		// 质量评估：基于帧率、码率和稳定性
 		if sc.framerate >= 25 && sc.currentBitrate >= 600000 {
 			// 高质量：帧率>=25fps，码率>=600kbps
@@ -480,6 +562,10 @@ func (sc *Checker) Check(timeout time.Duration) error {
 	} else {
 		sc.quality = "poor"
 	}
+	// 画面冻结时即使帧率、码率正常也视为低质量
+	if sc.frozen {
+		sc.quality = "poor"
+	}
 
 	// 注意：这里已经持有 mu.Lock()，不需要再加锁
 	sc.log.Debug("检查完成",
@@ -488,14 +574,49 @@ func (sc *Checker) Check(timeout time.Duration) error {
 		"可播放", sc.playable,
 		"质量", sc.quality,
 		"请求响应ms", sc.response,
-		"视频包", videoCount,
-		"关键帧", keyframeCount,
+		"视频包", a.video,
+		"关键帧", a.keyframes,
 		"码率kbps", fmt.Sprintf("%.1f", sc.currentBitrate/1000),
 		"平均码率kbps", fmt.Sprintf("%.1f", sc.avgBitrate/1000),
 		"稳定性", sc.bitrateStability,
 		"帧率fps", fmt.Sprintf("%.1f", sc.framerate),
 		"GOP帧", sc.gopSize,
+		"关键帧间隔秒", fmt.Sprintf("%.2f", sc.keyframeIntervalAvg),
+		"GOP变异系数", fmt.Sprintf("%.2f", sc.gopCV),
 		"编码", sc.codec,
+		"分辨率", fmt.Sprintf("%dx%d", sc.width, sc.height),
+		"Profile", sc.videoProfile,
+		"Level", sc.videoLevel,
+		"音频编码", sc.audioCodec,
+		"采样率", sc.audioSampleRate,
+		"声道数", sc.audioChannels,
+		"音频码率kbps", fmt.Sprintf("%.1f", sc.audioBitrate/1000),
+		"音画偏差ms", fmt.Sprintf("%.1f", sc.avSyncDrift),
+		"音画偏差斜率ms每分钟", fmt.Sprintf("%.1f", sc.avSyncSlope),
+		"DTS回退", sc.tsAnomalies.regressions,
+		"DTS跳变", sc.tsAnomalies.jumps,
+		"PTS早于DTS", sc.tsAnomalies.ptsBeforeDTS,
+		"时间戳回绕", sc.tsAnomalies.wraps,
+		"标称帧率", fmt.Sprintf("%.2f", sc.nominalFramerate),
+		"帧率来源", frameRateSource,
+		"丢帧数", sc.droppedFrames,
+		"丢帧率", fmt.Sprintf("%.2f%%", sc.frameLossRatio*100),
+		"编码器", sc.metadata.encoder,
+		"码率不符", sc.bitrateMismatch,
+		"帧率不符", sc.framerateMismatch,
+		"画面冻结", sc.frozen,
+		"静止秒", fmt.Sprintf("%.1f", sc.frozenSeconds),
+		"实时比", fmt.Sprintf("%.2f", sc.realtimeRatio),
+		"最长间隔ms", sc.longestGap,
+		"卡顿次数", sc.rebuffers,
+		"卡顿秒", fmt.Sprintf("%.1f", sc.stallSeconds),
+		"首字节ms", fmt.Sprintf("%.0f", sc.timeToFirstByte),
+		"首帧ms", fmt.Sprintf("%.0f", sc.timeToFirstKeyframe),
+		"端到端延迟ms", fmt.Sprintf("%.0f", sc.glassLatency),
+		"节点", sc.edge.host,
+		"节点IP", sc.edge.ip,
+		"跳转次数", sc.edge.hops,
+		"跳转链", strings.Join(sc.edge.chain, " -> "),
 		"RTT毫秒", sc.rtt,
 		"丢包率", fmt.Sprintf("%.2f%%", sc.packetLossRatio*100),
 		"网络抖动ms", sc.networkJitter,
@@ -504,6 +625,14 @@ func (sc *Checker) Check(timeout time.Duration) error {
 	return nil
 }
 
+// mismatched 声明值与实测值的相对偏差是否超过 tolerance，任一值为 0 时视为无法比较
+func mismatched(declared, measured, tolerance float64) bool {
+	if declared <= 0 || measured <= 0 {
+		return false
+	}
+	return math.Abs(measured-declared)/declared > tolerance
+}
+
 // MarkFailed 标记检查失败
 func (sc *Checker) MarkFailed() {
 	sc.mu.Lock()
@@ -522,8 +651,47 @@ func (sc *Checker) MarkFailed() {
 	sc.codec = ""
 	sc.response = 0
 	sc.gopSize = 0
+	sc.keyframeIntervalMin = 0
+	sc.keyframeIntervalAvg = 0
+	sc.keyframeIntervalMax = 0
+	sc.gopCV = 0
 	sc.width = 0
 	sc.height = 0
+	sc.videoProfile = ""
+	sc.videoLevel = ""
+	sc.chromaFormat = ""
+	sc.bitDepth = 0
+	sc.audioCodec = ""
+	sc.audioSampleRate = 0
+	sc.audioChannels = 0
+	sc.audioBitrate = 0
+	sc.avSyncDrift = 0
+	sc.avSyncSlope = 0
+	sc.avSyncExceeded = false
+	sc.tsAnomalies = timestampAnomalies{}
+	sc.nominalFramerate = 0
+	sc.droppedFrames = 0
+	sc.frameLossRatio = 1.0 // 与丢包率一致，完全失败时为100%
+	sc.metadata = metadataInfo{}
+	sc.hasMetadata = false
+	sc.bitrateMismatch = false
+	sc.framerateMismatch = false
+	sc.frozen = false
+	sc.frozenSeconds = 0
+	sc.realtimeRatio = 0
+	sc.longestGap = 0
+	sc.rebuffers = 0
+	sc.stallSeconds = 0
+	sc.dnsTime = 0
+	sc.connectTime = 0
+	sc.tlsTime = 0
+	sc.timeToFirstByte = 0
+	sc.timeToFirstTag = 0
+	sc.timeToFirstVideo = 0
+	sc.timeToFirstKeyframe = 0
+	sc.glassLatency = 0
+	sc.hasGlassLatency = false
+	sc.edge = edgeInfo{}
 	sc.quality = "poor"
 	sc.bitrateStability = "unstable"
 	sc.lastCheckTime = time.Now()
@@ -532,6 +700,9 @@ func (sc *Checker) MarkFailed() {
 	sc.rtt = 0
 	sc.packetLossRatio = 1.0 // 完全失败时丢包率为100%
 	sc.networkJitter = 0
+
+	// 协议相关指标重置（HLS 播放列表状态保存在 hlsProber 中，失败时保留，用于继续计算停滞时间）
+	sc.stats = nil
 	// 注意：重连次数在恢复成功时累加，而不是在失败时
 }
 
@@ -550,63 +721,213 @@ func (sc *Checker) GetMetrics() Metrics {
 	sc.mu.RLock()
 	defer sc.mu.RUnlock()
 
-	return Metrics{
-		ID:               sc.id,
-		URL:              sc.url,
-		Project:          sc.project,
-		Name:             sc.name,
-		TotalPackets:     sc.totalPackets,
-		VideoPackets:     sc.videoPackets,
-		AudioPackets:     sc.audioPackets,
-		Keyframes:        sc.keyframes,
-		CurrentBitrate:   sc.currentBitrate,
-		AvgBitrate:       sc.avgBitrate,
-		Framerate:        sc.framerate,
-		Codec:            sc.codec,
-		Response:         sc.response,
-		GOPSize:          sc.gopSize,
-		Width:            sc.width,
-		Height:           sc.height,
-		Quality:          sc.quality,
-		Playable:         sc.playable,
-		BitrateStability: sc.bitrateStability,
-		Healthy:          sc.healthy,
-		LastCheckTime:    sc.lastCheckTime,
-		ConsecutiveFails: sc.consecutiveFails,
-		RTT:              sc.rtt,
-		PacketLossRatio:  sc.packetLossRatio,
-		NetworkJitter:    sc.networkJitter,
-		ReconnectCount:   sc.reconnectCount,
+	m := Metrics{
+		ID:                    sc.id,
+		URL:                   sc.url,
+		Project:               sc.project,
+		Name:                  sc.name,
+		Edge:                  sc.edgeName,
+		Protocol:              sc.protocol,
+		TotalPackets:          sc.totalPackets,
+		VideoPackets:          sc.videoPackets,
+		AudioPackets:          sc.audioPackets,
+		Keyframes:             sc.keyframes,
+		CurrentBitrate:        sc.currentBitrate,
+		AvgBitrate:            sc.avgBitrate,
+		Framerate:             sc.framerate,
+		Codec:                 sc.codec,
+		Response:              sc.response,
+		GOPSize:               sc.gopSize,
+		KeyframeIntervalMin:   sc.keyframeIntervalMin,
+		KeyframeIntervalAvg:   sc.keyframeIntervalAvg,
+		KeyframeIntervalMax:   sc.keyframeIntervalMax,
+		GOPCV:                 sc.gopCV,
+		Width:                 sc.width,
+		Height:                sc.height,
+		VideoProfile:          sc.videoProfile,
+		VideoLevel:            sc.videoLevel,
+		ChromaFormat:          sc.chromaFormat,
+		BitDepth:              sc.bitDepth,
+		AudioCodec:            sc.audioCodec,
+		AudioSampleRate:       sc.audioSampleRate,
+		AudioChannels:         sc.audioChannels,
+		AudioBitrate:          sc.audioBitrate,
+		AVSyncDrift:           sc.avSyncDrift,
+		AVSyncSlope:           sc.avSyncSlope,
+		AVSyncExceeded:        sc.avSyncExceeded,
+		DTSRegressions:        sc.tsAnomalies.regressions,
+		DTSJumps:              sc.tsAnomalies.jumps,
+		PTSBeforeDTS:          sc.tsAnomalies.ptsBeforeDTS,
+		TimestampWraps:        sc.tsAnomalies.wraps,
+		NominalFramerate:      sc.nominalFramerate,
+		DroppedFrames:         sc.droppedFrames,
+		FrameLossRatio:        sc.frameLossRatio,
+		HasMetadata:           sc.hasMetadata,
+		MetadataWidth:         sc.metadata.width,
+		MetadataHeight:        sc.metadata.height,
+		MetadataFramerate:     sc.metadata.framerate,
+		MetadataVideoDataRate: sc.metadata.videoDataRate,
+		MetadataAudioDataRate: sc.metadata.audioDataRate,
+		MetadataEncoder:       sc.metadata.encoder,
+		BitrateMismatch:       sc.bitrateMismatch,
+		FramerateMismatch:     sc.framerateMismatch,
+		Frozen:                sc.frozen,
+		FrozenSeconds:         sc.frozenSeconds,
+		RealtimeRatio:         sc.realtimeRatio,
+		LongestGap:            sc.longestGap,
+		Rebuffers:             sc.rebuffers,
+		StallSeconds:          sc.stallSeconds,
+		DNSTime:               sc.dnsTime,
+		ConnectTime:           sc.connectTime,
+		TLSTime:               sc.tlsTime,
+		TimeToFirstByte:       sc.timeToFirstByte,
+		TimeToFirstTag:        sc.timeToFirstTag,
+		TimeToFirstVideo:      sc.timeToFirstVideo,
+		TimeToFirstKeyframe:   sc.timeToFirstKeyframe,
+		GlassLatency:          sc.glassLatency,
+		HasGlassLatency:       sc.hasGlassLatency,
+		EdgeHost:              sc.edge.host,
+		EdgeIP:                sc.edge.ip,
+		EdgeServer:            sc.edge.server,
+		EdgeVia:               sc.edge.via,
+		EdgeCache:             sc.edge.cache,
+		RedirectHops:          sc.edge.hops,
+		RedirectChain:         sc.edge.chain,
+		HasTLS:                sc.hasCert,
+		TLSVersion:            sc.cert.version,
+		TLSCipher:             sc.cert.cipher,
+		TLSIssuer:             sc.cert.issuer,
+		TLSCertNotAfter:       sc.cert.notAfter,
+		TLSHostMatch:          sc.cert.hostMatch,
+		Quality:               sc.quality,
+		Playable:              sc.playable,
+		BitrateStability:      sc.bitrateStability,
+		Healthy:               sc.healthy,
+		LastCheckTime:         sc.lastCheckTime,
+		ConsecutiveFails:      sc.consecutiveFails,
+		RTT:                   sc.rtt,
+		PacketLossRatio:       sc.packetLossRatio,
+		NetworkJitter:         sc.networkJitter,
+		ReconnectCount:        sc.reconnectCount,
+	}
+	if sc.stats != nil {
+		sc.stats.fill(&m)
 	}
+	return m
 }
 
 // Metrics 流指标
 type Metrics struct {
-	ID               string
-	URL              string
-	Project          string
-	Name             string
-	TotalPackets     int64
-	VideoPackets     int64
-	AudioPackets     int64
-	Keyframes        int64
-	CurrentBitrate   float64
-	AvgBitrate       float64
-	Framerate        float64
-	Codec            string
-	Response         int64
-	GOPSize          int
-	Width            int
-	Height           int
-	Quality          string
-	Playable         bool
-	BitrateStability string
-	Healthy          bool
-	LastCheckTime    time.Time
-	ConsecutiveFails int
+	ID                  string
+	URL                 string
+	Project             string
+	Name                string
+	Edge                string // 多边缘检查的边缘名称，未配置 edges 时为空
+	Protocol            string
+	TotalPackets        int64
+	VideoPackets        int64
+	AudioPackets        int64
+	Keyframes           int64
+	CurrentBitrate      float64
+	AvgBitrate          float64
+	Framerate           float64
+	Codec               string
+	Response            int64
+	GOPSize             int
+	KeyframeIntervalMin float64 // 最短关键帧间隔（秒）
+	KeyframeIntervalAvg float64 // 平均关键帧间隔（秒）
+	KeyframeIntervalMax float64 // 最长关键帧间隔（秒）
+	GOPCV               float64 // 关键帧间隔的变异系数（标准差 / 平均值）
+	Width               int
+	Height              int
+	VideoProfile        string  // 视频 profile，例如 High、Main 10
+	VideoLevel          string  // 视频 level，例如 4.1
+	ChromaFormat        string  // 色度采样格式，例如 4:2:0
+	BitDepth            int     // 亮度位深
+	AudioCodec          string  // 音频编码，例如 AAC、MP3、OPUS
+	AudioSampleRate     int     // 音频采样率（Hz）
+	AudioChannels       int     // 音频声道数
+	AudioBitrate        float64 // 音频码率（bps）
+	AVSyncDrift         float64 // 音画偏差（毫秒），正数表示音频时间戳超前视频
+	AVSyncSlope         float64 // 音画偏差变化斜率（毫秒/分钟）
+	AVSyncExceeded      bool    // 音画偏差绝对值是否超过阈值
+	DTSRegressions      int64   // DTS 回退次数
+	DTSJumps            int64   // DTS 前跳超过阈值的次数
+	PTSBeforeDTS        int64   // PTS < DTS 的视频帧数
+	TimestampWraps      int64   // 时间戳回绕次数（FLV 32 位毫秒 / MPEG-TS 33 位）
+	NominalFramerate    float64 // 标称帧率（fps）
+	DroppedFrames       int64   // 估算的丢帧数
+	FrameLossRatio      float64 // 丢帧率（0.0-1.0）
+	// onMetaData 声明的编码参数（仅 FLV / RTMP 流有效）
+	HasMetadata           bool
+	MetadataWidth         int
+	MetadataHeight        int
+	MetadataFramerate     float64
+	MetadataVideoDataRate float64 // 声明的视频码率（kbps）
+	MetadataAudioDataRate float64 // 声明的音频码率（kbps）
+	MetadataEncoder       string
+	BitrateMismatch       bool     // 声明的视频码率与实测相差超过阈值
+	FramerateMismatch     bool     // 声明的帧率与实测相差超过阈值
+	Frozen                bool     // 画面是否冻结
+	FrozenSeconds         float64  // 最长画面静止时长（秒）
+	RealtimeRatio         float64  // 媒体时间推进量 / 系统时间，小于 1 表示慢于实时
+	LongestGap            int64    // 最长包到达间隔（毫秒）
+	Rebuffers             int64    // 模拟播放器卡顿次数
+	StallSeconds          float64  // 模拟播放器卡顿总时长（秒）
+	DNSTime               float64  // DNS 解析耗时（毫秒），仅 HTTP 类协议
+	ConnectTime           float64  // TCP 连接耗时（毫秒），仅 HTTP 类协议
+	TLSTime               float64  // TLS 握手耗时（毫秒），仅 HTTPS
+	TimeToFirstByte       float64  // 开始建立连接到收到响应首字节的耗时（毫秒），仅 HTTP 类协议
+	TimeToFirstTag        float64  // 开始建立连接到第一个数据包（FLV 为第一个 tag）的耗时（毫秒）
+	TimeToFirstVideo      float64  // 开始建立连接到第一个视频包的耗时（毫秒）
+	TimeToFirstKeyframe   float64  // 开始建立连接到第一个关键帧（首帧）的耗时（毫秒）
+	GlassLatency          float64  // 端到端延迟（毫秒）：到达时间 - 编码端嵌入的系统时间
+	HasGlassLatency       bool     // 是否找到了嵌入时间
+	EdgeHost              string   // 最终提供流的主机名（仅 HTTP 类协议）
+	EdgeIP                string   // 最终连接的远端 IP
+	EdgeServer            string   // 最终响应的 Server 头
+	EdgeVia               string   // 最终响应的 Via 头
+	EdgeCache             string   // 最终响应的 X-Cache 头
+	RedirectHops          int      // 跳转次数
+	RedirectChain         []string // 跳转链（不含查询参数），最后一项为最终地址
+	Quality               string
+	Playable              bool
+	BitrateStability      string
+	Healthy               bool
+	LastCheckTime         time.Time
+	ConsecutiveFails      int
+	// TLS 证书（仅 HTTPS）
+	HasTLS          bool      // 是否取得了服务端证书
+	TLSVersion      string    // 协商的 TLS 版本，证书校验失败时为空
+	TLSCipher       string    // 协商的加密套件，证书校验失败时为空
+	TLSIssuer       string    // 叶子证书的签发者
+	TLSCertNotAfter time.Time // 证书链中最早的过期时间
+	TLSHostMatch    bool      // 叶子证书的 SAN 是否匹配请求的主机名
 	// 网络稳定性指标
 	RTT             int64   // RTT 往返时间（毫秒）
 	PacketLossRatio float64 // 丢包率（0.0-1.0）
 	NetworkJitter   int64   // 网络抖动（毫秒）
 	ReconnectCount  int64   // 重连次数
+	// HLS 指标（仅 HLS 流有效）
+	HLSPlaylistStaleness   float64 // 播放列表停滞时间（秒）
+	HLSTargetDurationDrift float64 // 最长分片时长与 TARGETDURATION 之差（秒）
+	HLSMediaSequenceGaps   int64   // 本次检查中跳过的分片数
+	// RTMP 指标（仅 RTMP 流有效）
+	RTMPHandshakeTime       int64 // 握手耗时（毫秒）
+	RTMPConnectToFirstVideo int64 // connect 到首个视频包耗时（毫秒）
+	// SRT 指标（仅 SRT 流有效）
+	SRTRTT                  float64 // 链路 RTT（毫秒）
+	SRTRetransmittedPackets int64   // 收到的重传包数
+	SRTDroppedPackets       int64   // 丢弃的包数
+	SRTReceiveBuffer        float64 // 接收缓冲区平均水位（毫秒）
+	// WHEP 指标（仅 WHEP 流有效）
+	WHEPICEConnectTime   int64 // ICE 连接耗时（毫秒）
+	WHEPTimeToFirstFrame int64 // 发送 offer 到首个视频帧的耗时（毫秒）
+	WHEPNACKCount        int64 // 发出的 NACK 数
+	WHEPPLICount         int64 // 发出的 PLI 数
+	// DASH 指标（仅 DASH 流有效）
+	DASHAvailabilitySkew    float64 // 按 availabilityStartTime 推算的媒体时间与最新分片结束时间之差（秒）
+	DASHSegmentFetchLatency float64 // 分片平均下载耗时（毫秒）
+	// HTTP-TS 指标（仅 HTTP-TS 流有效）
+	TSContinuityErrors map[int]int64 // PID -> 本次检查的连续计数器错误数
 }
@@ -0,0 +1,430 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	urlpkg "net/url"
+	"strings"
+	"time"
+
+	"github.com/nareix/joy5/av"
+	"github.com/nareix/joy5/codec/aac"
+	"github.com/nareix/joy5/codec/h264"
+)
+
+// MPEG-TS 常量
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	tsPIDPAT  = 0x0000
+	tsPIDNull = 0x1fff
+
+	tsStreamTypeAAC  = 0x0f
+	tsStreamTypeH264 = 0x1b
+	tsStreamTypeH265 = 0x24
+)
+
+// tsPES 正在组装的 PES 包
+type tsPES struct {
+	streamType uint8
+	buf        []byte
+	started    bool
+	configSent bool // 是否已按 ADTS 头输出 AudioSpecificConfig
+}
+
+// tsContinuity 单个 PID 的连续计数器状态
+type tsContinuity struct {
+	last      uint8
+	duplicate bool // 上一个包已经是重复包
+	errors    int64
+}
+
+// tsDemuxer MPEG-TS 解复用器
+// 只解析 PAT/PMT 和 H.264/H.265/AAC 的 PES，输出与 FLV 解复用器相同的 av.Packet
+type tsDemuxer struct {
+	r   *bufio.Reader
+	buf [tsPacketSize]byte
+
+	pmtPID     int
+	streams    map[int]*tsPES // PID -> PES
+	videoCodec string         // PMT 中视频流的编码：H264 / H265
+	pending    []av.Packet    // 已解析但尚未返回的包（一个 PES 可能包含多个 AAC 帧）
+	eof        bool
+
+	continuity map[int]*tsContinuity // PID -> 连续计数器状态
+}
+
+// newTSDemuxer 创建 MPEG-TS 解复用器
+func newTSDemuxer(r io.Reader) *tsDemuxer {
+	return &tsDemuxer{
+		r:          bufio.NewReaderSize(r, tsPacketSize*64),
+		pmtPID:     -1,
+		streams:    make(map[int]*tsPES),
+		continuity: make(map[int]*tsContinuity),
+	}
+}
+
+// ReadPacket 读取下一个音视频包
+func (d *tsDemuxer) ReadPacket() (av.Packet, error) {
+	for len(d.pending) == 0 {
+		if d.eof {
+			return av.Packet{}, io.EOF
+		}
+		if err := d.readTSPacket(); err != nil {
+			if err != io.EOF && err != io.ErrUnexpectedEOF {
+				return av.Packet{}, err
+			}
+			// 数据结束时输出缓存中的最后一个 PES
+			d.eof = true
+			for _, pes := range d.streams {
+				d.flushPES(pes)
+			}
+		}
+	}
+
+	pkt := d.pending[0]
+	d.pending = d.pending[1:]
+	return pkt, nil
+}
+
+// readTSPacket 读取并处理一个 188 字节的 TS 包
+func (d *tsDemuxer) readTSPacket() error {
+	if err := d.sync(); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(d.r, d.buf[:]); err != nil {
+		return err
+	}
+
+	b := d.buf[:]
+	pusi := b[1]&0x40 != 0
+	pid := int(b[1]&0x1f)<<8 | int(b[2])
+	afc := (b[3] >> 4) & 0x3
+
+	if pid != tsPIDNull {
+		d.checkContinuity(pid, b)
+	}
+
+	// 没有负载
+	if afc&0x1 == 0 {
+		return nil
+	}
+
+	offset := 4
+	if afc&0x2 != 0 {
+		offset += 1 + int(b[4])
+	}
+	if offset >= tsPacketSize {
+		return nil
+	}
+	payload := b[offset:]
+
+	switch {
+	case pid == tsPIDPAT:
+		if pusi {
+			d.parsePAT(payload)
+		}
+	case pid == d.pmtPID:
+		if pusi {
+			d.parsePMT(payload)
+		}
+	default:
+		pes, ok := d.streams[pid]
+		if !ok {
+			return nil
+		}
+		if pusi {
+			d.flushPES(pes)
+			pes.started = true
+		}
+		if pes.started {
+			pes.buf = append(pes.buf, payload...)
+		}
+	}
+
+	return nil
+}
+
+// checkContinuity 检查 continuity_counter（ISO/IEC 13818-1 2.4.3.3）：
+// 有负载的包逐个加 1，无负载的包保持不变，允许一次重复包，discontinuity_indicator 置位时重新计数
+func (d *tsDemuxer) checkContinuity(pid int, b []byte) {
+	cc := b[3] & 0x0f
+	hasPayload := b[3]&0x10 != 0
+	discontinuity := b[3]&0x20 != 0 && b[4] > 0 && b[5]&0x80 != 0
+
+	st, ok := d.continuity[pid]
+	if !ok {
+		d.continuity[pid] = &tsContinuity{last: cc}
+		return
+	}
+	defer func() { st.last = cc }()
+
+	switch {
+	case discontinuity:
+		st.duplicate = false
+	case !hasPayload:
+		if cc != st.last {
+			st.errors++
+		}
+	case cc == st.last && !st.duplicate:
+		st.duplicate = true
+	case cc != (st.last+1)&0x0f:
+		st.errors++
+		st.duplicate = false
+	default:
+		st.duplicate = false
+	}
+}
+
+// codec 返回 PMT 中视频流的编码，未解析到 PMT 时为空（按 H264 处理）
+func (d *tsDemuxer) codec() string {
+	return d.videoCodec
+}
+
+// continuityErrors 返回每个 PID 的连续计数器错误数
+func (d *tsDemuxer) continuityErrors() map[int]int64 {
+	errs := make(map[int]int64, len(d.continuity))
+	for pid, st := range d.continuity {
+		errs[pid] = st.errors
+	}
+	return errs
+}
+
+// sniffTS 根据前几个字节或 Content-Type 判断 HTTP 响应是否为 MPEG-TS：
+// 以 FLV 头开始时按 FLV 处理，连续两个包以同步字节开头或 Content-Type 为 video/mp2t 时按 TS 处理
+func sniffTS(r *bufio.Reader, contentType string) bool {
+	head, _ := r.Peek(tsPacketSize + 1)
+	if bytes.HasPrefix(head, []byte("FLV")) {
+		return false
+	}
+	if len(head) > tsPacketSize && head[0] == tsSyncByte && head[tsPacketSize] == tsSyncByte {
+		return true
+	}
+	contentType = strings.ToLower(contentType)
+	return strings.Contains(contentType, "mp2t") || strings.Contains(contentType, "mpegts")
+}
+
+// isHTTPTSURL 根据扩展名判断是否为 HTTP-TS 地址
+func isHTTPTSURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(strings.ToLower(u.Path), ".ts")
+}
+
+// sync 跳过非同步字节，直到下一个 0x47
+func (d *tsDemuxer) sync() error {
+	for skipped := 0; ; skipped++ {
+		c, err := d.r.Peek(1)
+		if err != nil {
+			return err
+		}
+		if c[0] == tsSyncByte {
+			return nil
+		}
+		if skipped > tsPacketSize*8 {
+			return fmt.Errorf("无效的 MPEG-TS 数据（找不到同步字节）")
+		}
+		if _, err := d.r.Discard(1); err != nil {
+			return err
+		}
+	}
+}
+
+// psiSection 跳过 pointer_field，返回 PSI 表数据
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+	pointer := int(payload[0])
+	if 1+pointer >= len(payload) {
+		return nil
+	}
+	section := payload[1+pointer:]
+	if len(section) < 3 {
+		return nil
+	}
+	sectionLen := int(section[1]&0x0f)<<8 | int(section[2])
+	end := 3 + sectionLen
+	if end > len(section) {
+		end = len(section)
+	}
+	return section[:end]
+}
+
+// parsePAT 解析 PAT，取第一个节目的 PMT PID
+func (d *tsDemuxer) parsePAT(payload []byte) {
+	section := psiSection(payload)
+	// 表头 8 字节，末尾 4 字节 CRC
+	if len(section) < 12 {
+		return
+	}
+	for i := 8; i+4 <= len(section)-4; i += 4 {
+		program := int(section[i])<<8 | int(section[i+1])
+		pid := int(section[i+2]&0x1f)<<8 | int(section[i+3])
+		if program != 0 {
+			d.pmtPID = pid
+			return
+		}
+	}
+}
+
+// parsePMT 解析 PMT，登记 H.264/H.265/AAC 基本流
+func (d *tsDemuxer) parsePMT(payload []byte) {
+	section := psiSection(payload)
+	if len(section) < 16 {
+		return
+	}
+	programInfoLen := int(section[10]&0x0f)<<8 | int(section[11])
+	i := 12 + programInfoLen
+	end := len(section) - 4
+	for i+5 <= end {
+		streamType := section[i]
+		pid := int(section[i+1]&0x1f)<<8 | int(section[i+2])
+		esInfoLen := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+		i += 5 + esInfoLen
+
+		switch streamType {
+		case tsStreamTypeH264, tsStreamTypeH265, tsStreamTypeAAC:
+			if _, ok := d.streams[pid]; !ok {
+				d.streams[pid] = &tsPES{streamType: streamType}
+			}
+		}
+		switch streamType {
+		case tsStreamTypeH264:
+			d.videoCodec = "H264"
+		case tsStreamTypeH265:
+			d.videoCodec = "H265"
+		}
+	}
+}
+
+// flushPES 解析已组装完成的 PES 并转换为 av.Packet
+func (d *tsDemuxer) flushPES(pes *tsPES) {
+	data := pes.buf
+	pes.buf = pes.buf[:0]
+	if !pes.started || len(data) < 9 {
+		return
+	}
+	if data[0] != 0 || data[1] != 0 || data[2] != 1 {
+		return
+	}
+
+	ptsDTSFlags := data[7] >> 6
+	headerLen := int(data[8])
+	if 9+headerLen > len(data) {
+		return
+	}
+
+	var pts, dts int64
+	if ptsDTSFlags&0x2 != 0 && headerLen >= 5 {
+		pts = parsePESTimestamp(data[9:14])
+		dts = pts
+	}
+	if ptsDTSFlags == 0x3 && headerLen >= 10 {
+		dts = parsePESTimestamp(data[14:19])
+		pts = unwrapPTS(pts, dts)
+	}
+
+	// 拷贝一份负载，pes.buf 会被复用
+	payload := append([]byte(nil), data[9+headerLen:]...)
+
+	switch pes.streamType {
+	case tsStreamTypeH264, tsStreamTypeH265:
+		// H.265 同样以 av.H264 类型输出，实际编码由 codec 给出
+		keyFrame := isH264KeyFrame(payload)
+		if pes.streamType == tsStreamTypeH265 {
+			keyFrame = isH265KeyFrame(payload)
+		}
+		d.pending = append(d.pending, av.Packet{
+			Type:       av.H264,
+			Data:       payload,
+			Time:       tsToDuration(dts),
+			CTime:      tsToDuration(pts - dts),
+			IsKeyFrame: keyFrame,
+		})
+	case tsStreamTypeAAC:
+		d.appendADTSFrames(pes, payload, pts)
+	}
+}
+
+// appendADTSFrames 把 PES 中的 ADTS 帧拆分为独立的 AAC 包，
+// 第一个帧之前按 ADTS 头补一个 AudioSpecificConfig，与 FLV 的 AAC sequence header 对应
+func (d *tsDemuxer) appendADTSFrames(pes *tsPES, payload []byte, pts int64) {
+	elapsed := time.Duration(0)
+	for len(payload) >= aac.ADTSHeaderLength {
+		cfg, hdrLen, frameLen, samples, err := aac.ParseADTSHeader(payload)
+		if err != nil || frameLen > len(payload) {
+			return
+		}
+		if !pes.configSent {
+			var asc bytes.Buffer
+			if aac.WriteMPEG4AudioConfig(&asc, cfg) == nil {
+				d.pending = append(d.pending, av.Packet{Type: av.AACDecoderConfig, Data: asc.Bytes(), Time: tsToDuration(pts)})
+			}
+			pes.configSent = true
+		}
+		d.pending = append(d.pending, av.Packet{
+			Type: av.AAC,
+			Data: payload[hdrLen:frameLen],
+			Time: tsToDuration(pts) + elapsed,
+		})
+		if cfg.SampleRate > 0 {
+			elapsed += time.Duration(samples) * time.Second / time.Duration(cfg.SampleRate)
+		}
+		payload = payload[frameLen:]
+	}
+}
+
+// parsePESTimestamp 解析 5 字节的 33 位 PTS/DTS
+func parsePESTimestamp(b []byte) int64 {
+	return int64(b[0]>>1&0x07)<<30 |
+		int64(b[1])<<22 |
+		int64(b[2]>>1)<<15 |
+		int64(b[3])<<7 |
+		int64(b[4]>>1)
+}
+
+// unwrapPTS 33 位 PTS 与 DTS 分别回绕时（如 DTS 接近 2^33 而 PTS 已回到 0），
+// 按离 DTS 最近的周期展开 PTS，避免 PTS - DTS 出现约 26.5 小时的偏差
+func unwrapPTS(pts, dts int64) int64 {
+	const period, half = 1 << 33, 1 << 32
+	switch diff := pts - dts; {
+	case diff < -half:
+		return pts + period
+	case diff > half:
+		return pts - period
+	}
+	return pts
+}
+
+// tsToDuration 90kHz 时间戳转换为 time.Duration
+func tsToDuration(ts int64) time.Duration {
+	return time.Duration(ts) * time.Second / 90000
+}
+
+// isH264KeyFrame 判断 Annex-B 格式的 H.264 帧是否包含 IDR
+func isH264KeyFrame(data []byte) bool {
+	nalus, _ := h264.SplitNALUs(data)
+	for _, nalu := range nalus {
+		if h264.NALUType(nalu) == h264.NALU_IDR {
+			return true
+		}
+	}
+	return false
+}
+
+// isH265KeyFrame 判断 Annex-B 格式的 H.265 帧是否包含 IRAP（BLA / IDR / CRA）
+func isH265KeyFrame(data []byte) bool {
+	nalus, _ := h264.SplitNALUs(data)
+	for _, nalu := range nalus {
+		if isKeyFrameNALU("H265", nalu) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,371 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/av"
+)
+
+// 测试流的 PID
+const (
+	testPIDPMT   = 0x1000
+	testPIDVideo = 0x100
+	testPIDAudio = 0x101
+)
+
+// tsTestMuxer 测试用的最小 MPEG-TS 复用器：一个节目，视频和 AAC 音频各一路
+type tsTestMuxer struct {
+	out       []byte
+	cc        map[int]byte
+	videoType byte // PMT 中的视频 stream_type
+}
+
+// newTSTestMuxer 创建复用器并写入 PAT / PMT
+func newTSTestMuxer(videoType byte) *tsTestMuxer {
+	m := &tsTestMuxer{cc: make(map[int]byte), videoType: videoType}
+	m.psi(tsPIDPAT, []byte{0x00, 0xb0, 13, 0, 1, 0xc1, 0, 0, 0, 1, 0xe0 | testPIDPMT>>8, testPIDPMT & 0xff})
+	m.psi(testPIDPMT, []byte{0x02, 0xb0, 23, 0, 1, 0xc1, 0, 0, 0xe1, 0x00, 0xf0, 0,
+		videoType, 0xe0 | testPIDVideo>>8, testPIDVideo & 0xff, 0xf0, 0,
+		tsStreamTypeAAC, 0xe0 | testPIDAudio>>8, testPIDAudio & 0xff, 0xf0, 0})
+	return m
+}
+
+// packets 把负载切成 TS 包，最后一个包用 adaptation field 填充
+func (m *tsTestMuxer) packets(pid int, payload []byte) {
+	for first := true; first || len(payload) > 0; first = false {
+		pkt := make([]byte, tsPacketSize)
+		pkt[0] = tsSyncByte
+		pkt[1] = byte(pid>>8) & 0x1f
+		if first {
+			pkt[1] |= 0x40
+		}
+		pkt[2] = byte(pid)
+		cc := m.cc[pid]
+		m.cc[pid] = (cc + 1) & 0x0f
+
+		if n := len(payload); n >= tsPacketSize-4 {
+			pkt[3] = 0x10 | cc
+			payload = payload[copy(pkt[4:], payload):]
+		} else {
+			pkt[3] = 0x30 | cc
+			stuffing := tsPacketSize - 5 - n
+			pkt[4] = byte(stuffing)
+			if stuffing > 0 {
+				for i := 6; i < 5+stuffing; i++ {
+					pkt[i] = 0xff
+				}
+			}
+			copy(pkt[5+stuffing:], payload)
+			payload = nil
+		}
+		m.out = append(m.out, pkt...)
+	}
+}
+
+// psi 输出带 pointer_field 和 CRC 的 PSI 表
+func (m *tsTestMuxer) psi(pid int, table []byte) {
+	crc := uint32(0xffffffff)
+	for _, b := range table {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	section := append(append([]byte{0}, table...), byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+	m.packets(pid, section)
+}
+
+// video 输出一个带 PTS / DTS 的视频 PES，data 为 Annex-B 格式
+func (m *tsTestMuxer) video(pts, dts int64, data []byte) {
+	pes := []byte{0, 0, 1, 0xe0, 0, 0, 0x80, 0xc0, 10}
+	pes = append(pes, putTestPESTimestamp(3, pts)...)
+	pes = append(pes, putTestPESTimestamp(1, dts)...)
+	m.packets(testPIDVideo, append(pes, data...))
+}
+
+// audio 输出一个只带 PTS 的音频 PES，包含一个 48kHz 立体声 AAC-LC 的 ADTS 帧
+func (m *tsTestMuxer) audio(pts int64) {
+	frame := make([]byte, 7+100)
+	frame[0], frame[1] = 0xff, 0xf1
+	frame[2] = 1<<6 | 3<<2 // AAC-LC, 48000Hz
+	frame[3] = 2 << 6      // 2 声道
+	frame[3] |= byte(len(frame)>>11) & 0x03
+	frame[4] = byte(len(frame) >> 3)
+	frame[5] = byte(len(frame)&0x07)<<5 | 0x1f
+	frame[6] = 0xfc
+	pes := []byte{0, 0, 1, 0xc0, 0, 0, 0x80, 0x80, 5}
+	pes = append(pes, putTestPESTimestamp(2, pts)...)
+	m.packets(testPIDAudio, append(pes, frame...))
+}
+
+// putTestPESTimestamp 编码 5 字节的 33 位 PTS / DTS
+func putTestPESTimestamp(prefix byte, ts int64) []byte {
+	return []byte{
+		prefix<<4 | byte(ts>>29)&0x0e | 1,
+		byte(ts >> 22),
+		byte(ts>>14) | 1,
+		byte(ts >> 7),
+		byte(ts<<1) | 1,
+	}
+}
+
+// testH264Frame 返回 Annex-B 格式的 H.264 帧，关键帧带 SPS
+func testH264Frame(key bool, size int) []byte {
+	sps := []byte{0, 0, 0, 1, 0x67, 0x64, 0x00, 0x28, 0xac, 0xd9, 0x40, 0x78, 0x02, 0x27, 0xe5, 0xc0, 0x44, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0x28, 0xc3, 0xc6, 0x0c, 0x65, 0x80}
+	nalu := []byte{0, 0, 0, 1, 0x41}
+	if key {
+		nalu = append(sps, 0, 0, 0, 1, 0x65)
+	}
+	return append(nalu, bytes.Repeat([]byte{0x55}, size)...)
+}
+
+// genTSSegment 生成 25fps、GOP 为 50 帧的 H.264 + AAC 分片，第 n 帧 DTS 为 1s + n*40ms，PTS 比 DTS 晚一帧
+func genTSSegment(startFrame, frames int) []byte {
+	m := newTSTestMuxer(tsStreamTypeH264)
+	for i := startFrame; i < startFrame+frames; i++ {
+		dts := int64(i)*3600 + 90000
+		m.video(dts+3600, dts, testH264Frame(i%50 == 0, 2000))
+		m.audio(dts)
+	}
+	return m.out
+}
+
+// readAllPackets 读出解复用器的所有包
+func readAllPackets(t *testing.T, d *tsDemuxer) []av.Packet {
+	t.Helper()
+	var pkts []av.Packet
+	for {
+		pkt, err := d.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			return pkts
+		}
+		if err != nil {
+			t.Fatalf("ReadPacket: %v", err)
+		}
+		pkts = append(pkts, pkt)
+	}
+}
+
+func TestTSDemuxer(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		frames int
+		audio  int
+	}{
+		{"完整分片", genTSSegment(0, 50), 50, 50},
+		{"开头有无效数据", append(bytes.Repeat([]byte{0xff}, 100), genTSSegment(0, 10)...), 10, 10},
+		// 最后一个视频 PES 在数据结束时输出，被截断的音频包丢弃
+		{"末尾截断", genTSSegment(0, 10)[:len(genTSSegment(0, 10))-tsPacketSize/2], 10, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pkts := readAllPackets(t, newTSDemuxer(bytes.NewReader(tt.data)))
+
+			var video, keyframes, audio, configs int
+			for _, pkt := range pkts {
+				switch pkt.Type {
+				case av.H264:
+					wantDTS := time.Second + time.Duration(video)*40*time.Millisecond
+					if pkt.Time != wantDTS || pkt.CTime != 40*time.Millisecond {
+						t.Errorf("视频帧 %d: DTS=%v CTS=%v, want %v 40ms", video, pkt.Time, pkt.CTime, wantDTS)
+					}
+					if pkt.IsKeyFrame {
+						keyframes++
+					}
+					video++
+				case av.AAC:
+					if configs == 0 {
+						t.Errorf("AAC 帧之前没有 AudioSpecificConfig")
+					}
+					if len(pkt.Data) != 100 {
+						t.Errorf("AAC 帧长度 = %d, want 100（不含 ADTS 头）", len(pkt.Data))
+					}
+					audio++
+				case av.AACDecoderConfig:
+					configs++
+				}
+			}
+			if video != tt.frames || audio != tt.audio || configs != 1 || keyframes != 1 {
+				t.Errorf("video=%d audio=%d configs=%d keyframes=%d, want %d %d 1 1", video, audio, configs, keyframes, tt.frames, tt.audio)
+			}
+		})
+	}
+}
+
+func TestTSDemuxerNoSync(t *testing.T) {
+	d := newTSDemuxer(bytes.NewReader(bytes.Repeat([]byte{0xff}, tsPacketSize*10)))
+	if _, err := d.ReadPacket(); err == nil || errors.Is(err, io.EOF) {
+		t.Fatalf("ReadPacket() error = %v, want 找不到同步字节", err)
+	}
+}
+
+func TestParsePESTimestamp(t *testing.T) {
+	for _, ts := range []int64{0, 1, 90000, 1<<32 + 12345, 1<<33 - 1} {
+		if got := parsePESTimestamp(putTestPESTimestamp(2, ts)); got != ts {
+			t.Errorf("parsePESTimestamp(%d) = %d", ts, got)
+		}
+	}
+}
+
+func TestUnwrapPTS(t *testing.T) {
+	const period = 1 << 33
+	tests := []struct {
+		name     string
+		pts, dts int64
+		want     int64
+	}{
+		{"未回绕", 93600, 90000, 93600},
+		{"PTS 已回绕 DTS 未回绕", 1800, period - 1800, period + 1800},
+		{"DTS 已回绕 PTS 未回绕", period - 1800, 1800, -1800},
+		{"PTS 早于 DTS", 86400, 90000, 86400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unwrapPTS(tt.pts, tt.dts); got != tt.want {
+				t.Errorf("unwrapPTS(%d, %d) = %d, want %d", tt.pts, tt.dts, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsH264KeyFrame(t *testing.T) {
+	if !isH264KeyFrame(testH264Frame(true, 10)) {
+		t.Error("IDR 帧未识别为关键帧")
+	}
+	if isH264KeyFrame(testH264Frame(false, 10)) {
+		t.Error("非 IDR 帧被识别为关键帧")
+	}
+}
+
+// tsTestPacket 构造只用于连续计数器检查的 TS 包
+func tsTestPacket(cc byte, payload, discontinuity bool) []byte {
+	b := make([]byte, tsPacketSize)
+	b[0], b[1], b[2] = tsSyncByte, testPIDVideo>>8, testPIDVideo&0xff
+	b[3] = 0x20 | cc // 带 adaptation field
+	if payload {
+		b[3] |= 0x10
+	}
+	b[4] = 1
+	if discontinuity {
+		b[5] = 0x80
+	}
+	return b
+}
+
+func TestTSContinuity(t *testing.T) {
+	type pkt struct {
+		cc            byte
+		payload       bool
+		discontinuity bool
+	}
+	seq := func(ccs ...byte) []pkt {
+		var out []pkt
+		for _, cc := range ccs {
+			out = append(out, pkt{cc: cc, payload: true})
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		packets []pkt
+		want    int64
+	}{
+		{"连续并回绕", seq(14, 15, 0, 1), 0},
+		{"允许一次重复包", seq(0, 1, 1, 2), 0},
+		{"连续两次重复", seq(0, 1, 1, 1), 1},
+		{"跳号", seq(0, 1, 3, 4), 1},
+		{"无负载的包计数不变", []pkt{{0, true, false}, {0, false, false}, {1, true, false}}, 0},
+		{"无负载的包计数变化", []pkt{{0, true, false}, {1, false, false}}, 1},
+		{"discontinuity_indicator 后重新计数", []pkt{{0, true, false}, {7, true, true}, {8, true, false}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newTSDemuxer(bytes.NewReader(nil))
+			for _, p := range tt.packets {
+				d.checkContinuity(testPIDVideo, tsTestPacket(p.cc, p.payload, p.discontinuity))
+			}
+			if got := d.continuityErrors()[testPIDVideo]; got != tt.want {
+				t.Errorf("errors = %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// 分片中丢失一个视频包
+	data := genTSSegment(0, 10)
+	lost := -1
+	for off := 0; off < len(data); off += tsPacketSize {
+		if pid := int(data[off+1]&0x1f)<<8 | int(data[off+2]); pid == testPIDVideo && data[off+1]&0x40 == 0 {
+			lost = off
+			break
+		}
+	}
+	data = append(data[:lost:lost], data[lost+tsPacketSize:]...)
+	d := newTSDemuxer(bytes.NewReader(data))
+	readAllPackets(t, d)
+	if errs := d.continuityErrors(); errs[testPIDVideo] != 1 || errs[testPIDAudio] != 0 || errs[testPIDPMT] != 0 {
+		t.Errorf("continuityErrors() = %v, want 视频 PID 1 个", errs)
+	}
+}
+
+func TestTSDemuxerHEVC(t *testing.T) {
+	// IDR_W_RADL、TRAIL_R、CRA 各一帧，关键帧前带 VPS
+	frames := [][]byte{
+		{0, 0, 0, 1, 0x40, 0x01, 0x0c, 0, 0, 0, 1, 0x26, 0x01, 0xaf},
+		{0, 0, 0, 1, 0x02, 0x01, 0xd0},
+		{0, 0, 0, 1, 0x2a, 0x01, 0xaf},
+	}
+	m := newTSTestMuxer(tsStreamTypeH265)
+	for i, frame := range frames {
+		dts := int64(i)*3600 + 90000
+		m.video(dts, dts, frame)
+	}
+	d := newTSDemuxer(bytes.NewReader(m.out))
+	pkts := readAllPackets(t, d)
+	if len(pkts) != len(frames) {
+		t.Fatalf("packets = %d, want %d", len(pkts), len(frames))
+	}
+	for i, want := range []bool{true, false, true} {
+		if pkts[i].Type != av.H264 || pkts[i].IsKeyFrame != want || !bytes.Equal(pkts[i].Data, frames[i]) {
+			t.Errorf("帧 %d: type=%v key=%v data=%x", i, pkts[i].Type, pkts[i].IsKeyFrame, pkts[i].Data)
+		}
+	}
+	if codec := d.codec(); codec != "H265" {
+		t.Errorf("codec() = %q, want H265", codec)
+	}
+
+	d = newTSDemuxer(bytes.NewReader(genTSSegment(0, 1)))
+	readAllPackets(t, d)
+	if codec := d.codec(); codec != "H264" {
+		t.Errorf("codec() = %q, want H264", codec)
+	}
+}
+
+func TestIsH265KeyFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"BLA_W_LP", []byte{0, 0, 1, 16 << 1, 0x01}, true},
+		{"IDR_N_LP", []byte{0, 0, 1, 20 << 1, 0x01}, true},
+		{"CRA 前有 SEI", []byte{0, 0, 1, 39 << 1, 0x01, 0x05, 0, 0, 1, 21 << 1, 0x01}, true},
+		{"TRAIL_R", []byte{0, 0, 1, 1 << 1, 0x01}, false},
+		{"只有参数集", []byte{0, 0, 1, 32 << 1, 0x01, 0, 0, 1, 33 << 1, 0x01, 0, 0, 1, 34 << 1, 0x01}, false},
+		// H.264 IDR 的 NAL 头 0x65 按 H.265 解析为类型 50
+		{"H.264 IDR", []byte{0, 0, 1, 0x65, 0x88}, false},
+	}
+	for _, tt := range tests {
+		if got := isH265KeyFrame(tt.data); got != tt.want {
+			t.Errorf("%s: isH265KeyFrame() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
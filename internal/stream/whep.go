@@ -0,0 +1,490 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	urlpkg "net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nareix/joy5/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+	"github.com/pion/webrtc/v4/pkg/media/samplebuilder"
+)
+
+// whepDisconnectGrace ICE 断开后等待恢复的时间，超过后才认为连接失败
+const whepDisconnectGrace = 5 * time.Second
+
+// whepStats 一次 WHEP 检查得到的 WebRTC 指标
+type whepStats struct {
+	iceConnectTime   int64 // 设置远端 SDP 到 ICE 连接成功的耗时（毫秒）
+	timeToFirstFrame int64 // 发送 offer 到收到第一个完整视频帧的耗时（毫秒）
+	nackCount        int64 // 发出的 NACK 数
+	pliCount         int64 // 发出的 PLI 数（不含本端收到视频轨道时主动请求的第一个）
+	packetLossRatio  float64
+	jitter           int64 // 视频轨道 RFC 3550 到达抖动（毫秒）
+}
+
+// whepRTCPCounter 统计本端发出的 NACK / PLI
+// 需要先于 NACK 生成器注册，才能看到它写出的 RTCP
+type whepRTCPCounter struct {
+	interceptor.NoOp
+	nacks atomic.Int64
+	plis  atomic.Int64
+}
+
+// NewInterceptor 实现 interceptor.Factory，所有连接共用同一个计数器
+func (c *whepRTCPCounter) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return c, nil
+}
+
+// BindRTCPWriter 在 RTCP 写出前计数
+func (c *whepRTCPCounter) BindRTCPWriter(writer interceptor.RTCPWriter) interceptor.RTCPWriter {
+	return interceptor.RTCPWriterFunc(func(pkts []rtcp.Packet, attrs interceptor.Attributes) (int, error) {
+		for _, p := range pkts {
+			switch p.(type) {
+			case *rtcp.TransportLayerNack:
+				c.nacks.Add(1)
+			case *rtcp.PictureLossIndication:
+				c.plis.Add(1)
+			}
+		}
+		return writer.Write(pkts, attrs)
+	})
+}
+
+// whepTrack 一个远端媒体轨道
+type whepTrack struct {
+	rtpStats
+	media   string // video / audio
+	codec   string // H264 / VP8 / OPUS
+	builder *samplebuilder.SampleBuilder
+}
+
+// whepReader 通过 WHEP 拉流，按轨道解包后输出 av.Packet
+type whepReader struct {
+	pc          *webrtc.PeerConnection
+	resourceURL string // 201 响应 Location 给出的会话地址，关闭时 DELETE
+	counter     *whepRTCPCounter
+	initialPLIs atomic.Int64 // 收到视频轨道时主动发出的 PLI 数，统计时扣除
+
+	packets chan av.Packet
+	failed  chan error
+	done    chan struct{}
+	epoch   time.Time
+
+	mu           sync.Mutex
+	tracks       []*whepTrack
+	disconnected *time.Timer // ICE 断开后的失败计时，恢复连接时取消
+	offerSent    time.Time
+	answerSet    time.Time
+	iceConnected time.Time
+	firstFrame   time.Time
+
+	videoCodec   string
+	responseTime int64       // WHEP POST 请求响应时间（毫秒）
+	header       http.Header // 附加到 POST / DELETE 请求的请求头
+}
+
+// openWHEP 创建仅接收的 PeerConnection，完成 ICE 收集后通过 HTTP POST 交换 SDP
+func openWHEP(ctx context.Context, rawURL string, header http.Header) (*whepReader, error) {
+	m := &webrtc.MediaEngine{}
+	if err := registerWHEPCodecs(m); err != nil {
+		return nil, fmt.Errorf("注册编解码器失败: %w", err)
+	}
+	counter := &whepRTCPCounter{}
+	ir := &interceptor.Registry{}
+	ir.Add(counter)
+	if err := webrtc.RegisterDefaultInterceptors(m, ir); err != nil {
+		return nil, fmt.Errorf("注册拦截器失败: %w", err)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(ir))
+
+	pc, err := api.NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return nil, fmt.Errorf("创建 PeerConnection 失败: %w", err)
+	}
+	r := &whepReader{
+		pc:      pc,
+		counter: counter,
+		packets: make(chan av.Packet, 1024),
+		failed:  make(chan error, 1),
+		done:    make(chan struct{}),
+		epoch:   time.Now(),
+		header:  header,
+	}
+	if err := r.negotiate(ctx, rawURL); err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// negotiate 添加收发器、发送 offer 并应用 answer
+func (r *whepReader) negotiate(ctx context.Context, rawURL string) error {
+	recvonly := webrtc.RTPTransceiverInit{Direction: webrtc.RTPTransceiverDirectionRecvonly}
+	for _, kind := range []webrtc.RTPCodecType{webrtc.RTPCodecTypeVideo, webrtc.RTPCodecTypeAudio} {
+		if _, err := r.pc.AddTransceiverFromKind(kind, recvonly); err != nil {
+			return fmt.Errorf("添加收发器失败: %w", err)
+		}
+	}
+
+	r.pc.OnICEConnectionStateChange(r.handleICEState)
+	r.pc.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		// 立即请求关键帧，缩短首帧时间；这个 PLI 不反映链路质量，不计入 PLI 数
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			if err := r.pc.WriteRTCP([]rtcp.Packet{&rtcp.PictureLossIndication{MediaSSRC: uint32(track.SSRC())}}); err == nil {
+				r.initialPLIs.Add(1)
+			}
+		}
+		go r.readTrack(track)
+	})
+
+	offer, err := r.pc.CreateOffer(nil)
+	if err != nil {
+		return fmt.Errorf("创建 offer 失败: %w", err)
+	}
+	gathered := webrtc.GatheringCompletePromise(r.pc)
+	if err := r.pc.SetLocalDescription(offer); err != nil {
+		return fmt.Errorf("设置本地 SDP 失败: %w", err)
+	}
+	// 不使用 trickle ICE，等候选收集完成后一次性发送
+	select {
+	case <-gathered:
+	case <-ctx.Done():
+		return fmt.Errorf("ICE 候选收集超时: %w", ctx.Err())
+	}
+
+	initHTTPClient()
+	req, err := newHTTPRequest(ctx, "POST", rawURL, strings.NewReader(r.pc.LocalDescription().SDP), r.header)
+	if err != nil {
+		return fmt.Errorf("创建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/sdp")
+
+	r.mu.Lock()
+	r.offerSent = time.Now()
+	r.mu.Unlock()
+	resp, err := globalHTTPClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接失败: %w", err)
+	}
+	defer resp.Body.Close()
+	r.responseTime = time.Since(r.offerSent).Milliseconds()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP状态码: %d", resp.StatusCode)
+	}
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取 answer 失败: %w", err)
+	}
+	if loc := resp.Header.Get("Location"); loc != "" {
+		if u, err := resp.Request.URL.Parse(loc); err == nil {
+			r.resourceURL = u.String()
+		}
+	}
+
+	// ICE 连通性检查在设置远端 SDP 时开始
+	r.mu.Lock()
+	r.answerSet = time.Now()
+	r.mu.Unlock()
+	if err := r.pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: string(answer)}); err != nil {
+		return fmt.Errorf("设置远端 SDP 失败: %w", err)
+	}
+
+	return nil
+}
+
+// handleICEState 处理 ICE 状态变化：Failed / Closed 立即失败，
+// Disconnected 可能在网络抖动后自行恢复，超过 whepDisconnectGrace 仍未恢复才失败
+func (r *whepReader) handleICEState(state webrtc.ICEConnectionState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch state {
+	case webrtc.ICEConnectionStateConnected, webrtc.ICEConnectionStateCompleted:
+		if r.iceConnected.IsZero() {
+			r.iceConnected = time.Now()
+		}
+		if r.disconnected != nil {
+			r.disconnected.Stop()
+			r.disconnected = nil
+		}
+	case webrtc.ICEConnectionStateDisconnected:
+		if r.disconnected == nil {
+			r.disconnected = time.AfterFunc(whepDisconnectGrace, func() {
+				r.fail(fmt.Errorf("ICE 连接断开超过 %v", whepDisconnectGrace))
+			})
+		}
+	case webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateClosed:
+		r.fail(fmt.Errorf("ICE 连接%s", state))
+	}
+}
+
+// readTrack 读取一个远端轨道的 RTP，更新统计并组帧
+func (r *whepReader) readTrack(track *webrtc.TrackRemote) {
+	codec := track.Codec()
+	t := &whepTrack{
+		media: track.Kind().String(),
+		codec: strings.ToUpper(strings.TrimPrefix(strings.TrimPrefix(codec.MimeType, "video/"), "audio/")),
+	}
+	t.clockRate = int(codec.ClockRate)
+
+	var depacketizer rtp.Depacketizer
+	switch t.codec {
+	case "H264":
+		depacketizer = &codecs.H264Packet{}
+	case "VP8":
+		depacketizer = &codecs.VP8Packet{}
+	case "OPUS":
+		depacketizer = &codecs.OpusPacket{}
+	}
+	if depacketizer != nil {
+		t.builder = samplebuilder.New(256, depacketizer, codec.ClockRate)
+	}
+
+	// RTP 中没有 Opus 的解码配置，按协商结果构造 OpusHead（sprop-stereo=1 为双声道，缺省为单声道，见 RFC 7587）
+	if t.codec == "OPUS" {
+		channels := byte(1)
+		if strings.Contains(codec.SDPFmtpLine, "sprop-stereo=1") {
+			channels = 2
+		}
+		if !r.send(av.Packet{Type: av.AACDecoderConfig, Data: append([]byte("OpusHead"), 1, channels)}) {
+			return
+		}
+	}
+
+	r.mu.Lock()
+	r.tracks = append(r.tracks, t)
+	if t.media == "video" {
+		r.videoCodec = t.codec
+	}
+	r.mu.Unlock()
+
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			return
+		}
+		r.mu.Lock()
+		t.updateStats(pkt.SequenceNumber, pkt.Timestamp, time.Now(), r.epoch)
+		r.mu.Unlock()
+		if t.builder == nil {
+			continue
+		}
+
+		t.builder.Push(pkt)
+		for s := t.builder.Pop(); s != nil; s = t.builder.Pop() {
+			if !r.emit(t, s) {
+				return
+			}
+		}
+	}
+}
+
+// emit 把组好的帧转换为 av.Packet 交给采样循环
+func (r *whepReader) emit(t *whepTrack, s *media.Sample) bool {
+	r.mu.Lock()
+	pkt := av.Packet{Data: s.Data, Time: t.extendedTime(s.PacketTimestamp)}
+	if t.media == "video" {
+		// 统一以 av.H264 类型进入采样循环，实际编码由 videoCodec 给出
+		pkt.Type = av.H264
+		pkt.IsKeyFrame = isWHEPKeyFrame(t.codec, s.Data)
+		if r.firstFrame.IsZero() {
+			r.firstFrame = time.Now()
+		}
+	} else {
+		// 统一以 av.AAC 类型进入采样循环，WHEP 只协商 Opus 音频
+		pkt.Type = av.AAC
+	}
+	r.mu.Unlock()
+
+	return r.send(pkt)
+}
+
+// send 把数据包交给采样循环，会话关闭时返回 false
+func (r *whepReader) send(pkt av.Packet) bool {
+	select {
+	case r.packets <- pkt:
+		return true
+	case <-r.done:
+		return false
+	}
+}
+
+// fail 记录致命错误（只保留第一个）
+func (r *whepReader) fail(err error) {
+	select {
+	case r.failed <- err:
+	default:
+	}
+}
+
+// ReadPacket 读取下一个音视频包
+func (r *whepReader) ReadPacket() (av.Packet, error) {
+	select {
+	case pkt := <-r.packets:
+		return pkt, nil
+	case err := <-r.failed:
+		return av.Packet{}, err
+	case <-r.done:
+		return av.Packet{}, io.EOF
+	}
+}
+
+// stats 汇总本次检查的 WHEP 指标
+func (r *whepReader) stats() whepStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	st := whepStats{
+		nackCount: r.counter.nacks.Load(),
+		pliCount:  r.counter.plis.Load() - r.initialPLIs.Load(),
+	}
+	if !r.iceConnected.IsZero() && !r.answerSet.IsZero() {
+		st.iceConnectTime = max(r.iceConnected.Sub(r.answerSet).Milliseconds(), 0)
+	}
+	if !r.firstFrame.IsZero() {
+		st.timeToFirstFrame = r.firstFrame.Sub(r.offerSent).Milliseconds()
+	}
+
+	streams := make([]*rtpStats, 0, len(r.tracks))
+	for _, t := range r.tracks {
+		streams = append(streams, &t.rtpStats)
+		if t.media == "video" && t.initialized {
+			st.jitter = t.jitterMs()
+		}
+	}
+	_, st.packetLossRatio = rtpLoss(streams)
+	return st
+}
+
+// Close 关闭 PeerConnection 并删除服务端会话
+func (r *whepReader) Close() error {
+	select {
+	case <-r.done:
+		return nil
+	default:
+		close(r.done)
+	}
+	r.mu.Lock()
+	if r.disconnected != nil {
+		r.disconnected.Stop()
+	}
+	r.mu.Unlock()
+	err := r.pc.Close()
+
+	if r.resourceURL != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if req, reqErr := newHTTPRequest(ctx, "DELETE", r.resourceURL, nil, r.header); reqErr == nil {
+			if resp, doErr := globalHTTPClient.Do(req); doErr == nil {
+				resp.Body.Close()
+			}
+		}
+	}
+	return err
+}
+
+// registerWHEPCodecs 注册可解包的编解码器：H.264（常见 profile）、VP8、Opus
+func registerWHEPCodecs(m *webrtc.MediaEngine) error {
+	videoFeedback := []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}}
+	videoCodecs := []webrtc.RTPCodecParameters{
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42001f", RTCPFeedback: videoFeedback}, PayloadType: 102},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f", RTCPFeedback: videoFeedback}, PayloadType: 106},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=4d001f", RTCPFeedback: videoFeedback}, PayloadType: 127},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=64001f", RTCPFeedback: videoFeedback}, PayloadType: 112},
+		{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000,
+			RTCPFeedback: videoFeedback}, PayloadType: 96},
+	}
+	for _, c := range videoCodecs {
+		if err := m.RegisterCodec(c, webrtc.RTPCodecTypeVideo); err != nil {
+			return err
+		}
+	}
+	return m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2,
+			SDPFmtpLine: "minptime=10;useinbandfec=1"},
+		PayloadType: 111,
+	}, webrtc.RTPCodecTypeAudio)
+}
+
+// isWHEPKeyFrame 判断组好的视频帧是否为关键帧
+func isWHEPKeyFrame(codec string, data []byte) bool {
+	switch codec {
+	case "H264":
+		return isH264KeyFrame(data)
+	case "VP8":
+		// VP8 帧头第一个字节最低位 P=0 表示关键帧（RFC 6386 9.1）
+		return len(data) > 0 && data[0]&0x01 == 0
+	}
+	return false
+}
+
+// isWHEPURL 根据路径判断是否为 WHEP 端点（如 MediaMTX 的 /{path}/whep）
+func isWHEPURL(rawURL string) bool {
+	u, err := urlpkg.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && strings.HasSuffix(strings.TrimSuffix(u.Path, "/"), "/whep")
+}
+
+// whepProber WHEP 探测器
+type whepProber struct{}
+
+// Open 完成 SDP 交换并等待媒体轨道
+func (whepProber) Open(ctx context.Context, opts ProbeOptions) (Session, error) {
+	r, err := openWHEP(ctx, opts.URL, opts.Header)
+	if err != nil {
+		return nil, err
+	}
+	return &readerSession{
+		r: &avPacketReader{
+			r: r,
+			videoCodec: func() string {
+				r.mu.Lock()
+				defer r.mu.Unlock()
+				return r.videoCodec
+			},
+			audioCodec: func() string { return "OPUS" },
+			ptsOnly:    true,
+		},
+		closer:       r.Close,
+		responseTime: r.responseTime,
+		finish: func(rep *Report) {
+			// 与 RTSP 相同，丢包率和抖动来自 RTP 统计
+			st := r.stats()
+			rep.stats = st
+			rep.PacketLossRatio = st.packetLossRatio
+			rep.NetworkJitter = st.jitter
+			opts.Log.Debug("WHEP 检查完成",
+				"ICE连接ms", st.iceConnectTime,
+				"首帧ms", st.timeToFirstFrame,
+				"NACK数", st.nackCount,
+				"PLI数", st.pliCount)
+		},
+	}, nil
+}
+
+// fill 写入 WHEP 指标
+func (s whepStats) fill(m *Metrics) {
+	m.WHEPICEConnectTime = s.iceConnectTime
+	m.WHEPTimeToFirstFrame = s.timeToFirstFrame
+	m.WHEPNACKCount = s.nackCount
+	m.WHEPPLICount = s.pliCount
+}
@@ -0,0 +1,283 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nareix/joy5/av"
+	"github.com/pion/interceptor"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v4"
+	"github.com/pion/webrtc/v4/pkg/media"
+)
+
+// rtpDropper 丢弃视频轨道的部分首发 RTP 包（重传不丢），让接收端发出 NACK
+type rtpDropper struct {
+	interceptor.NoOp
+	every int
+}
+
+// NewInterceptor 实现 interceptor.Factory
+func (d *rtpDropper) NewInterceptor(string) (interceptor.Interceptor, error) {
+	return d, nil
+}
+
+// BindLocalStream 只处理视频轨道
+func (d *rtpDropper) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	if info.ClockRate != 90000 {
+		return writer
+	}
+	var n int
+	dropped := map[uint16]bool{}
+	return interceptor.RTPWriterFunc(func(h *rtp.Header, payload []byte, attrs interceptor.Attributes) (int, error) {
+		n++
+		if n%d.every == 0 && !dropped[h.SequenceNumber] {
+			dropped[h.SequenceNumber] = true
+			return len(payload), nil
+		}
+		return writer.Write(h, payload, attrs)
+	})
+}
+
+// fakeWHEPServer WHEP 服务端：对每个 offer 创建 pion answerer，推送 H.264 和 Opus
+type fakeWHEPServer struct {
+	*httptest.Server
+	plis    atomic.Int64 // 收到的 PLI 数
+	deleted atomic.Bool  // 会话是否已被 DELETE
+
+	mu  sync.Mutex
+	pcs []*webrtc.PeerConnection
+}
+
+// newFakeWHEPServer 启动服务端，测试结束时关闭所有连接
+func newFakeWHEPServer(t *testing.T) *fakeWHEPServer {
+	s := &fakeWHEPServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /live/whep", func(w http.ResponseWriter, req *http.Request) {
+		offer, _ := io.ReadAll(req.Body)
+		answer, err := s.answer(string(offer))
+		if err != nil {
+			t.Errorf("answer: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Location", "/live/whep/session1")
+		w.Header().Set("Content-Type", "application/sdp")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, answer)
+	})
+	mux.HandleFunc("DELETE /live/whep/session1", func(w http.ResponseWriter, req *http.Request) {
+		s.deleted.Store(true)
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(func() {
+		s.Close()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, pc := range s.pcs {
+			pc.Close()
+		}
+	})
+	return s
+}
+
+// answer 创建 answerer 并开始推流，返回完成 ICE 收集的 answer
+func (s *fakeWHEPServer) answer(offer string) (string, error) {
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return "", err
+	}
+	ir := &interceptor.Registry{}
+	// 丢包拦截器在 NACK 响应器之前注册，重传包不经过它
+	ir.Add(&rtpDropper{every: 20})
+	if err := webrtc.ConfigureNack(m, ir); err != nil {
+		return "", err
+	}
+	pc, err := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(ir)).NewPeerConnection(webrtc.Configuration{})
+	if err != nil {
+		return "", err
+	}
+	s.mu.Lock()
+	s.pcs = append(s.pcs, pc)
+	s.mu.Unlock()
+
+	video, _ := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}, "video", "live")
+	audio, _ := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2}, "audio", "live")
+	sender, err := pc.AddTrack(video)
+	if err != nil {
+		return "", err
+	}
+	if _, err := pc.AddTrack(audio); err != nil {
+		return "", err
+	}
+	keyframe := make(chan struct{}, 1)
+	go func() {
+		for {
+			pkts, _, err := sender.ReadRTCP()
+			if err != nil {
+				return
+			}
+			for _, p := range pkts {
+				if _, ok := p.(*rtcp.PictureLossIndication); ok {
+					s.plis.Add(1)
+					select {
+					case keyframe <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+	}()
+
+	if err := pc.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer}); err != nil {
+		return "", err
+	}
+	desc, err := pc.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	gathered := webrtc.GatheringCompletePromise(pc)
+	if err := pc.SetLocalDescription(desc); err != nil {
+		return "", err
+	}
+	<-gathered
+
+	go func() {
+		// 25fps 视频，只在收到 PLI 时发关键帧；每帧 40ms 对应两个 20ms 的 Opus 包
+		for i := 0; pc.ConnectionState() != webrtc.PeerConnectionStateClosed && i < 25*10; i++ {
+			frame := testH264Frame(false, 3000)
+			select {
+			case <-keyframe:
+				frame = testH264Frame(true, 3000)
+			default:
+			}
+			video.WriteSample(media.Sample{Data: frame, Duration: 40 * time.Millisecond})
+			for range 2 {
+				audio.WriteSample(media.Sample{Data: bytes.Repeat([]byte{0xfc}, 80), Duration: 20 * time.Millisecond})
+			}
+			time.Sleep(40 * time.Millisecond)
+		}
+	}()
+	return pc.LocalDescription().SDP, nil
+}
+
+func TestWHEPReader(t *testing.T) {
+	srv := newFakeWHEPServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	r, err := openWHEP(ctx, srv.URL+"/live/whep", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.resourceURL != srv.URL+"/live/whep/session1" {
+		t.Errorf("resourceURL = %q", r.resourceURL)
+	}
+
+	// 超时后关闭会话，ReadPacket 返回错误
+	timer := time.AfterFunc(5*time.Second, func() { r.Close() })
+	defer timer.Stop()
+
+	var video, keyframes, audio int
+	var opusHead []byte
+	for video < 50 {
+		pkt, err := r.ReadPacket()
+		if err != nil {
+			t.Fatalf("ReadPacket: %v（video=%d audio=%d）", err, video, audio)
+		}
+		switch pkt.Type {
+		case av.H264:
+			if pkt.IsKeyFrame {
+				keyframes++
+			}
+			video++
+		case av.AAC:
+			audio++
+		case av.AACDecoderConfig:
+			opusHead = pkt.Data
+		}
+	}
+
+	r.mu.Lock()
+	videoCodec := r.videoCodec
+	r.mu.Unlock()
+	if videoCodec != "H264" {
+		t.Errorf("videoCodec = %q, want H264", videoCodec)
+	}
+	// 服务端只在收到 PLI 时发送关键帧
+	if keyframes != 1 || audio < 50 {
+		t.Errorf("keyframes=%d audio=%d, want 1 >=50", keyframes, audio)
+	}
+	if !bytes.Equal(opusHead, []byte("OpusHead\x01\x01")) {
+		t.Errorf("OpusHead = %q", opusHead)
+	}
+
+	st := r.stats()
+	if st.nackCount == 0 {
+		t.Error("nackCount = 0，丢包后应发出 NACK")
+	}
+	// 本端收到视频轨道时主动请求的 PLI 已到达服务端，但不计入 PLI 数
+	if srv.plis.Load() == 0 || st.pliCount != 0 {
+		t.Errorf("服务端收到 PLI %d 个，pliCount = %d, want >0 0", srv.plis.Load(), st.pliCount)
+	}
+	if st.iceConnectTime < 0 || st.timeToFirstFrame <= 0 {
+		t.Errorf("iceConnectTime=%d timeToFirstFrame=%d", st.iceConnectTime, st.timeToFirstFrame)
+	}
+
+	r.Close()
+	if !srv.deleted.Load() {
+		t.Error("关闭时没有 DELETE 会话")
+	}
+}
+
+func TestWHEPICEState(t *testing.T) {
+	r := &whepReader{failed: make(chan error, 1)}
+
+	// 断开后恢复不算失败
+	r.handleICEState(webrtc.ICEConnectionStateConnected)
+	r.handleICEState(webrtc.ICEConnectionStateDisconnected)
+	if r.disconnected == nil {
+		t.Fatal("断开后没有开始计时")
+	}
+	r.handleICEState(webrtc.ICEConnectionStateConnected)
+	if r.disconnected != nil {
+		t.Fatal("恢复连接后没有取消计时")
+	}
+	select {
+	case err := <-r.failed:
+		t.Fatalf("断开后恢复被认为失败: %v", err)
+	default:
+	}
+
+	r.handleICEState(webrtc.ICEConnectionStateFailed)
+	select {
+	case <-r.failed:
+	default:
+		t.Error("Failed 状态没有使检查失败")
+	}
+}
+
+func TestIsWHEPURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"http://example.com/live/whep", true},
+		{"https://example.com/live/whep/", true},
+		{"https://example.com/live/index.m3u8", false},
+		{"rtsp://example.com/live/whep", false},
+	}
+	for _, tt := range tests {
+		if got := isWHEPURL(tt.url); got != tt.want {
+			t.Errorf("isWHEPURL(%q) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}